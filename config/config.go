@@ -0,0 +1,248 @@
+package config
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	// URL pública da aplicação, usada nos links enviados aos usuários
+	BaseURL           string
+	Auth              AuthConfig
+	Keys              KeysConfig
+	PasswordReset     PasswordResetConfig
+	EmailVerification EmailVerificationConfig
+	TwoFactor         TwoFactorConfig
+	LoginProtection   LoginProtectionConfig
+	Notifier          NotifierConfig
+	Retention         RetentionConfig
+	Pagination        PaginationConfig
+	Import            ImportConfig
+	Export            ExportConfig
+}
+
+type AuthConfig struct {
+	// Tempo de vida do token de acesso (JWT)
+	AccessTokenTTL time.Duration
+	// Tempo de vida do refresh token persistido
+	RefreshTokenTTL time.Duration
+	// Onde a lista de tokens revogados é mantida: "database" ou "memory"
+	RevocationStore string
+	// Tempo de vida dos tokens emitidos para clientes OAuth (client_credentials)
+	ClientTokenTTL time.Duration
+	// Tempo de vida dos tokens de personificação emitidos para o suporte
+	ImpersonationTTL time.Duration
+}
+
+type KeysConfig struct {
+	// Algoritmo da chave de assinatura ativa: HS256, RS256 ou ES256
+	Algorithm string
+	// Identificador da chave ativa, enviado no cabeçalho "kid" dos tokens
+	KeyID string
+	// Segredo da chave ativa quando o algoritmo é HS256
+	Secret string
+	// Permite, somente em desenvolvimento, gerar um segredo temporário quando o HS256 não tem segredo configurado
+	AllowEphemeralSecret bool
+	// Arquivo PEM com a chave privada quando o algoritmo é RS256 ou ES256
+	PrivateKeyFile string
+	// Chaves aceitas somente na verificação (rotação), no formato "kid:ALG:valor"
+	VerificationKeys []string
+}
+
+type PasswordResetConfig struct {
+	// Tempo de validade do token de redefinição de senha
+	TokenTTL time.Duration
+}
+
+type EmailVerificationConfig struct {
+	// Impede o login de usuários que ainda não confirmaram o e-mail
+	Required bool
+	// Tempo de validade do link de verificação
+	TokenTTL time.Duration
+	// Mantém o novo e-mail pendente, sem substituir o atual, até que seja confirmado pelo link enviado a ele
+	ConfirmEmailChange bool
+}
+
+type TwoFactorConfig struct {
+	// Nome exibido no aplicativo autenticador
+	Issuer string
+	// Torna a autenticação em dois fatores obrigatória para o perfil "admin"
+	RequiredForAdmin bool
+	// Tempo de validade do desafio entre a senha e o código TOTP
+	ChallengeTTL time.Duration
+}
+
+type LoginProtectionConfig struct {
+	// Falhas consecutivas de uma conta até o bloqueio temporário
+	MaxAttempts int
+	// Falhas de um mesmo IP, em qualquer conta, até o bloqueio temporário do IP
+	MaxAttemptsPerIP int
+	// Duração do bloqueio temporário
+	LockoutDuration time.Duration
+	// Espera após a primeira falha, dobrada a cada nova falha
+	BackoffBase time.Duration
+	// Período após o qual as falhas antigas são esquecidas
+	AttemptWindow time.Duration
+	// Onde as tentativas são mantidas: "database", compartilhado entre as instâncias, ou "memory"
+	Store string
+	// Intervalo entre as remoções das tentativas que não afetam mais nenhum login
+	PurgeInterval time.Duration
+}
+
+type NotifierConfig struct {
+	// Forma de entrega das notificações: "log" ou "file"
+	Driver string
+	// Arquivo usado pelo driver "file"
+	FilePath string
+}
+
+type RetentionConfig struct {
+	// Tempo que os usuários excluídos permanecem restauráveis antes do expurgo definitivo
+	DeletedUsers time.Duration
+	// Intervalo entre as execuções do expurgo de usuários excluídos
+	PurgeInterval time.Duration
+}
+
+type PaginationConfig struct {
+	// Maior quantidade de itens retornada por página; valores maiores em pageSize são reduzidos a este limite
+	MaxPageSize int
+}
+
+type ImportConfig struct {
+	// Quantidade de senhas processadas em paralelo na importação em massa
+	Workers int
+	// Usuários inseridos por transação
+	BatchSize int
+	// Maior quantidade de linhas aceita em uma importação
+	MaxRows int
+}
+
+type ExportConfig struct {
+	// Usuários lidos do banco por vez na exportação
+	BatchSize int
+}
+
+// Carrega as configurações a partir das variáveis de ambiente, usando valores padrão quando não informadas
+func Load() *Config {
+	return &Config{
+		BaseURL: getString("APP_BASE_URL", "http://localhost:8080"),
+		Auth: AuthConfig{
+			AccessTokenTTL:   getDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+			RefreshTokenTTL:  getDuration("REFRESH_TOKEN_TTL", 7*24*time.Hour),
+			RevocationStore:  getString("TOKEN_REVOCATION_STORE", "database"),
+			ClientTokenTTL:   getDuration("OAUTH_CLIENT_TOKEN_TTL", 15*time.Minute),
+			ImpersonationTTL: getDuration("IMPERSONATION_TOKEN_TTL", 10*time.Minute),
+		},
+		Keys: KeysConfig{
+			Algorithm:            getString("JWT_ALGORITHM", "HS256"),
+			KeyID:                getString("JWT_KEY_ID", "default"),
+			Secret:               os.Getenv("JWT_SECRET"),
+			AllowEphemeralSecret: getBool("JWT_ALLOW_EPHEMERAL_SECRET", false),
+			PrivateKeyFile:       os.Getenv("JWT_PRIVATE_KEY_FILE"),
+			VerificationKeys:     getList("JWT_VERIFICATION_KEYS"),
+		},
+		PasswordReset: PasswordResetConfig{
+			TokenTTL: getDuration("PASSWORD_RESET_TTL", time.Hour),
+		},
+		EmailVerification: EmailVerificationConfig{
+			Required:           getBool("REQUIRE_EMAIL_VERIFICATION", false),
+			TokenTTL:           getDuration("EMAIL_VERIFICATION_TTL", 24*time.Hour),
+			ConfirmEmailChange: getBool("CONFIRM_EMAIL_CHANGE", false),
+		},
+		TwoFactor: TwoFactorConfig{
+			Issuer:           getString("TWO_FACTOR_ISSUER", "API Users"),
+			RequiredForAdmin: getBool("REQUIRE_ADMIN_2FA", false),
+			ChallengeTTL:     getDuration("TWO_FACTOR_CHALLENGE_TTL", 5*time.Minute),
+		},
+		LoginProtection: LoginProtectionConfig{
+			MaxAttempts:      getInt("LOGIN_MAX_ATTEMPTS", 5),
+			MaxAttemptsPerIP: getInt("LOGIN_MAX_ATTEMPTS_PER_IP", 20),
+			LockoutDuration:  getDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+			BackoffBase:      getDuration("LOGIN_BACKOFF_BASE", time.Second),
+			AttemptWindow:    getDuration("LOGIN_ATTEMPT_WINDOW", 15*time.Minute),
+			Store:            getString("LOGIN_ATTEMPT_STORE", "database"),
+			PurgeInterval:    getDuration("LOGIN_ATTEMPT_PURGE_INTERVAL", 10*time.Minute),
+		},
+		Notifier: NotifierConfig{
+			Driver:   getString("NOTIFIER", "log"),
+			FilePath: getString("NOTIFIER_FILE", "notifications.log"),
+		},
+		Retention: RetentionConfig{
+			DeletedUsers:  getDuration("DELETED_USER_RETENTION", 30*24*time.Hour),
+			PurgeInterval: getDuration("DELETED_USER_PURGE_INTERVAL", time.Hour),
+		},
+		Pagination: PaginationConfig{
+			MaxPageSize: getInt("MAX_PAGE_SIZE", 100),
+		},
+		Import: ImportConfig{
+			Workers:   getInt("IMPORT_HASH_WORKERS", 4),
+			BatchSize: getInt("IMPORT_BATCH_SIZE", 500),
+			MaxRows:   getInt("IMPORT_MAX_ROWS", 10000),
+		},
+		Export: ExportConfig{
+			BatchSize: getInt("EXPORT_BATCH_SIZE", 1000),
+		},
+	}
+}
+
+func getString(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Valor inválido para %s: %q, usando %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed <= 0 {
+		log.Printf("Valor inválido para %s: %q, usando %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getDuration(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		log.Printf("Valor inválido para %s: %q, usando %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return duration
+}
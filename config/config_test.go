@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad_Defaults(t *testing.T) {
+	t.Setenv("ACCESS_TOKEN_TTL", "")
+	t.Setenv("REFRESH_TOKEN_TTL", "")
+
+	cfg := Load()
+
+	assert.Equal(t, 15*time.Minute, cfg.Auth.AccessTokenTTL)
+	assert.Equal(t, 7*24*time.Hour, cfg.Auth.RefreshTokenTTL)
+}
+
+func TestLoad_FromEnv(t *testing.T) {
+	t.Setenv("ACCESS_TOKEN_TTL", "5m")
+	t.Setenv("REFRESH_TOKEN_TTL", "invalid")
+
+	cfg := Load()
+
+	assert.Equal(t, 5*time.Minute, cfg.Auth.AccessTokenTTL)
+	// Valores inválidos mantêm o padrão
+	assert.Equal(t, 7*24*time.Hour, cfg.Auth.RefreshTokenTTL)
+}
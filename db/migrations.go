@@ -1,6 +1,8 @@
 package db
 
 import (
+	"time"
+
 	"github.com/go-gormigrate/gormigrate/v2"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
 	"gorm.io/gorm"
@@ -40,8 +42,257 @@ func RunMigrations(db *gorm.DB) error {
 				return tx.Migrator().DropTable("users")
 			},
 		},
+		{
+			ID: "20261018000001",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entity.RefreshToken{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("refresh_tokens")
+			},
+		},
+		{
+			ID: "20261018000002",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entity.RevokedToken{}, &entity.UserTokenRevocation{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("revoked_tokens", "user_token_revocations")
+			},
+		},
+		{
+			ID: "20261018000003",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entity.PasswordResetToken{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("password_reset_tokens")
+			},
+		},
+		{
+			ID: "20261018000004",
+			Migrate: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&entity.User{}); err != nil {
+					return err
+				}
+
+				// Usuários cadastrados antes da verificação de e-mail são considerados verificados
+				return tx.Model(&entity.User{}).Where("email_verified = ?", false).Updates(map[string]interface{}{
+					"email_verified": true,
+					"verified_at":    time.Now(),
+				}).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropColumn(&entity.User{}, "verified_at"); err != nil {
+					return err
+				}
+				return tx.Migrator().DropColumn(&entity.User{}, "email_verified")
+			},
+		},
+		{
+			ID: "20261018000005",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entity.User{}, &entity.RecoveryCode{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				if err := tx.Migrator().DropTable("recovery_codes"); err != nil {
+					return err
+				}
+				if err := tx.Migrator().DropColumn(&entity.User{}, "two_factor_enabled"); err != nil {
+					return err
+				}
+				return tx.Migrator().DropColumn(&entity.User{}, "two_factor_secret")
+			},
+		},
+		{
+			ID: "20261018000006",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entity.APIKey{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("api_keys")
+			},
+		},
+		{
+			ID: "20261018000007",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entity.OAuthClient{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("oauth_clients")
+			},
+		},
+		{
+			ID: "20261018000008",
+			Migrate: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&entity.Permission{}, &entity.Role{}, &entity.UserRole{}); err != nil {
+					return err
+				}
+
+				permissions := []entity.Permission{
+					{Name: entity.PermissionUsersRead, Description: "Consultar usuários"},
+					{Name: entity.PermissionUsersWrite, Description: "Alterar e desbloquear usuários"},
+					{Name: entity.PermissionUsersDelete, Description: "Excluir usuários"},
+					{Name: entity.PermissionRolesManage, Description: "Gerenciar papéis e suas atribuições"},
+					{Name: entity.PermissionClientsManage, Description: "Gerenciar clientes OAuth"},
+				}
+				if err := tx.Create(&permissions).Error; err != nil {
+					return err
+				}
+
+				// Os papéis dos perfis preservam as regras de acesso anteriores: administradores podem tudo
+				// e usuários comuns apenas consultam
+				roles := []entity.Role{
+					{Name: entity.RoleAdmin, Description: "Administrador", Permissions: permissions},
+					{Name: entity.RoleUser, Description: "Usuário", Permissions: permissions[:1]},
+				}
+				return tx.Create(&roles).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("user_roles", "role_permissions", "roles", "permissions")
+			},
+		},
+		{
+			// Usuários comuns passam a consultar somente a si mesmos, pelas regras de propriedade das rotas
+			ID: "20261018000009",
+			Migrate: func(tx *gorm.DB) error {
+				return updateRolePermission(tx, entity.RoleUser, entity.PermissionUsersRead, false)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return updateRolePermission(tx, entity.RoleUser, entity.PermissionUsersRead, true)
+			},
+		},
+		{
+			ID: "20261018000010",
+			Migrate: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&entity.ImpersonationSession{}); err != nil {
+					return err
+				}
+
+				permission := &entity.Permission{Name: entity.PermissionImpersonate, Description: "Personificar usuários para suporte"}
+				if err := tx.Create(permission).Error; err != nil {
+					return err
+				}
+				return updateRolePermission(tx, entity.RoleAdmin, entity.PermissionImpersonate, true)
+			},
+			Rollback: func(tx *gorm.DB) error {
+				if err := updateRolePermission(tx, entity.RoleAdmin, entity.PermissionImpersonate, false); err != nil {
+					return err
+				}
+				if err := tx.Where("name = ?", entity.PermissionImpersonate).Delete(&entity.Permission{}).Error; err != nil {
+					return err
+				}
+				return tx.Migrator().DropTable("impersonation_sessions")
+			},
+		},
+		{
+			ID: "20261018000011",
+			Migrate: func(tx *gorm.DB) error {
+				// Usuários existentes recebem a situação "active" pelo valor padrão da coluna
+				return tx.AutoMigrate(&entity.User{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				for _, column := range []string{"suspended_until", "status_reason", "status"} {
+					if err := tx.Migrator().DropColumn(&entity.User{}, column); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+		{
+			ID: "20261018000012",
+			Migrate: func(tx *gorm.DB) error {
+				// Exclusão lógica: a coluna deleted_at passa a marcar os usuários excluídos
+				return tx.AutoMigrate(&entity.User{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				if err := tx.Unscoped().Where("deleted_at IS NOT NULL").Delete(&entity.User{}).Error; err != nil {
+					return err
+				}
+				return tx.Migrator().DropColumn(&entity.User{}, "deleted_at")
+			},
+		},
+		{
+			ID: "20261018000013",
+			Migrate: func(tx *gorm.DB) error {
+				if err := tx.AutoMigrate(&entity.User{}); err != nil {
+					return err
+				}
+				// Usuários cadastrados antes da coluna recebem a data da migração
+				return tx.Unscoped().Model(&entity.User{}).Where("created_at IS NULL").Update("created_at", time.Now()).Error
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&entity.User{}, "created_at")
+			},
+		},
+		{
+			ID: "20261018000014",
+			Migrate: func(tx *gorm.DB) error {
+				// Os usuários existentes recebem a versão 1, valor padrão da coluna
+				return tx.AutoMigrate(&entity.User{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&entity.User{}, "version")
+			},
+		},
+		{
+			ID: "20261018000015",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entity.User{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&entity.User{}, "pending_email")
+			},
+		},
+		{
+			ID: "20261018000016",
+			Migrate: func(tx *gorm.DB) error {
+				// O corte da revogação passa a ter a precisão de microssegundos do claim "iat"
+				return tx.Migrator().AlterColumn(&entity.UserTokenRevocation{}, "RevokedBefore")
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Exec("ALTER TABLE user_token_revocations MODIFY revoked_before datetime(3) NOT NULL").Error
+			},
+		},
+		{
+			ID: "20261018000017",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entity.User{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropColumn(&entity.User{}, "totp_last_step")
+			},
+		},
+		{
+			ID: "20261018000018",
+			Migrate: func(tx *gorm.DB) error {
+				return tx.AutoMigrate(&entity.LoginAttempt{})
+			},
+			Rollback: func(tx *gorm.DB) error {
+				return tx.Migrator().DropTable("login_attempts")
+			},
+		},
 		// Mais migrações...
 	})
 
 	return migrator.Migrate()
 }
+
+// Concede ou retira uma permissão de um papel
+func updateRolePermission(tx *gorm.DB, roleName, permissionName string, grant bool) error {
+	var role entity.Role
+	if err := tx.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return err
+	}
+	var permission entity.Permission
+	if err := tx.Where("name = ?", permissionName).First(&permission).Error; err != nil {
+		return err
+	}
+
+	association := tx.Model(&role).Association("Permissions")
+	if grant {
+		return association.Append(&permission)
+	}
+	return association.Delete(&permission)
+}
@@ -0,0 +1,90 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+func (h *UserHandler) CreateAPIKey(c *gin.Context) {
+	var createRequest struct {
+		Name      string     `json:"name"`
+		ExpiresAt *time.Time `json:"expiresAt"`
+	}
+
+	if err := c.ShouldBindJSON(&createRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if createRequest.Name == "" {
+		response.BadRequest(c, errors.New("name is required"))
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+
+	apiKey, err := h.userUseCase.CreateAPIKey(userID, createRequest.Name, createRequest.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidAPIKeyExpiry) {
+			response.BadRequest(c, err)
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	// A chave completa é exibida somente nesta resposta
+	response.Success(c, http.StatusCreated, apiKey)
+}
+
+func (h *UserHandler) ListAPIKeys(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+
+	apiKeys, err := h.userUseCase.ListAPIKeys(userID)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, apiKeys)
+}
+
+func (h *UserHandler) RevokeAPIKey(c *gin.Context) {
+	keyID, err := strconv.ParseUint(c.Param("keyId"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+
+	if err := h.userUseCase.RevokeAPIKey(userID, keyID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(c, err)
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.NoContent(c)
+}
@@ -2,9 +2,12 @@ package http
 
 import (
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/middleware"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
 )
@@ -33,19 +36,109 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := h.userUseCase.AuthenticateUser(loginRequest.Email, loginRequest.Password)
+	tokens, err := h.userUseCase.AuthenticateUser(loginRequest.Email, loginRequest.Password, c.ClientIP())
 	if err != nil {
-		response.StatusUnauthorized(c)
+		if respondLoginThrottled(c, err) || respondAccountStatus(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, usecase.ErrInvalidCredentials):
+			response.StatusUnauthorized(c)
+		case errors.Is(err, usecase.ErrEmailNotVerified):
+			response.Error(c, http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			// Falhas de infraestrutura (ex.: banco de dados indisponível) não são erros de credencial
+			response.InternalServerError(c, err)
+		}
+		return
+	}
+
+	response.Success(c, http.StatusOK, tokens)
+
+}
+
+func (h *AuthHandler) RefreshToken(c *gin.Context) {
+	var refreshRequest struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+
+	if err := c.ShouldBindJSON(&refreshRequest); err != nil {
+		response.BadRequest(c, err)
 		return
 	}
 
-	if token == "" {
+	if refreshRequest.RefreshToken == "" {
+		response.BadRequest(c, errors.New("refreshToken is required"))
+		return
+	}
+
+	tokens, err := h.userUseCase.RefreshTokens(refreshRequest.RefreshToken)
+	if err != nil {
+		if respondAccountStatus(c, err) {
+			return
+		}
+		if errors.Is(err, usecase.ErrInvalidRefreshToken) || errors.Is(err, usecase.ErrRefreshTokenReused) {
+			response.Error(c, http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, tokens)
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var logoutRequest struct {
+		RefreshToken string `json:"refreshToken"`
+		AllSessions  bool   `json:"allSessions"`
+	}
+
+	// O corpo é opcional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&logoutRequest); err != nil {
+			response.BadRequest(c, err)
+			return
+		}
+	}
+
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
 		response.StatusUnauthorized(c)
 		return
 	}
 
-	response.Success(c, http.StatusOK, gin.H{
-		"token": token,
-	})
+	if err := h.userUseCase.Logout(principal, logoutRequest.RefreshToken, logoutRequest.AllSessions); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.NoContent(c)
+}
+
+// Responde 423 para contas bloqueadas e 429 para tentativas em excesso, informando o Retry-After em segundos
+func respondLoginThrottled(c *gin.Context, err error) bool {
+	var retryErr *usecase.RetryAfterError
+	if !errors.As(err, &retryErr) {
+		return false
+	}
+
+	status := http.StatusTooManyRequests
+	if errors.Is(err, usecase.ErrAccountLocked) {
+		status = http.StatusLocked
+	}
+
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryErr.RetryAfter.Seconds()))))
+	response.Error(c, status, gin.H{"error": err.Error()})
+	return true
+}
+
+// Responde 403 para contas suspensas ou desativadas
+func respondAccountStatus(c *gin.Context, err error) bool {
+	if !errors.Is(err, usecase.ErrUserSuspended) && !errors.Is(err, usecase.ErrUserDisabled) {
+		return false
+	}
 
+	response.Error(c, http.StatusForbidden, gin.H{"error": err.Error()})
+	return true
 }
@@ -0,0 +1,57 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+func (h *UserHandler) RestoreUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	user, err := h.userUseCase.RestoreUser(id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(c, err)
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, mapUserToResponse(user))
+}
+
+func (h *UserHandler) GetDeletedUsers(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		response.BadRequest(c, errors.New("page must be a positive integer"))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "100"))
+	if err != nil || pageSize < 1 {
+		response.BadRequest(c, errors.New("pageSize must be a positive integer"))
+		return
+	}
+
+	users, err := h.userUseCase.GetDeletedUsers(page, pageSize)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	responseUsers := make([]*UserResponse, 0, len(users))
+	for _, user := range users {
+		responseUsers = append(responseUsers, mapUserToResponse(user))
+	}
+
+	response.Success(c, http.StatusOK, responseUsers)
+}
@@ -0,0 +1,82 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		response.BadRequest(c, errors.New("token is required"))
+		return
+	}
+
+	if err := h.userUseCase.VerifyEmail(token); err != nil {
+		if errors.Is(err, usecase.ErrInvalidVerificationToken) {
+			response.BadRequest(c, err)
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{
+		"message": "E-mail confirmado com sucesso",
+	})
+}
+
+// Confirma a troca de e-mail a partir do link enviado ao novo endereço
+func (h *AuthHandler) ConfirmEmailChange(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		response.BadRequest(c, errors.New("token is required"))
+		return
+	}
+
+	if err := h.userUseCase.ConfirmEmailChange(token); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidVerificationToken):
+			response.BadRequest(c, err)
+		case errors.Is(err, usecase.ErrEmailTaken):
+			response.Error(c, http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			response.InternalServerError(c, err)
+		}
+		return
+	}
+
+	response.Success(c, http.StatusOK, gin.H{
+		"message": "E-mail alterado com sucesso",
+	})
+}
+
+func (h *AuthHandler) ResendVerificationEmail(c *gin.Context) {
+	var resendRequest struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&resendRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if resendRequest.Email == "" {
+		response.BadRequest(c, errors.New("email is required"))
+		return
+	}
+
+	if err := h.userUseCase.ResendVerificationEmail(resendRequest.Email); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	// A resposta é a mesma para e-mails cadastrados ou não
+	response.Success(c, http.StatusAccepted, gin.H{
+		"message": "Se o e-mail estiver cadastrado e pendente de confirmação, um novo link será enviado",
+	})
+}
@@ -0,0 +1,88 @@
+package http
+
+import (
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+// ETag forte do usuário. Além da versão gravada no banco, inclui os campos calculados na leitura, a idade e a
+// situação vigente, que mudam com o tempo sem que o registro seja alterado
+func userETag(user *entity.User) string {
+	return `"` + userValidator(user) + `"`
+}
+
+func userValidator(user *entity.User) string {
+	// Sem data de nascimento válida a idade não é calculada e fica zerada na resposta
+	age, _ := utils.CalculateAge(user.BirthDate)
+	return fmt.Sprintf("%d-%d-%s", user.Version, age, user.EffectiveStatus(time.Now()))
+}
+
+// Com fields a representação é parcial: o conjunto de campos entra no ETag para que projeções diferentes
+// não compartilhem o mesmo validador. Somente o ETag da representação completa é aceito em If-Match
+func userFieldsETag(user *entity.User, fields []string) string {
+	if len(fields) == 0 {
+		return userETag(user)
+	}
+
+	sorted := append([]string(nil), fields...)
+	sort.Strings(sorted)
+	hash := fnv.New32a()
+	hash.Write([]byte(strings.Join(sorted, ",")))
+	return fmt.Sprintf(`"%s-%08x"`, userValidator(user), hash.Sum32())
+}
+
+// If-Match usa a comparação forte e If-None-Match, a fraca, em que o prefixo W/ é ignorado (RFC 9110, seção 8.8.3.2)
+func etagMatches(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.HasPrefix(candidate, "W/") {
+			if !weak {
+				continue
+			}
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// Sem If-Match a alteração prossegue. Caso contrário, responde 412 e retorna false se o ETag não for o da versão atual
+func checkIfMatch(c *gin.Context, user *entity.User) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" || etagMatches(ifMatch, userETag(user), false) {
+		return true
+	}
+
+	respondPreconditionFailed(c)
+	return false
+}
+
+// As alterações de usuários, inclusive em /users/me, exigem If-Match, para que uma edição feita sobre uma leitura
+// antiga não sobrescreva outra sem perceber. Sem o cabeçalho, responde 428 e retorna false
+func requireIfMatch(c *gin.Context) bool {
+	if c.GetHeader("If-Match") != "" {
+		return true
+	}
+
+	response.Error(c, http.StatusPreconditionRequired, gin.H{"error": "If-Match header is required"})
+	return false
+}
+
+func respondPreconditionFailed(c *gin.Context) {
+	response.Error(c, http.StatusPreconditionFailed, gin.H{"error": repository.ErrVersionConflict.Error()})
+}
@@ -0,0 +1,236 @@
+package http
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+// Content-Type de cada formato de exportação
+var exportContentTypes = map[string]string{
+	"csv":    "text/csv; charset=utf-8",
+	"ndjson": "application/x-ndjson",
+	"xlsx":   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Campos carregados do banco para a exportação. A senha e o segredo de dois fatores nunca são lidos
+var exportFields = []string{"id", "name", "email", "birthDate", "profile", "status", "emailVerified", "twoFactorEnabled", "address", "createdAt"}
+
+// Colunas do CSV e do XLSX; o endereço é dividido em colunas, como na importação
+var exportColumns = []string{"id", "name", "email", "birthDate", "age", "profile", "status", "emailVerified", "twoFactorEnabled", "street", "city", "state", "country", "createdAt"}
+
+type exportedUser struct {
+	ID               uint64          `json:"id"`
+	Name             string          `json:"name"`
+	Email            string          `json:"email"`
+	BirthDate        string          `json:"birthDate"`
+	Age              int             `json:"age"`
+	Profile          string          `json:"profile"`
+	Status           string          `json:"status"`
+	EmailVerified    bool            `json:"emailVerified"`
+	TwoFactorEnabled bool            `json:"twoFactorEnabled"`
+	Address          *entity.Address `json:"address,omitempty"`
+	CreatedAt        time.Time       `json:"createdAt"`
+}
+
+func newExportedUser(user *entity.User) *exportedUser {
+	// Datas de nascimento inválidas não interrompem a exportação: a idade fica zerada
+	age, _ := utils.CalculateAge(user.BirthDate)
+	return &exportedUser{
+		ID:               user.ID,
+		Name:             user.Name,
+		Email:            user.Email,
+		BirthDate:        user.BirthDate,
+		Age:              age,
+		Profile:          user.Profile,
+		Status:           userStatus(user),
+		EmailVerified:    user.EmailVerified,
+		TwoFactorEnabled: user.TwoFactorEnabled,
+		Address:          user.Address,
+		CreatedAt:        user.CreatedAt,
+	}
+}
+
+// Valores na ordem de exportColumns
+func (u *exportedUser) values() []interface{} {
+	address := entity.Address{}
+	if u.Address != nil {
+		address = *u.Address
+	}
+	return []interface{}{
+		u.ID, u.Name, u.Email, u.BirthDate, u.Age, u.Profile, u.Status, u.EmailVerified, u.TwoFactorEnabled,
+		address.Street, address.City, address.State, address.Country, u.CreatedAt.UTC().Format(time.RFC3339),
+	}
+}
+
+type userExportWriter interface {
+	Write(user *exportedUser) error
+	Close() error
+}
+
+func newUserExportWriter(format string, w io.Writer) (userExportWriter, error) {
+	switch format {
+	case "ndjson":
+		return &ndjsonExportWriter{encoder: json.NewEncoder(w)}, nil
+	case "xlsx":
+		writer, err := newXLSXWriter(w, exportColumns)
+		if err != nil {
+			return nil, err
+		}
+		return &xlsxExportWriter{writer: writer}, nil
+	default:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(exportColumns); err != nil {
+			return nil, err
+		}
+		return &csvExportWriter{writer: writer}, nil
+	}
+}
+
+type csvExportWriter struct {
+	writer *csv.Writer
+}
+
+func (w *csvExportWriter) Write(user *exportedUser) error {
+	values := user.values()
+	record := make([]string, len(values))
+	for i, value := range values {
+		if text, ok := value.(string); ok {
+			record[i] = neutralizeCSVFormula(text)
+		} else {
+			record[i] = fmt.Sprint(value)
+		}
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvExportWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// Planilhas interpretam como fórmula o texto que começa com estes caracteres; o apóstrofo faz o valor ser lido como texto
+func neutralizeCSVFormula(value string) string {
+	if value != "" && strings.ContainsAny(value[:1], "=+-@\t\r") {
+		return "'" + value
+	}
+	return value
+}
+
+type ndjsonExportWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonExportWriter) Write(user *exportedUser) error {
+	return w.encoder.Encode(user)
+}
+
+func (w *ndjsonExportWriter) Close() error {
+	return nil
+}
+
+type xlsxExportWriter struct {
+	writer *xlsxWriter
+}
+
+func (w *xlsxExportWriter) Write(user *exportedUser) error {
+	return w.writer.WriteRow(user.values())
+}
+
+func (w *xlsxExportWriter) Close() error {
+	return w.writer.Close()
+}
+
+// Exporta os usuários que atendem aos mesmos filtros da listagem. O arquivo é enviado à medida que os lotes são lidos do banco
+func (h *UserHandler) ExportUsers(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		response.BadRequest(c, errors.New("format must be csv, ndjson or xlsx"))
+		return
+	}
+
+	filter, err := parseUserFilter(c)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+	filter.Fields = exportFields
+
+	// A resposta só é iniciada com o primeiro lote, para que os erros anteriores ainda sejam respondidos em JSON
+	var writer userExportWriter
+	start := func() error {
+		c.Header("Content-Type", contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users-%s.%s"`, time.Now().Format("20060102"), format))
+		c.Status(http.StatusOK)
+
+		var err error
+		writer, err = newUserExportWriter(format, c.Writer)
+		return err
+	}
+
+	err = h.userUseCase.ExportUsers(filter, func(users []*entity.User) error {
+		if writer == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		for _, user := range users {
+			if err := writer.Write(newExportedUser(user)); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err == nil && writer == nil {
+		// Nenhum usuário atende aos filtros: o arquivo contém somente o cabeçalho
+		err = start()
+	}
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil {
+		if c.Writer.Written() {
+			abortExport(c, err)
+			return
+		}
+		switch {
+		case errors.Is(err, repository.ErrInvalidSort), errors.Is(err, usecase.ErrInvalidFilter):
+			response.BadRequest(c, err)
+		default:
+			response.InternalServerError(c, err)
+		}
+	}
+}
+
+// Com o arquivo já em andamento não há como responder o erro: a conexão é encerrada para que o cliente
+// não receba um arquivo incompleto como se estivesse completo
+func abortExport(c *gin.Context, err error) {
+	log.Printf("Falha ao exportar usuários: %v", err)
+
+	// Somente conexões HTTP/1.x podem ser assumidas; nas demais o arquivo termina incompleto
+	unwrapper, ok := c.Writer.(interface{ Unwrap() http.ResponseWriter })
+	if !ok {
+		return
+	}
+	if hijacker, ok := unwrapper.Unwrap().(http.Hijacker); ok {
+		if conn, _, err := hijacker.Hijack(); err == nil {
+			conn.Close()
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package http
 
 import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/middleware"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
 )
@@ -16,23 +20,74 @@ func NewUserHandler(userUseCase usecase.UserUseCase) *UserHandler {
 }
 
 type UserResponse struct {
-	ID        uint64          `json:"id"`
-	Name      string          `json:"name"`
-	Email     string          `json:"email"`
-	BirthDate string          `json:"birthDate"`
-	Age       int             `json:"age"`
-	Profile   string          `json:"profile"`
-	Address   *entity.Address `json:"address"`
+	ID             uint64          `json:"id"`
+	Name           string          `json:"name"`
+	Email          string          `json:"email"`
+	BirthDate      string          `json:"birthDate"`
+	Age            int             `json:"age"`
+	Profile        string          `json:"profile"`
+	Address        *entity.Address `json:"address"`
+	EmailVerified  bool            `json:"emailVerified"`
+	PendingEmail   string          `json:"pendingEmail,omitempty"`
+	TwoFactor      bool            `json:"twoFactorEnabled"`
+	Status         string          `json:"status,omitempty"`
+	StatusReason   string          `json:"statusReason,omitempty"`
+	SuspendedUntil *time.Time      `json:"suspendedUntil,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeletedAt      *time.Time      `json:"deletedAt,omitempty"`
+}
+
+// Envelope da listagem paginada de usuários
+type UserListResponse struct {
+	Data       []interface{} `json:"data"`
+	Total      int64         `json:"total"`
+	Page       int           `json:"page,omitempty"`
+	PageSize   int           `json:"pageSize"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+	PrevCursor string        `json:"prevCursor,omitempty"`
 }
 
 func mapUserToResponse(user *entity.User) *UserResponse {
 	return &UserResponse{
-		ID:        user.ID,
-		Name:      user.Name,
-		Email:     user.Email,
-		BirthDate: user.BirthDate,
-		Age:       user.Age,
-		Profile:   user.Profile,
-		Address:   user.Address,
+		ID:             user.ID,
+		Name:           user.Name,
+		Email:          user.Email,
+		BirthDate:      user.BirthDate,
+		Age:            user.Age,
+		Profile:        user.Profile,
+		Address:        user.Address,
+		EmailVerified:  user.EmailVerified,
+		PendingEmail:   user.PendingEmail,
+		TwoFactor:      user.TwoFactorEnabled,
+		Status:         userStatus(user),
+		StatusReason:   user.StatusReason,
+		SuspendedUntil: user.SuspendedUntil,
+		CreatedAt:      user.CreatedAt,
+		DeletedAt:      deletedAt(user),
+	}
+}
+
+// Situação vigente: uma suspensão cujo prazo terminou aparece como ativa, mesmo antes de o registro ser atualizado.
+// Usuários lidos sem a coluna status, por uma projeção com fields, continuam sem situação
+func userStatus(user *entity.User) string {
+	if user.Status == "" {
+		return ""
+	}
+	return user.EffectiveStatus(time.Now())
+}
+
+func deletedAt(user *entity.User) *time.Time {
+	if !user.DeletedAt.Valid {
+		return nil
+	}
+	return &user.DeletedAt.Time
+}
+
+// Retorna o ID do usuário autenticado pelo AuthMiddleware. Tokens de clientes OAuth não representam um usuário
+func currentUserID(c *gin.Context) (uint64, bool) {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok || principal.ClientID != "" {
+		return 0, false
 	}
+	return principal.UserID, true
 }
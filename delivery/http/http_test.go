@@ -1,55 +1,285 @@
 package http
 
 import (
+	"archive/zip"
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/security"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
 	"github.com/stretchr/testify/assert"
 )
 
 type mockUserUseCase struct {
-	CreateUserFunc       func(user *usecase.CreateUserData) (*entity.User, error)
-	GetUserByIDFunc      func(id uint64) (*entity.User, error)
-	GetAllUsersFunc      func(page, pageSize int) ([]*entity.User, error)
-	UpdateUserFunc       func(user *entity.User) error
-	DeleteUserFunc       func(id uint64) error
-	CheckEmailExistsFunc func(email string) (bool, error)
-	AuthenticateUserFunc func(email, password string) (string, error)
+	CreateUserFunc              func(user *usecase.CreateUserData) (*entity.User, error)
+	CreateUserWithProfileFunc   func(user *usecase.CreateUserData, profile string) (*entity.User, error)
+	ImportUsersFunc             func(rows []usecase.ImportUserData, dryRun bool) (*usecase.ImportReport, error)
+	ChangeUserProfileFunc       func(id uint64, profile string) (*entity.User, error)
+	ChangeUserStatusFunc        func(id uint64, status, reason string, suspendedUntil *time.Time) (*entity.User, error)
+	GetUserByIDFunc             func(id uint64) (*entity.User, error)
+	GetUserByIDWithFieldsFunc   func(id uint64, fields []string) (*entity.User, error)
+	GetAllUsersFunc             func(filter *repository.UserFilter, pagination usecase.Pagination) (*usecase.UserPage, error)
+	ExportUsersFunc             func(filter *repository.UserFilter, process func(users []*entity.User) error) error
+	UpdateUserFunc              func(user *entity.User) error
+	DeleteUserFunc              func(id, version uint64) error
+	RestoreUserFunc             func(id uint64) (*entity.User, error)
+	GetDeletedUsersFunc         func(page, pageSize int) ([]*entity.User, error)
+	PurgeDeletedUsersFunc       func() (int64, error)
+	PurgeLoginAttemptsFunc      func() (int64, error)
+	CheckEmailExistsFunc        func(email string) (bool, error)
+	AuthorizeUserWriteFunc      func(actor *usecase.Principal, userID uint64) error
+	AuthenticateUserFunc        func(email, password, clientIP string) (*usecase.AuthTokens, error)
+	RefreshTokensFunc           func(refreshToken string) (*usecase.AuthTokens, error)
+	ValidateAccessTokenFunc     func(tokenString string) (*usecase.Principal, error)
+	LogoutFunc                  func(principal *usecase.Principal, refreshToken string, allSessions bool) error
+	RequestPasswordResetFunc    func(email string) error
+	ResetPasswordFunc           func(token, newPassword string) error
+	ChangePasswordFunc          func(userID uint64, currentPassword, newPassword string) (*usecase.AuthTokens, error)
+	VerifyEmailFunc             func(token string) error
+	ResendVerificationEmailFunc func(email string) error
+	ConfirmEmailChangeFunc      func(token string) error
+	CompleteTwoFactorLoginFunc  func(challengeToken, code, clientIP string) (*usecase.AuthTokens, error)
+	SetupTwoFactorFunc          func(userID uint64) (*usecase.TwoFactorSetup, error)
+	ConfirmTwoFactorFunc        func(userID uint64, code string) ([]string, error)
+	DisableTwoFactorFunc        func(userID uint64, code, clientIP string) error
+	UnlockUserFunc              func(id uint64) error
+	CreateAPIKeyFunc            func(userID uint64, name string, expiresAt *time.Time) (*usecase.CreatedAPIKey, error)
+	ListAPIKeysFunc             func(userID uint64) ([]*entity.APIKey, error)
+	RevokeAPIKeyFunc            func(userID, keyID uint64) error
+	ValidateAPIKeyFunc          func(key string) (*usecase.Principal, error)
+	ImpersonateUserFunc         func(actor *usecase.Principal, userID uint64, reason, clientIP string) (*usecase.AuthTokens, error)
+	ListImpersonationsFunc      func(page, pageSize int) ([]*entity.ImpersonationSession, error)
+}
+
+type mockOAuthClientUseCase struct {
+	RegisterClientFunc   func(name string, scopes []string) (*usecase.RegisteredOAuthClient, error)
+	ListClientsFunc      func() ([]*entity.OAuthClient, error)
+	RevokeClientFunc     func(id uint64) error
+	IssueClientTokenFunc func(clientID, clientSecret string, scopes []string) (*usecase.ClientToken, error)
+}
+
+func (m *mockOAuthClientUseCase) RegisterClient(name string, scopes []string) (*usecase.RegisteredOAuthClient, error) {
+	return m.RegisterClientFunc(name, scopes)
+}
+
+func (m *mockOAuthClientUseCase) ListClients() ([]*entity.OAuthClient, error) {
+	return m.ListClientsFunc()
+}
+
+func (m *mockOAuthClientUseCase) RevokeClient(id uint64) error {
+	return m.RevokeClientFunc(id)
+}
+
+func (m *mockOAuthClientUseCase) IssueClientToken(clientID, clientSecret string, scopes []string) (*usecase.ClientToken, error) {
+	return m.IssueClientTokenFunc(clientID, clientSecret, scopes)
+}
+
+type mockRoleUseCase struct {
+	ListRolesFunc       func() ([]*entity.Role, error)
+	ListPermissionsFunc func() ([]entity.Permission, error)
+	CreateRoleFunc      func(name, description string, permissions []string) (*entity.Role, error)
+	UpdateRoleFunc      func(id uint64, description string, permissions []string) (*entity.Role, error)
+	DeleteRoleFunc      func(id uint64) error
+	GetUserRolesFunc    func(userID uint64) ([]*entity.Role, error)
+	AssignRoleFunc      func(userID, roleID uint64) error
+	RemoveRoleFunc      func(userID, roleID uint64) error
+}
+
+func (m *mockRoleUseCase) ListRoles() ([]*entity.Role, error) {
+	return m.ListRolesFunc()
+}
+
+func (m *mockRoleUseCase) ListPermissions() ([]entity.Permission, error) {
+	return m.ListPermissionsFunc()
+}
+
+func (m *mockRoleUseCase) CreateRole(name, description string, permissions []string) (*entity.Role, error) {
+	return m.CreateRoleFunc(name, description, permissions)
+}
+
+func (m *mockRoleUseCase) UpdateRole(id uint64, description string, permissions []string) (*entity.Role, error) {
+	return m.UpdateRoleFunc(id, description, permissions)
+}
+
+func (m *mockRoleUseCase) DeleteRole(id uint64) error {
+	return m.DeleteRoleFunc(id)
+}
+
+func (m *mockRoleUseCase) GetUserRoles(userID uint64) ([]*entity.Role, error) {
+	return m.GetUserRolesFunc(userID)
+}
+
+func (m *mockRoleUseCase) AssignRole(userID, roleID uint64) error {
+	return m.AssignRoleFunc(userID, roleID)
+}
+
+func (m *mockRoleUseCase) RemoveRole(userID, roleID uint64) error {
+	return m.RemoveRoleFunc(userID, roleID)
 }
 
 func (m *mockUserUseCase) CreateUser(user *usecase.CreateUserData) (*entity.User, error) {
 	return m.CreateUserFunc(user)
 }
 
+func (m *mockUserUseCase) CreateUserWithProfile(user *usecase.CreateUserData, profile string) (*entity.User, error) {
+	return m.CreateUserWithProfileFunc(user, profile)
+}
+
+func (m *mockUserUseCase) ChangeUserProfile(id uint64, profile string) (*entity.User, error) {
+	return m.ChangeUserProfileFunc(id, profile)
+}
+
+func (m *mockUserUseCase) ChangeUserStatus(id uint64, status, reason string, suspendedUntil *time.Time) (*entity.User, error) {
+	return m.ChangeUserStatusFunc(id, status, reason, suspendedUntil)
+}
+
 func (m *mockUserUseCase) GetUserByID(id uint64) (*entity.User, error) {
 	return m.GetUserByIDFunc(id)
 }
 
-func (m *mockUserUseCase) GetAllUsers(page, pageSize int) ([]*entity.User, error) {
-	return m.GetAllUsersFunc(page, pageSize)
+func (m *mockUserUseCase) GetAllUsers(filter *repository.UserFilter, pagination usecase.Pagination) (*usecase.UserPage, error) {
+	return m.GetAllUsersFunc(filter, pagination)
+}
+
+func (m *mockUserUseCase) ExportUsers(filter *repository.UserFilter, process func(users []*entity.User) error) error {
+	return m.ExportUsersFunc(filter, process)
 }
 
 func (m *mockUserUseCase) UpdateUser(user *entity.User) error {
 	return m.UpdateUserFunc(user)
 }
 
-func (m *mockUserUseCase) DeleteUser(id uint64) error {
-	return m.DeleteUserFunc(id)
+func (m *mockUserUseCase) DeleteUser(id, version uint64) error {
+	return m.DeleteUserFunc(id, version)
 }
 
 func (m *mockUserUseCase) CheckEmailExists(email string) (bool, error) {
 	return m.CheckEmailExistsFunc(email)
 }
 
-func (m *mockUserUseCase) AuthenticateUser(email, password string) (string, error) {
-	return m.AuthenticateUserFunc(email, password)
+func (m *mockUserUseCase) AuthorizeUserWrite(actor *usecase.Principal, userID uint64) error {
+	return m.AuthorizeUserWriteFunc(actor, userID)
+}
+
+func (m *mockUserUseCase) AuthenticateUser(email, password, clientIP string) (*usecase.AuthTokens, error) {
+	return m.AuthenticateUserFunc(email, password, clientIP)
+}
+
+func (m *mockUserUseCase) RefreshTokens(refreshToken string) (*usecase.AuthTokens, error) {
+	return m.RefreshTokensFunc(refreshToken)
+}
+
+func (m *mockUserUseCase) ValidateAccessToken(tokenString string) (*usecase.Principal, error) {
+	return m.ValidateAccessTokenFunc(tokenString)
+}
+
+func (m *mockUserUseCase) Logout(principal *usecase.Principal, refreshToken string, allSessions bool) error {
+	return m.LogoutFunc(principal, refreshToken, allSessions)
+}
+
+func (m *mockUserUseCase) RequestPasswordReset(email string) error {
+	return m.RequestPasswordResetFunc(email)
+}
+
+func (m *mockUserUseCase) ResetPassword(token, newPassword string) error {
+	return m.ResetPasswordFunc(token, newPassword)
+}
+
+func (m *mockUserUseCase) ChangePassword(userID uint64, currentPassword, newPassword string) (*usecase.AuthTokens, error) {
+	return m.ChangePasswordFunc(userID, currentPassword, newPassword)
+}
+
+func (m *mockUserUseCase) VerifyEmail(token string) error {
+	return m.VerifyEmailFunc(token)
+}
+
+func (m *mockUserUseCase) ConfirmEmailChange(token string) error {
+	return m.ConfirmEmailChangeFunc(token)
+}
+
+func (m *mockUserUseCase) ResendVerificationEmail(email string) error {
+	return m.ResendVerificationEmailFunc(email)
+}
+
+func (m *mockUserUseCase) CompleteTwoFactorLogin(challengeToken, code, clientIP string) (*usecase.AuthTokens, error) {
+	return m.CompleteTwoFactorLoginFunc(challengeToken, code, clientIP)
+}
+
+func (m *mockUserUseCase) SetupTwoFactor(userID uint64) (*usecase.TwoFactorSetup, error) {
+	return m.SetupTwoFactorFunc(userID)
+}
+
+func (m *mockUserUseCase) ConfirmTwoFactor(userID uint64, code string) ([]string, error) {
+	return m.ConfirmTwoFactorFunc(userID, code)
+}
+
+func (m *mockUserUseCase) DisableTwoFactor(userID uint64, code, clientIP string) error {
+	return m.DisableTwoFactorFunc(userID, code, clientIP)
+}
+
+func (m *mockUserUseCase) UnlockUser(id uint64) error {
+	return m.UnlockUserFunc(id)
+}
+
+func (m *mockUserUseCase) CreateAPIKey(userID uint64, name string, expiresAt *time.Time) (*usecase.CreatedAPIKey, error) {
+	return m.CreateAPIKeyFunc(userID, name, expiresAt)
+}
+
+func (m *mockUserUseCase) ListAPIKeys(userID uint64) ([]*entity.APIKey, error) {
+	return m.ListAPIKeysFunc(userID)
+}
+
+func (m *mockUserUseCase) RevokeAPIKey(userID, keyID uint64) error {
+	return m.RevokeAPIKeyFunc(userID, keyID)
+}
+
+func (m *mockUserUseCase) ValidateAPIKey(key string) (*usecase.Principal, error) {
+	return m.ValidateAPIKeyFunc(key)
+}
+
+func (m *mockUserUseCase) ImpersonateUser(actor *usecase.Principal, userID uint64, reason, clientIP string) (*usecase.AuthTokens, error) {
+	return m.ImpersonateUserFunc(actor, userID, reason, clientIP)
+}
+
+func (m *mockUserUseCase) ListImpersonationSessions(page, pageSize int) ([]*entity.ImpersonationSession, error) {
+	return m.ListImpersonationsFunc(page, pageSize)
+}
+
+func (m *mockUserUseCase) GetUserByIDWithFields(id uint64, fields []string) (*entity.User, error) {
+	return m.GetUserByIDWithFieldsFunc(id, fields)
+}
+
+func (m *mockUserUseCase) ImportUsers(rows []usecase.ImportUserData, dryRun bool) (*usecase.ImportReport, error) {
+	return m.ImportUsersFunc(rows, dryRun)
+}
+
+func (m *mockUserUseCase) RestoreUser(id uint64) (*entity.User, error) {
+	return m.RestoreUserFunc(id)
+}
+
+func (m *mockUserUseCase) GetDeletedUsers(page, pageSize int) ([]*entity.User, error) {
+	return m.GetDeletedUsersFunc(page, pageSize)
+}
+
+func (m *mockUserUseCase) PurgeDeletedUsers() (int64, error) {
+	return m.PurgeDeletedUsersFunc()
+}
+
+func (m *mockUserUseCase) PurgeLoginAttempts() (int64, error) {
+	return m.PurgeLoginAttemptsFunc()
 }
 
 func TestUserHandler_CreateUser(t *testing.T) {
@@ -112,6 +342,15 @@ func TestUserHandler_CreateUser(t *testing.T) {
 	var responseUser UserResponse
 	_ = json.Unmarshal(w.Body.Bytes(), &responseUser)
 	assert.Equal(t, expectedResponse, responseUser)
+
+	// An email registered by a concurrent request is a conflict, not a server error
+	mock.CreateUserFunc = func(user *usecase.CreateUserData) (*entity.User, error) {
+		return nil, usecase.ErrEmailTaken
+	}
+	req, _ = http.NewRequest("POST", "/api/v1/users", bytes.NewReader(body))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
 }
 
 func TestUserHandler_GetUserByID(t *testing.T) {
@@ -172,9 +411,9 @@ func TestUserHandler_GetUserByID(t *testing.T) {
 func TestUserHandler_GetAllUsers(t *testing.T) {
 	// Mock UserUseCase
 	mock := &mockUserUseCase{
-		GetAllUsersFunc: func(page, pageSize int) ([]*entity.User, error) {
-			if page == 1 && pageSize == 10 {
-				return []*entity.User{
+		GetAllUsersFunc: func(filter *repository.UserFilter, pagination usecase.Pagination) (*usecase.UserPage, error) {
+			if pagination.Page == 1 && pagination.PageSize == 10 {
+				return &usecase.UserPage{Page: 1, PageSize: 10, Total: 2, Users: []*entity.User{
 					{
 						ID:        1,
 						Name:      "John Doe",
@@ -193,7 +432,7 @@ func TestUserHandler_GetAllUsers(t *testing.T) {
 						Profile:   "",
 						Address:   nil,
 					},
-				}, nil
+				}}, nil
 			}
 			return nil, errors.New("failed to retrievedata")
 		},
@@ -241,14 +480,175 @@ func TestUserHandler_GetAllUsers(t *testing.T) {
 			Address:   nil,
 		},
 	}
-	var responseUsers []UserResponse
+	var responseUsers struct {
+		Data []UserResponse `json:"data"`
+	}
 	_ = json.Unmarshal(w.Body.Bytes(), &responseUsers)
-	assert.Equal(t, expectedResponse, responseUsers)
+	assert.Equal(t, expectedResponse, responseUsers.Data)
+}
+
+func TestUserHandler_GetAllUsers_Filters(t *testing.T) {
+	var received *repository.UserFilter
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		GetAllUsersFunc: func(filter *repository.UserFilter, pagination usecase.Pagination) (*usecase.UserPage, error) {
+			received = filter
+			for _, sort := range filter.Sort {
+				if sort.Field == "password" {
+					return nil, repository.ErrInvalidSort
+				}
+			}
+			return &usecase.UserPage{Page: 1, PageSize: 100}, nil
+		},
+	}
+
+	handler := NewUserHandler(mock)
+	router := gin.Default()
+	router.GET("/api/v1/users", handler.GetAllUsers)
+
+	request := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/v1/users?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("q=john&profile=user&minAge=18&maxAge=30&city=Sao%20Paulo&createdFrom=2026-01-01&createdTo=2026-02-01T00:00:00Z&sort=-createdAt,name")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "john", received.Search)
+	assert.Equal(t, "user", received.Profile)
+	assert.Equal(t, 18, *received.MinAge)
+	assert.Equal(t, 30, *received.MaxAge)
+	assert.Equal(t, "Sao Paulo", received.City)
+	assert.Equal(t, time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), *received.CreatedFrom)
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), *received.CreatedTo)
+	assert.Equal(t, []repository.UserSort{{Field: "createdAt", Desc: true}, {Field: "name"}}, received.Sort)
+
+	assert.Equal(t, http.StatusBadRequest, request("minAge=-1").Code)
+	assert.Equal(t, http.StatusBadRequest, request("createdFrom=yesterday").Code)
+	assert.Equal(t, http.StatusBadRequest, request("sort=name,,email").Code)
+	assert.Equal(t, http.StatusBadRequest, request("sort=password").Code)
+}
+
+func TestUserHandler_GetAllUsers_Pagination(t *testing.T) {
+	var received usecase.Pagination
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		GetAllUsersFunc: func(filter *repository.UserFilter, pagination usecase.Pagination) (*usecase.UserPage, error) {
+			received = pagination
+			if pagination.Cursor == "bad" {
+				return nil, usecase.ErrInvalidCursor
+			}
+			page := &usecase.UserPage{
+				Users:    []*entity.User{{ID: 3, Name: "John Doe", BirthDate: "1990-01-01"}},
+				Total:    25,
+				Page:     pagination.Page,
+				PageSize: pagination.PageSize,
+			}
+			if pagination.UseCursor {
+				page.Page = 0
+				page.NextCursor, page.PrevCursor = "next123", "prev123"
+			}
+			return page, nil
+		},
+	}
+
+	handler := NewUserHandler(mock)
+	router := gin.Default()
+	router.GET("/api/v1/users", handler.GetAllUsers)
+
+	request := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/v1/users?"+query, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Page mode keeps working for old clients, now wrapped in an envelope
+	w := request("page=2&pageSize=10&profile=user")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, received.UseCursor)
+	var body UserListResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Equal(t, int64(25), body.Total)
+	assert.Equal(t, 2, body.Page)
+	assert.Len(t, body.Data, 1)
+	links := w.Header().Get("Link")
+	assert.Contains(t, links, `</api/v1/users?page=1&pageSize=10&profile=user>; rel="first"`)
+	assert.Contains(t, links, `</api/v1/users?page=1&pageSize=10&profile=user>; rel="prev"`)
+	assert.Contains(t, links, `</api/v1/users?page=3&pageSize=10&profile=user>; rel="next"`)
+	assert.Contains(t, links, `</api/v1/users?page=3&pageSize=10&profile=user>; rel="last"`)
+
+	w = request("page=3&pageSize=10")
+	assert.NotContains(t, w.Header().Get("Link"), `rel="next"`)
+
+	// Cursor mode
+	w = request("cursor=&pageSize=10")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, received.UseCursor)
+	assert.Contains(t, w.Body.String(), `"nextCursor":"next123"`)
+	assert.Contains(t, w.Header().Get("Link"), `</api/v1/users?cursor=next123&pageSize=10>; rel="next"`)
+	assert.Contains(t, w.Header().Get("Link"), `</api/v1/users?cursor=prev123&pageSize=10>; rel="prev"`)
+
+	assert.Equal(t, http.StatusBadRequest, request("cursor=bad").Code)
+}
+
+func TestUserHandler_SparseFields(t *testing.T) {
+	var requestedFields []string
+	user := &entity.User{ID: 1, Name: "John Doe", BirthDate: "1990-01-01"}
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		GetUserByIDWithFieldsFunc: func(id uint64, fields []string) (*entity.User, error) {
+			requestedFields = fields
+			return user, nil
+		},
+		GetAllUsersFunc: func(filter *repository.UserFilter, pagination usecase.Pagination) (*usecase.UserPage, error) {
+			requestedFields = filter.Fields
+			return &usecase.UserPage{Users: []*entity.User{{ID: 2, Name: "Jane Smith"}}, Total: 1, Page: 1, PageSize: 100}, nil
+		},
+	}
+
+	handler := NewUserHandler(mock)
+	router := gin.Default()
+	router.GET("/api/v1/users/:id", handler.GetUserByID)
+	router.GET("/api/v1/users", handler.GetAllUsers)
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("/api/v1/users/1?fields=id,name,age,name")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, []string{"id", "name", "age"}, requestedFields)
+	var body map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	assert.Len(t, body, 3)
+	assert.Equal(t, "John Doe", body["name"])
+	assert.Contains(t, body, "age")
+
+	// Without age the birth date is not needed, so users without it are still listed
+	w = request("/api/v1/users?fields=id,name")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"data":[{"id":2,"name":"Jane Smith"}],"total":1,"page":1,"pageSize":100}`, w.Body.String())
+
+	w = request("/api/v1/users/1?fields=id,password")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `unknown field: \"password\"`)
+	assert.Equal(t, http.StatusBadRequest, request("/api/v1/users?fields=id,").Code)
 }
 
 func TestUserHandler_UpdateUser(t *testing.T) {
 	// Mock UserUseCase
 	mock := &mockUserUseCase{
+		AuthorizeUserWriteFunc: func(actor *usecase.Principal, userID uint64) error {
+			return nil
+		},
 		GetUserByIDFunc: func(id uint64) (*entity.User, error) {
 			if id == 1 {
 				return &entity.User{
@@ -279,10 +679,10 @@ func TestUserHandler_UpdateUser(t *testing.T) {
 		handler.UpdateUser(c)
 	})
 
-	// Create a new HTTP request with JSON payload
-	payload := usecase.UpdateUserData{
-		BirthDate: "1992-02-01",
-		Address: &entity.Address{
+	// Create a new HTTP request with a merge patch payload; fields left out keep their values
+	payload := map[string]interface{}{
+		"birthDate": "1992-02-01",
+		"address": &entity.Address{
 			Street:  "R Manuel Jacinto",
 			City:    "Sao Paulo",
 			State:   "SP",
@@ -292,9 +692,16 @@ func TestUserHandler_UpdateUser(t *testing.T) {
 	body, _ := json.Marshal(payload)
 	req, _ := http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewReader(body))
 
-	// Perform the request
+	// Without If-Match the change is refused
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+
+	// Perform the request
+	req, _ = http.NewRequest("PATCH", "/api/v1/users/1", bytes.NewReader(body))
+	req.Header.Set("If-Match", "*")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
 
 	// Check the response status code
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -322,7 +729,13 @@ func TestUserHandler_UpdateUser(t *testing.T) {
 func TestUserHandler_DeleteUser(t *testing.T) {
 	// Mock UserUseCase
 	mock := &mockUserUseCase{
-		DeleteUserFunc: func(id uint64) error {
+		AuthorizeUserWriteFunc: func(actor *usecase.Principal, userID uint64) error {
+			return nil
+		},
+		GetUserByIDFunc: func(id uint64) (*entity.User, error) {
+			return &entity.User{ID: id, Version: 1}, nil
+		},
+		DeleteUserFunc: func(id, version uint64) error {
 			return nil
 		},
 	}
@@ -341,9 +754,16 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 	// Create a new HTTP request
 	req, _ := http.NewRequest("DELETE", "/api/v1/users/1", nil)
 
-	// Perform the request
+	// Without If-Match the deletion is refused
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	assert.JSONEq(t, `{"error": "If-Match header is required"}`, w.Body.String())
+
+	// Perform the request; without a birth date the age in the ETag is zero
+	req.Header.Set("If-Match", `"1-0-active"`)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
 
 	// Check the response status code
 	assert.Equal(t, http.StatusNoContent, w.Code)
@@ -352,11 +772,16 @@ func TestUserHandler_DeleteUser(t *testing.T) {
 func TestAuthHandler_Login(t *testing.T) {
 	// Mock UserUseCase
 	mock := &mockUserUseCase{
-		AuthenticateUserFunc: func(email, password string) (string, error) {
+		AuthenticateUserFunc: func(email, password, clientIP string) (*usecase.AuthTokens, error) {
 			if email == "johndoe@example.com" && password == "password" {
-				return "token123", nil
+				return &usecase.AuthTokens{
+					AccessToken:  "token123",
+					RefreshToken: "refresh123",
+					TokenType:    "Bearer",
+					ExpiresIn:    900,
+				}, nil
 			}
-			return "", errors.New("authentication failed")
+			return nil, errors.New("authentication failed")
 		},
 	}
 
@@ -387,7 +812,10 @@ func TestAuthHandler_Login(t *testing.T) {
 
 	// Check the response body
 	expectedResponse := gin.H{
-		"token": "token123",
+		"token":        "token123",
+		"refreshToken": "refresh123",
+		"tokenType":    "Bearer",
+		"expiresIn":    float64(900),
 	}
 	var responseJSON gin.H
 	_ = json.Unmarshal(w.Body.Bytes(), &responseJSON)
@@ -397,8 +825,8 @@ func TestAuthHandler_Login(t *testing.T) {
 func TestAuthHandler_Login_InvalidCredentials(t *testing.T) {
 	// Mock UserUseCase
 	mock := &mockUserUseCase{
-		AuthenticateUserFunc: func(email, password string) (string, error) {
-			return "", errors.New("authentication failed")
+		AuthenticateUserFunc: func(email, password, clientIP string) (*usecase.AuthTokens, error) {
+			return nil, usecase.ErrInvalidCredentials
 		},
 	}
 
@@ -434,6 +862,29 @@ func TestAuthHandler_Login_InvalidCredentials(t *testing.T) {
 	assert.Equal(t, expectedResponse, responseJSON)
 }
 
+func TestAuthHandler_Login_InternalError(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthenticateUserFunc: func(email, password, clientIP string) (*usecase.AuthTokens, error) {
+			return nil, errors.New("database unavailable")
+		},
+	}
+
+	// Create AuthHandler with mock UserUseCase
+	handler := NewAuthHandler(mock)
+
+	// Create a new Gin router and register the Login route
+	router := gin.Default()
+	router.POST("/login", handler.Login)
+
+	req, _ := http.NewRequest("POST", "/login", bytes.NewReader([]byte(`{"email": "johndoe@example.com", "password": "password"}`)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	// Infrastructure failures are not reported as invalid credentials
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
 func TestAuthHandler_Login_InvalidRequest(t *testing.T) {
 	// Mock UserUseCase
 	mock := &mockUserUseCase{}
@@ -463,21 +914,1543 @@ func TestAuthHandler_Login_InvalidRequest(t *testing.T) {
 	assert.Equal(t, expectedResponse, responseJSON)
 }
 
-func TestRegisterRoutes(t *testing.T) {
-	userUseCase := &mockUserUseCase{}
+func TestAuthHandler_Login_EmailNotVerified(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthenticateUserFunc: func(email, password, clientIP string) (*usecase.AuthTokens, error) {
+			return nil, usecase.ErrEmailNotVerified
+		},
+	}
 
-	router := NewRouter(userUseCase)
-	r := router.RegisterRoutes()
+	// Create AuthHandler with mock UserUseCase
+	handler := NewAuthHandler(mock)
 
-	assert.NotNil(t, r)
+	// Create a new Gin router and register the Login route
+	router := gin.Default()
+	router.POST("/login", handler.Login)
+
+	req, _ := http.NewRequest("POST", "/login", bytes.NewReader([]byte(`{"email": "johndoe@example.com", "password": "password"}`)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
 
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "email address has not been verified"}`, w.Body.String())
 }
 
-func TestSetupRoutes(t *testing.T) {
-	userUseCase := &mockUserUseCase{}
+func TestAuthHandler_Login_Throttled(t *testing.T) {
+	var loginErr error
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthenticateUserFunc: func(email, password, clientIP string) (*usecase.AuthTokens, error) {
+			assert.Equal(t, "192.0.2.1", clientIP)
+			return nil, loginErr
+		},
+	}
 
-	r := SetupRoutes(userUseCase)
+	// Create AuthHandler with mock UserUseCase
+	handler := NewAuthHandler(mock)
 
-	assert.NotNil(t, r)
+	// Create a new Gin router and register the Login route
+	router := gin.Default()
+	router.POST("/login", handler.Login)
+
+	login := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/login", bytes.NewReader([]byte(`{"email": "admin@example.com", "password": "password"}`)))
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Locked account
+	loginErr = &usecase.RetryAfterError{Err: usecase.ErrAccountLocked, RetryAfter: 15 * time.Minute}
+	w := login()
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Equal(t, "900", w.Header().Get("Retry-After"))
+
+	// Backoff between attempts
+	loginErr = &usecase.RetryAfterError{Err: usecase.ErrTooManyLoginAttempts, RetryAfter: 1500 * time.Millisecond}
+	w = login()
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error": "too many login attempts, try again later"}`, w.Body.String())
+}
+
+func TestAuthHandler_VerifyEmail(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		VerifyEmailFunc: func(token string) error {
+			if token != "verify123" {
+				return usecase.ErrInvalidVerificationToken
+			}
+			return nil
+		},
+		ResendVerificationEmailFunc: func(email string) error {
+			return nil
+		},
+	}
+
+	// Create AuthHandler with mock UserUseCase
+	handler := NewAuthHandler(mock)
+
+	// Create a new Gin router and register the email verification routes
+	router := gin.Default()
+	router.GET("/verify-email", handler.VerifyEmail)
+	router.POST("/verify-email/resend", handler.ResendVerificationEmail)
+
+	req, _ := http.NewRequest("GET", "/verify-email?token=verify123", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, _ = http.NewRequest("GET", "/verify-email?token=invalid", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req, _ = http.NewRequest("POST", "/verify-email/resend", bytes.NewReader([]byte(`{"email": "johndoe@example.com"}`)))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+}
+
+func TestAuthHandler_ConfirmEmailChange(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ConfirmEmailChangeFunc: func(token string) error {
+			switch token {
+			case "change123":
+				return nil
+			case "taken":
+				return usecase.ErrEmailTaken
+			}
+			return usecase.ErrInvalidVerificationToken
+		},
+	}
+
+	// Create AuthHandler with mock UserUseCase
+	handler := NewAuthHandler(mock)
+
+	// Create a new Gin router and register the ConfirmEmailChange route
+	router := gin.Default()
+	router.GET("/verify-email/change", handler.ConfirmEmailChange)
 
+	confirm := func(token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/verify-email/change?token="+token, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, confirm("change123").Code)
+	assert.Equal(t, http.StatusBadRequest, confirm("invalid").Code)
+	assert.Equal(t, http.StatusBadRequest, confirm("").Code)
+
+	// The new address was taken by another user after the change was requested
+	w := confirm("taken")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error": "email already in use"}`, w.Body.String())
+}
+
+func TestAuthHandler_RefreshToken(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		RefreshTokensFunc: func(refreshToken string) (*usecase.AuthTokens, error) {
+			if refreshToken == "refresh123" {
+				return &usecase.AuthTokens{
+					AccessToken:  "token456",
+					RefreshToken: "refresh456",
+					TokenType:    "Bearer",
+					ExpiresIn:    900,
+				}, nil
+			}
+			return nil, usecase.ErrRefreshTokenReused
+		},
+	}
+
+	// Create AuthHandler with mock UserUseCase
+	handler := NewAuthHandler(mock)
+
+	// Create a new Gin router and register the RefreshToken route
+	router := gin.Default()
+	router.POST("/token/refresh", handler.RefreshToken)
+
+	// Valid refresh token
+	req, _ := http.NewRequest("POST", "/token/refresh", bytes.NewReader([]byte(`{"refreshToken": "refresh123"}`)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var responseTokens usecase.AuthTokens
+	_ = json.Unmarshal(w.Body.Bytes(), &responseTokens)
+	assert.Equal(t, "token456", responseTokens.AccessToken)
+	assert.Equal(t, "refresh456", responseTokens.RefreshToken)
+
+	// Reused refresh token
+	req, _ = http.NewRequest("POST", "/token/refresh", bytes.NewReader([]byte(`{"refreshToken": "refresh123-old"}`)))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error": "refresh token reuse detected"}`, w.Body.String())
+}
+
+func TestAuthHandler_Logout(t *testing.T) {
+	var loggedOut *usecase.Principal
+	var revokedRefreshToken string
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			if tokenString == "token123" {
+				return &usecase.Principal{UserID: 1, Profile: "user", TokenID: "jti123"}, nil
+			}
+			return nil, usecase.ErrTokenRevoked
+		},
+		LogoutFunc: func(principal *usecase.Principal, refreshToken string, allSessions bool) error {
+			loggedOut = principal
+			revokedRefreshToken = refreshToken
+			return nil
+		},
+	}
+
+	// Create a new Gin router with the protected Logout route
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	req, _ := http.NewRequest("POST", "/api/v1/logout", bytes.NewReader([]byte(`{"refreshToken": "refresh123"}`)))
+	req.Header.Set("Authorization", "Bearer token123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "jti123", loggedOut.TokenID)
+	assert.Equal(t, "refresh123", revokedRefreshToken)
+
+	// Revoked token is rejected by the middleware
+	req, _ = http.NewRequest("POST", "/api/v1/logout", nil)
+	req.Header.Set("Authorization", "Bearer revoked")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAuthHandler_ForgotPassword(t *testing.T) {
+	var requestedEmail string
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		RequestPasswordResetFunc: func(email string) error {
+			requestedEmail = email
+			return nil
+		},
+	}
+
+	// Create AuthHandler with mock UserUseCase
+	handler := NewAuthHandler(mock)
+
+	// Create a new Gin router and register the ForgotPassword route
+	router := gin.Default()
+	router.POST("/password/forgot", handler.ForgotPassword)
+
+	req, _ := http.NewRequest("POST", "/password/forgot", bytes.NewReader([]byte(`{"email": "johndoe@example.com"}`)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "johndoe@example.com", requestedEmail)
+}
+
+func TestAuthHandler_ResetPassword(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ResetPasswordFunc: func(token, newPassword string) error {
+			if token != "reset123" {
+				return usecase.ErrInvalidResetToken
+			}
+			return entity.ValidatePassword(newPassword)
+		},
+	}
+
+	// Create AuthHandler with mock UserUseCase
+	handler := NewAuthHandler(mock)
+
+	// Create a new Gin router and register the ResetPassword route
+	router := gin.Default()
+	router.POST("/password/reset", handler.ResetPassword)
+
+	// Valid token
+	req, _ := http.NewRequest("POST", "/password/reset", bytes.NewReader([]byte(`{"token": "reset123", "password": "newpassword"}`)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// Invalid token
+	req, _ = http.NewRequest("POST", "/password/reset", bytes.NewReader([]byte(`{"token": "used", "password": "newpassword"}`)))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "invalid or expired password reset token"}`, w.Body.String())
+
+	// Weak password
+	req, _ = http.NewRequest("POST", "/password/reset", bytes.NewReader([]byte(`{"token": "reset123", "password": "123"}`)))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUserHandler_ChangePassword(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 7, Profile: "user"}, nil
+		},
+		ChangePasswordFunc: func(userID uint64, currentPassword, newPassword string) (*usecase.AuthTokens, error) {
+			if userID != 7 || currentPassword != "password" {
+				return nil, usecase.ErrInvalidCurrentPassword
+			}
+			return &usecase.AuthTokens{AccessToken: "token456", RefreshToken: "refresh456", TokenType: "Bearer"}, nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	// Correct current password
+	req, _ := http.NewRequest("POST", "/api/v1/users/me/password", bytes.NewReader([]byte(`{"currentPassword": "password", "newPassword": "newpassword"}`)))
+	req.Header.Set("Authorization", "Bearer token123")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var responseTokens usecase.AuthTokens
+	_ = json.Unmarshal(w.Body.Bytes(), &responseTokens)
+	assert.Equal(t, "token456", responseTokens.AccessToken)
+
+	// Wrong current password
+	req, _ = http.NewRequest("POST", "/api/v1/users/me/password", bytes.NewReader([]byte(`{"currentPassword": "wrong", "newPassword": "newpassword"}`)))
+	req.Header.Set("Authorization", "Bearer token123")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error": "current password is incorrect"}`, w.Body.String())
+}
+
+func TestAuthHandler_LoginTwoFactor(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthenticateUserFunc: func(email, password, clientIP string) (*usecase.AuthTokens, error) {
+			return &usecase.AuthTokens{ChallengeToken: "challenge123", ExpiresIn: 300}, nil
+		},
+		CompleteTwoFactorLoginFunc: func(challengeToken, code, clientIP string) (*usecase.AuthTokens, error) {
+			if challengeToken != "challenge123" {
+				return nil, usecase.ErrInvalidChallengeToken
+			}
+			if code != "123456" {
+				return nil, usecase.ErrInvalidTwoFactorCode
+			}
+			return &usecase.AuthTokens{AccessToken: "token123", RefreshToken: "refresh123", TokenType: "Bearer", ExpiresIn: 900}, nil
+		},
+	}
+
+	// Create AuthHandler with mock UserUseCase
+	handler := NewAuthHandler(mock)
+
+	// Create a new Gin router and register the login routes
+	router := gin.Default()
+	router.POST("/login", handler.Login)
+	router.POST("/login/2fa", handler.LoginTwoFactor)
+
+	// The password step only returns the challenge
+	req, _ := http.NewRequest("POST", "/login", bytes.NewReader([]byte(`{"email": "admin@example.com", "password": "password"}`)))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"challengeToken": "challenge123", "expiresIn": 300}`, w.Body.String())
+
+	// Valid code
+	req, _ = http.NewRequest("POST", "/login/2fa", bytes.NewReader([]byte(`{"challengeToken": "challenge123", "code": "123456"}`)))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"token": "token123", "refreshToken": "refresh123", "tokenType": "Bearer", "expiresIn": 900}`, w.Body.String())
+
+	// Invalid code
+	req, _ = http.NewRequest("POST", "/login/2fa", bytes.NewReader([]byte(`{"challengeToken": "challenge123", "code": "000000"}`)))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error": "invalid two-factor authentication code"}`, w.Body.String())
+}
+
+func TestUserHandler_TwoFactorEnrollment(t *testing.T) {
+	enabled := false
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 7, Profile: "user"}, nil
+		},
+		SetupTwoFactorFunc: func(userID uint64) (*usecase.TwoFactorSetup, error) {
+			if enabled {
+				return nil, usecase.ErrTwoFactorAlreadyEnabled
+			}
+			return &usecase.TwoFactorSetup{Secret: "JBSWY3DPEHPK3PXP", URI: "otpauth://totp/test"}, nil
+		},
+		ConfirmTwoFactorFunc: func(userID uint64, code string) ([]string, error) {
+			if code != "123456" {
+				return nil, usecase.ErrInvalidTwoFactorCode
+			}
+			enabled = true
+			return []string{"abcde-fghij"}, nil
+		},
+		DisableTwoFactorFunc: func(userID uint64, code, clientIP string) error {
+			if code != "123456" {
+				return usecase.ErrInvalidTwoFactorCode
+			}
+			enabled = false
+			return nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", "Bearer token123")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/v1/users/me/2fa/setup", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"secret": "JBSWY3DPEHPK3PXP", "otpauthUri": "otpauth://totp/test"}`, w.Body.String())
+
+	w = request("POST", "/api/v1/users/me/2fa/confirm", `{"code": "000000"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("POST", "/api/v1/users/me/2fa/confirm", `{"code": "123456"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"recoveryCodes": ["abcde-fghij"]}`, w.Body.String())
+
+	w = request("POST", "/api/v1/users/me/2fa/setup", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = request("DELETE", "/api/v1/users/me/2fa", `{"code": "123456"}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestUserHandler_UnlockUser(t *testing.T) {
+	var permissions []string
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthorizeUserWriteFunc: func(actor *usecase.Principal, userID uint64) error {
+			return nil
+		},
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 1, Profile: "user", Permissions: permissions}, nil
+		},
+		UnlockUserFunc: func(id uint64) error {
+			if id != 2 {
+				return repository.ErrNotFound
+			}
+			return nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	unlock := func(path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", path, nil)
+		req.Header.Set("Authorization", "Bearer token123")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Unlocking requires the users:write permission
+	assert.Equal(t, http.StatusForbidden, unlock("/api/v1/users/2/unlock").Code)
+
+	permissions = []string{"users:write"}
+	assert.Equal(t, http.StatusNoContent, unlock("/api/v1/users/2/unlock").Code)
+	assert.Equal(t, http.StatusNotFound, unlock("/api/v1/users/3/unlock").Code)
+}
+
+func TestUserHandler_Me(t *testing.T) {
+	var deleted []uint64
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 7, Profile: "user"}, nil
+		},
+		GetUserByIDFunc: func(id uint64) (*entity.User, error) {
+			return &entity.User{ID: id, Name: "John Doe", Email: "john@example.com", BirthDate: "1990-01-01"}, nil
+		},
+		UpdateUserFunc: func(user *entity.User) error {
+			return nil
+		},
+		DeleteUserFunc: func(id, version uint64) error {
+			deleted = append(deleted, id)
+			return nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token123")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("GET", "/api/v1/users/me", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"id":7`)
+
+	// Changes to the authenticated user also require If-Match
+	for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+		req, _ := http.NewRequest(method, "/api/v1/users/me", strings.NewReader(`{"name":"John Doe","email":"john@example.com","birthDate":"1990-01-01"}`))
+		req.Header.Set("Authorization", "Bearer token123")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusPreconditionRequired, w.Code, method)
+	}
+	assert.Empty(t, deleted)
+
+	w = request("PATCH", "/api/v1/users/me", `{"birthDate":"1991-03-04"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"birthDate":"1991-03-04"`)
+
+	// Users without permissions can only access themselves
+	assert.Equal(t, http.StatusOK, request("GET", "/api/v1/users/7", "").Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/api/v1/users/8", "").Code)
+	assert.Equal(t, http.StatusForbidden, request("PATCH", "/api/v1/users/8", `{}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/api/v1/users/8", "").Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/api/v1/users", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, request("DELETE", "/api/v1/users/me", "").Code)
+	assert.Equal(t, []uint64{7}, deleted)
+}
+
+func TestUserHandler_AdminProfiles(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthorizeUserWriteFunc: func(actor *usecase.Principal, userID uint64) error {
+			return nil
+		},
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:write", "roles:manage"}}, nil
+		},
+		CheckEmailExistsFunc: func(email string) (bool, error) {
+			return email == "taken@example.com", nil
+		},
+		CreateUserWithProfileFunc: func(user *usecase.CreateUserData, profile string) (*entity.User, error) {
+			return &entity.User{ID: 5, Name: user.Name, Email: user.Email, Profile: profile}, nil
+		},
+		ChangeUserProfileFunc: func(id uint64, profile string) (*entity.User, error) {
+			if id == 1 {
+				return nil, usecase.ErrLastAdmin
+			}
+			return &entity.User{ID: id, Profile: profile}, nil
+		},
+		GetUserByIDFunc: func(id uint64) (*entity.User, error) {
+			return &entity.User{ID: id, Profile: "admin"}, nil
+		},
+		DeleteUserFunc: func(id, version uint64) error {
+			return usecase.ErrLastAdmin
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token123")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/v1/admin/users", `{"name":"Jane","email":"jane@example.com","password":"secret123","birthDate":"1990-01-01","profile":"admin"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"profile":"admin"`)
+
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/api/v1/admin/users", `{"name":"Jane","email":"jane@example.com","profile":"root"}`).Code)
+	assert.Equal(t, http.StatusConflict, request("POST", "/api/v1/admin/users", `{"name":"Jane","email":"taken@example.com","profile":"user"}`).Code)
+
+	w = request("PUT", "/api/v1/users/2/profile", `{"profile":"admin"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"profile":"admin"`)
+
+	// The last admin is protected
+	assert.Equal(t, http.StatusConflict, request("PUT", "/api/v1/users/1/profile", `{"profile":"user"}`).Code)
+	assert.Equal(t, http.StatusConflict, request("DELETE", "/api/v1/users/me", "").Code)
+}
+
+func TestUserHandler_ChangeUserStatus(t *testing.T) {
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthorizeUserWriteFunc: func(actor *usecase.Principal, userID uint64) error {
+			return nil
+		},
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:write"}}, nil
+		},
+		ChangeUserStatusFunc: func(id uint64, status, reason string, suspendedUntil *time.Time) (*entity.User, error) {
+			switch {
+			case status == "archived":
+				return nil, entity.ErrInvalidStatus
+			case id == 3:
+				return nil, usecase.ErrInvalidStatusTransition
+			}
+			return &entity.User{ID: id, Status: status, StatusReason: reason, SuspendedUntil: suspendedUntil}, nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(body string, id int) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/v1/users/%d/status", id), strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token123")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(`{"status":"suspended","reason":"chargeback","until":"2030-01-01T00:00:00Z"}`, 2)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"suspended"`)
+	assert.Contains(t, w.Body.String(), `"suspendedUntil":"2030-01-01T00:00:00Z"`)
+
+	assert.Equal(t, http.StatusBadRequest, request(`{"status":"archived"}`, 2).Code)
+	assert.Equal(t, http.StatusBadRequest, request(`{"status":"suspended","until":"tomorrow"}`, 2).Code)
+	assert.Equal(t, http.StatusConflict, request(`{"status":"suspended"}`, 3).Code)
+}
+
+func TestUserHandler_WritesOnAdmin(t *testing.T) {
+	principal := &usecase.Principal{UserID: 2, Profile: "support", Permissions: []string{"users:read", "users:write", "users:delete"}}
+	var changed []uint64
+
+	// Mock UserUseCase; user 1 is an administrator, holding roles:manage among other permissions
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return principal, nil
+		},
+		AuthorizeUserWriteFunc: func(actor *usecase.Principal, userID uint64) error {
+			if userID == 1 && !actor.HasPermission("roles:manage") {
+				return usecase.ErrUserWriteNotAllowed
+			}
+			return nil
+		},
+		GetUserByIDFunc: func(id uint64) (*entity.User, error) {
+			return &entity.User{ID: id, Name: "Jane Doe", Email: "jane@example.com", BirthDate: "1990-01-01"}, nil
+		},
+		UpdateUserFunc: func(user *entity.User) error {
+			changed = append(changed, user.ID)
+			return nil
+		},
+		DeleteUserFunc: func(id, version uint64) error {
+			changed = append(changed, id)
+			return nil
+		},
+		ChangeUserStatusFunc: func(id uint64, status, reason string, suspendedUntil *time.Time) (*entity.User, error) {
+			changed = append(changed, id)
+			return &entity.User{ID: id, Status: status}, nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token123")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A users:write role without the admin permissions cannot take over or disable an administrator
+	for _, route := range [][3]string{
+		{"PATCH", "/api/v1/users/1", `{"email":"attacker@example.com"}`},
+		{"PUT", "/api/v1/users/1", `{"name":"Jane Doe","email":"attacker@example.com","birthDate":"1990-01-01"}`},
+		{"PUT", "/api/v1/users/1/status", `{"status":"disabled"}`},
+		{"DELETE", "/api/v1/users/1", ""},
+	} {
+		w := request(route[0], route[1], route[2])
+		assert.Equal(t, http.StatusForbidden, w.Code, route[1])
+		assert.JSONEq(t, `{"error": "Você não tem permissão para alterar este usuário"}`, w.Body.String())
+	}
+	assert.Empty(t, changed)
+
+	// Users whose permissions the actor holds can still be changed
+	assert.Equal(t, http.StatusOK, request("PATCH", "/api/v1/users/3", `{"name":"Janet"}`).Code)
+	assert.Equal(t, http.StatusOK, request("PUT", "/api/v1/users/3/status", `{"status":"disabled"}`).Code)
+	assert.Equal(t, http.StatusNoContent, request("DELETE", "/api/v1/users/3", "").Code)
+	assert.Equal(t, []uint64{3, 3, 3}, changed)
+
+	// The same applies to OAuth clients granted the users:write scope
+	principal = &usecase.Principal{ClientID: "crm", Scopes: []string{"users:write"}}
+	assert.Equal(t, http.StatusForbidden, request("PATCH", "/api/v1/users/1", `{"email":"attacker@example.com"}`).Code)
+}
+
+func TestUserHandler_ImportUsers(t *testing.T) {
+	var receivedRows []usecase.ImportUserData
+	var receivedDryRun bool
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			if tokenString == "user-token" {
+				return &usecase.Principal{UserID: 2, Profile: "user", Permissions: []string{"users:write"}}, nil
+			}
+			return &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:write", "roles:manage"}}, nil
+		},
+		ImportUsersFunc: func(rows []usecase.ImportUserData, dryRun bool) (*usecase.ImportReport, error) {
+			receivedRows, receivedDryRun = rows, dryRun
+			if len(rows) == 0 {
+				return nil, usecase.ErrEmptyImport
+			}
+			return &usecase.ImportReport{DryRun: dryRun, Total: len(rows)}, nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(query, contentType, token, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/v1/users/import"+query, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	csvBody := "name,email,password,birthDate,city,street,state,country\n" +
+		"John Doe,john@example.com,secret1,1990-01-01,Sao Paulo,Rua A,SP,Brasil\n" +
+		"Jane Smith,jane@example.com,secret2\n" +
+		"\"Doe, Jr\",jr@example.com,secret3,2000-05-05,,,,\n"
+	w := request("?dryRun=true", "text/csv; charset=utf-8", "admin-token", csvBody)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, receivedDryRun)
+	assert.Len(t, receivedRows, 3)
+	assert.Equal(t, 2, receivedRows[0].Line)
+	assert.Equal(t, "john@example.com", receivedRows[0].Email)
+	assert.Equal(t, "Sao Paulo", receivedRows[0].Address.City)
+	assert.Error(t, receivedRows[1].Err)
+	assert.Equal(t, "Doe, Jr", receivedRows[2].Name)
+	assert.Nil(t, receivedRows[2].Address)
+
+	ndjsonBody := `{"name":"John Doe","email":"john@example.com","password":"secret1","birthDate":"1990-01-01","profile":"admin"}` + "\n\n{broken\n"
+	w = request("", "application/x-ndjson", "admin-token", ndjsonBody)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, receivedDryRun)
+	assert.Len(t, receivedRows, 2)
+	assert.Equal(t, "admin", receivedRows[0].Profile)
+	assert.Equal(t, 3, receivedRows[1].Line)
+	assert.Error(t, receivedRows[1].Err)
+
+	assert.Equal(t, http.StatusOK, request("?format=ndjson", "text/plain", "admin-token", ndjsonBody).Code)
+	assert.Equal(t, http.StatusBadRequest, request("", "text/csv", "admin-token", "name,email\n").Code)
+	assert.Equal(t, http.StatusBadRequest, request("", "text/csv", "admin-token", "").Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, request("", "application/xml", "admin-token", "<users/>").Code)
+	assert.Equal(t, http.StatusForbidden, request("", "text/csv", "user-token", csvBody).Code)
+}
+
+func TestUserHandler_DeletedUsers(t *testing.T) {
+	deletedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			if tokenString == "user-token" {
+				return &usecase.Principal{UserID: 2, Profile: "user"}, nil
+			}
+			return &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:delete"}}, nil
+		},
+		GetDeletedUsersFunc: func(page, pageSize int) ([]*entity.User, error) {
+			user := &entity.User{ID: 5, Name: "Jane Doe"}
+			user.DeletedAt.Time, user.DeletedAt.Valid = deletedAt, true
+			return []*entity.User{user}, nil
+		},
+		RestoreUserFunc: func(id uint64) (*entity.User, error) {
+			if id != 5 {
+				return nil, repository.ErrNotFound
+			}
+			return &entity.User{ID: id, Name: "Jane Doe"}, nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, path, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("GET", "/api/v1/users/deleted", "admin-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"deletedAt":"2026-10-01T12:00:00Z"`)
+
+	w = request("POST", "/api/v1/users/5/restore", "admin-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "deletedAt")
+
+	assert.Equal(t, http.StatusNotFound, request("POST", "/api/v1/users/6/restore", "admin-token").Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/api/v1/users/deleted", "user-token").Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/api/v1/users/5/restore", "user-token").Code)
+}
+
+func TestAuthHandler_Login_Suspended(t *testing.T) {
+	mock := &mockUserUseCase{
+		AuthenticateUserFunc: func(email, password, clientIP string) (*usecase.AuthTokens, error) {
+			return nil, usecase.ErrUserSuspended
+		},
+	}
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	req, _ := http.NewRequest("POST", "/api/v1/login", strings.NewReader(`{"email":"john@example.com","password":"password"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "user account is suspended"}`, w.Body.String())
+}
+
+func TestUserHandler_Impersonation(t *testing.T) {
+	principal := &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:impersonate"}}
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthorizeUserWriteFunc: func(actor *usecase.Principal, userID uint64) error {
+			return nil
+		},
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return principal, nil
+		},
+		ImpersonateUserFunc: func(actor *usecase.Principal, userID uint64, reason, clientIP string) (*usecase.AuthTokens, error) {
+			if reason == "" {
+				return nil, usecase.ErrImpersonationReason
+			}
+			if userID == 1 {
+				return nil, usecase.ErrImpersonationNotAllowed
+			}
+			return &usecase.AuthTokens{AccessToken: "impersonation-token", TokenType: "Bearer", ExpiresIn: 600}, nil
+		},
+		ListImpersonationsFunc: func(page, pageSize int) ([]*entity.ImpersonationSession, error) {
+			return []*entity.ImpersonationSession{{ID: 1, ActorID: 1, UserID: 7, Reason: "ticket 42"}}, nil
+		},
+		GetUserByIDFunc: func(id uint64) (*entity.User, error) {
+			return &entity.User{ID: id, Name: "Jane Doe", Email: "jane@example.com", BirthDate: "1990-01-01"}, nil
+		},
+		UpdateUserFunc: func(user *entity.User) error {
+			return nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token123")
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/v1/users/7/impersonate", `{"reason":"ticket 42"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"token":"impersonation-token"`)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/api/v1/users/7/impersonate", `{}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/api/v1/users/1/impersonate", `{"reason":"ticket 42"}`).Code)
+
+	w = request("GET", "/api/v1/impersonations", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"reason":"ticket 42"`)
+
+	// With an impersonation token, reads work but sensitive operations are blocked
+	principal = &usecase.Principal{UserID: 7, Profile: "user", ActorID: 1}
+	assert.Equal(t, http.StatusOK, request("GET", "/api/v1/users/me", "").Code)
+	for _, route := range [][2]string{
+		{"POST", "/api/v1/users/me/password"},
+		{"DELETE", "/api/v1/users/me"},
+		{"DELETE", "/api/v1/users/7"},
+		{"POST", "/api/v1/users/me/api-keys"},
+		{"POST", "/api/v1/users/8/impersonate"},
+	} {
+		w := request(route[0], route[1], `{}`)
+		assert.Equal(t, http.StatusForbidden, w.Code, route[1])
+		assert.JSONEq(t, `{"error": "Esta operação não é permitida durante a personificação de um usuário"}`, w.Body.String())
+	}
+
+	// The profile can be edited, but not the e-mail that receives the password resets
+	assert.Equal(t, http.StatusOK, request("PATCH", "/api/v1/users/me", `{"name":"Janet"}`).Code)
+	assert.Equal(t, http.StatusOK, request("PUT", "/api/v1/users/7", `{"name":"Janet","email":"JANE@example.com","birthDate":"1990-01-01"}`).Code)
+	for _, route := range [][2]string{
+		{"PATCH", "/api/v1/users/me"},
+		{"PUT", "/api/v1/users/me"},
+		{"PATCH", "/api/v1/users/7"},
+		{"PUT", "/api/v1/users/7"},
+	} {
+		w := request(route[0], route[1], `{"name":"Janet","email":"attacker@example.com","birthDate":"1990-01-01"}`)
+		assert.Equal(t, http.StatusForbidden, w.Code, route[1])
+		assert.JSONEq(t, `{"error": "A alteração do e-mail não é permitida durante a personificação de um usuário"}`, w.Body.String())
+	}
+}
+
+func TestUserHandler_APIKeys(t *testing.T) {
+	var keys []*entity.APIKey
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAPIKeyFunc: func(key string) (*usecase.Principal, error) {
+			if key != "vmy_key123" {
+				return nil, usecase.ErrInvalidAPIKey
+			}
+			return &usecase.Principal{UserID: 7, Profile: "user", APIKeyID: 1}, nil
+		},
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 7, Profile: "user"}, nil
+		},
+		CreateAPIKeyFunc: func(userID uint64, name string, expiresAt *time.Time) (*usecase.CreatedAPIKey, error) {
+			apiKey := &entity.APIKey{ID: 1, UserID: userID, Name: name, Prefix: "vmy_key123"}
+			keys = append(keys, apiKey)
+			return &usecase.CreatedAPIKey{APIKey: apiKey, Key: "vmy_key123"}, nil
+		},
+		ListAPIKeysFunc: func(userID uint64) ([]*entity.APIKey, error) {
+			return keys, nil
+		},
+		RevokeAPIKeyFunc: func(userID, keyID uint64) error {
+			if userID != 7 || keyID != 1 {
+				return repository.ErrNotFound
+			}
+			return nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, path, authorization, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, bytes.NewReader([]byte(body)))
+		req.Header.Set("Authorization", authorization)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/v1/users/me/api-keys", "Bearer token123", `{"name": "batch"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created map[string]interface{}
+	_ = json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Equal(t, "vmy_key123", created["key"])
+	assert.Equal(t, "batch", created["name"])
+	assert.NotContains(t, created, "keyHash")
+
+	w = request("POST", "/api/v1/users/me/api-keys", "Bearer token123", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("GET", "/api/v1/users/me/api-keys", "Bearer token123", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"key"`)
+
+	w = request("DELETE", "/api/v1/users/me/api-keys/1", "Bearer token123", "")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = request("DELETE", "/api/v1/users/me/api-keys/2", "Bearer token123", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// A key cannot manage keys or the account credentials
+	for _, route := range [][2]string{
+		{"POST", "/api/v1/users/me/api-keys"},
+		{"GET", "/api/v1/users/me/api-keys"},
+		{"DELETE", "/api/v1/users/me/api-keys/1"},
+		{"POST", "/api/v1/users/me/password"},
+		{"POST", "/api/v1/users/me/2fa/setup"},
+		{"DELETE", "/api/v1/users/me/2fa"},
+	} {
+		w = request(route[0], route[1], "ApiKey vmy_key123", `{}`)
+		assert.Equal(t, http.StatusForbidden, w.Code, route[1])
+		assert.JSONEq(t, `{"error": "Esta operação não é permitida com uma chave de API"}`, w.Body.String())
+	}
+
+	w = request("GET", "/api/v1/users/me/api-keys", "ApiKey invalid", "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error": "Chave de API inválida"}`, w.Body.String())
+}
+
+func TestOAuthHandler_Token(t *testing.T) {
+	mock := &mockOAuthClientUseCase{
+		IssueClientTokenFunc: func(clientID, clientSecret string, scopes []string) (*usecase.ClientToken, error) {
+			if clientID != "client123" || clientSecret != "secret/123" {
+				return nil, usecase.ErrInvalidClient
+			}
+			if len(scopes) > 0 && scopes[0] != "users:read" {
+				return nil, usecase.ErrInvalidScope
+			}
+			return &usecase.ClientToken{AccessToken: "token123", TokenType: "Bearer", ExpiresIn: 900, Scope: "users:read"}, nil
+		},
+	}
+
+	router := NewRouter(&mockUserUseCase{}, mock, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(form url.Values, basicUser, basicPassword string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/oauth/token", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if basicUser != "" {
+			req.SetBasicAuth(basicUser, basicPassword)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Credentials in the body
+	w := request(url.Values{"grant_type": {"client_credentials"}, "client_id": {"client123"}, "client_secret": {"secret/123"}}, "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.JSONEq(t, `{"access_token": "token123", "token_type": "Bearer", "expires_in": 900, "scope": "users:read"}`, w.Body.String())
+
+	// Credentials via HTTP Basic, form-urlencoded
+	w = request(url.Values{"grant_type": {"client_credentials"}, "scope": {"users:read"}}, "client123", url.QueryEscape("secret/123"))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Wrong secret
+	w = request(url.Values{"grant_type": {"client_credentials"}}, "client123", "wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="oauth"`, w.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, w.Body.String(), `"error":"invalid_client"`)
+
+	// Scope not allowed
+	w = request(url.Values{"grant_type": {"client_credentials"}, "scope": {"users:delete"}}, "client123", "secret%2F123")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"invalid_scope"`)
+
+	// Unsupported grant
+	w = request(url.Values{"grant_type": {"password"}}, "client123", "secret%2F123")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `"error":"unsupported_grant_type"`)
+}
+
+func TestOAuthClientScopes(t *testing.T) {
+	scopes := []string{"users:read"}
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{ClientID: "client123", Scopes: scopes}, nil
+		},
+		GetAllUsersFunc: func(filter *repository.UserFilter, pagination usecase.Pagination) (*usecase.UserPage, error) {
+			return &usecase.UserPage{Page: 1, PageSize: 100}, nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, path string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer token123")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("GET", "/api/v1/users").Code)
+
+	// Client tokens do not represent a user nor an admin
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/api/v1/users/me/api-keys").Code)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/api/v1/users/1").Code)
+
+	scopes = nil
+	assert.Equal(t, http.StatusForbidden, request("GET", "/api/v1/users").Code)
+}
+
+func TestRoleHandler(t *testing.T) {
+	permissions := []string{"users:read"}
+	var assigned []uint64
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 1, Profile: "admin", Permissions: permissions}, nil
+		},
+	}
+	roles := &mockRoleUseCase{
+		CreateRoleFunc: func(name, description string, perms []string) (*entity.Role, error) {
+			if name == "support" {
+				return nil, usecase.ErrRoleNameTaken
+			}
+			return &entity.Role{ID: 3, Name: name, Description: description, Permissions: []entity.Permission{{Name: perms[0]}}}, nil
+		},
+		DeleteRoleFunc: func(id uint64) error {
+			return usecase.ErrBuiltinRole
+		},
+		AssignRoleFunc: func(userID, roleID uint64) error {
+			if roleID != 3 {
+				return repository.ErrNotFound
+			}
+			assigned = append(assigned, userID)
+			return nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, roles, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token123")
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Managing roles requires the roles:manage permission
+	assert.Equal(t, http.StatusForbidden, request("POST", "/api/v1/roles", `{"name":"auditor","permissions":["users:read"]}`).Code)
+
+	permissions = []string{"users:read", "roles:manage"}
+	w := request("POST", "/api/v1/roles", `{"name":"auditor","permissions":["users:read"]}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"users:read"`)
+
+	assert.Equal(t, http.StatusConflict, request("POST", "/api/v1/roles", `{"name":"support"}`).Code)
+	assert.Equal(t, http.StatusForbidden, request("DELETE", "/api/v1/roles/1", "").Code)
+
+	assert.Equal(t, http.StatusNoContent, request("POST", "/api/v1/users/2/roles", `{"roleId":3}`).Code)
+	assert.Equal(t, http.StatusNotFound, request("POST", "/api/v1/users/2/roles", `{"roleId":4}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/api/v1/users/2/roles", `{}`).Code)
+	assert.Equal(t, []uint64{2}, assigned)
+}
+
+func TestKeyHandler_JWKS(t *testing.T) {
+	router := NewRouter(&mockUserUseCase{}, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	req, _ := http.NewRequest("GET", "/.well-known/jwks.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"keys": []}`, w.Body.String())
+}
+
+func TestRegisterRoutes(t *testing.T) {
+	userUseCase := &mockUserUseCase{}
+
+	router := NewRouter(userUseCase, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret")))
+	r := router.RegisterRoutes()
+
+	assert.NotNil(t, r)
+
+}
+
+func TestSetupRoutes(t *testing.T) {
+	userUseCase := &mockUserUseCase{}
+
+	r := SetupRoutes(userUseCase, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret")))
+
+	assert.NotNil(t, r)
+
+}
+
+func TestUserHandler_ExportUsers(t *testing.T) {
+	createdAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	expiredSuspension := time.Now().Add(-time.Hour)
+	var receivedFilter *repository.UserFilter
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			if tokenString == "user-token" {
+				return &usecase.Principal{UserID: 2, Profile: "user"}, nil
+			}
+			return &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:read"}}, nil
+		},
+		ExportUsersFunc: func(filter *repository.UserFilter, process func(users []*entity.User) error) error {
+			receivedFilter = filter
+			if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+				return usecase.ErrInvalidFilter
+			}
+			if filter.Profile == "nobody" {
+				return nil
+			}
+			batches := [][]*entity.User{
+				{{ID: 1, Name: "John Doe", Email: "john@example.com", Password: "hashed-secret", BirthDate: "1990-01-01", Profile: "admin", Status: "active",
+					Address: &entity.Address{Street: "Rua A", City: "Sao Paulo", State: "SP", Country: "Brasil"}, CreatedAt: createdAt}},
+				{{ID: 2, Name: "=HYPERLINK(\"x\")", Email: "jane@example.com", BirthDate: "1995-05-05", Profile: "user", Status: "suspended",
+					SuspendedUntil: &expiredSuspension, CreatedAt: createdAt}},
+			}
+			for _, batch := range batches {
+				if err := process(batch); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(query, token string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/api/v1/users/export"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// CSV is the default format; password hashes are never loaded nor written
+	w := request("?city=Sao%20Paulo", "admin-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), ".csv")
+	assert.Equal(t, "Sao Paulo", receivedFilter.City)
+	assert.NotContains(t, receivedFilter.Fields, "password")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "id,name,email,birthDate,age,profile,status,emailVerified,twoFactorEnabled,street,city,state,country,createdAt", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "1,John Doe,john@example.com,1990-01-01,"))
+	assert.Contains(t, lines[1], ",admin,active,false,false,Rua A,Sao Paulo,SP,Brasil,2026-10-01T12:00:00Z")
+	assert.Contains(t, lines[2], `"'=HYPERLINK(""x"")"`)
+	// The effective status is exported: expired suspensions are reported as active
+	assert.Contains(t, lines[2], ",user,active,")
+	assert.NotContains(t, w.Body.String(), "hashed-secret")
+
+	w = request("?format=ndjson", "admin-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	lines = strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	assert.Len(t, lines, 2)
+	var exported map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &exported))
+	assert.Equal(t, "john@example.com", exported["email"])
+	assert.NotContains(t, exported, "password")
+
+	w = request("?format=xlsx", "admin-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	archive, err := zip.NewReader(bytes.NewReader(w.Body.Bytes()), int64(w.Body.Len()))
+	if assert.NoError(t, err) {
+		files := map[string]string{}
+		for _, file := range archive.File {
+			reader, _ := file.Open()
+			content, _ := io.ReadAll(reader)
+			reader.Close()
+			files[file.Name] = string(content)
+		}
+		assert.Contains(t, files, "[Content_Types].xml")
+		assert.Contains(t, files["xl/workbook.xml"], `<sheet name="users" sheetId="1" r:id="rId1"/>`)
+		assert.Contains(t, files["xl/worksheets/sheet1.xml"], `<c><v>1</v></c><c t="inlineStr"><is><t xml:space="preserve">John Doe</t></is></c>`)
+		assert.Contains(t, files["xl/worksheets/sheet1.xml"], `=HYPERLINK(&#34;x&#34;)`)
+	}
+
+	// No matching users: only the header is exported
+	w = request("?profile=nobody", "admin-token")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id,name,email,birthDate,age,profile,status,emailVerified,twoFactorEnabled,street,city,state,country,createdAt\n", w.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, request("?format=pdf", "admin-token").Code)
+	assert.Equal(t, http.StatusBadRequest, request("?minAge=abc", "admin-token").Code)
+	w = request("?createdFrom=2026-10-02&createdTo=2026-10-01", "admin-token")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, http.StatusForbidden, request("", "user-token").Code)
+}
+
+func TestUserHandler_ReplaceAndPatchUser(t *testing.T) {
+	var saved *entity.User
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthorizeUserWriteFunc: func(actor *usecase.Principal, userID uint64) error {
+			return nil
+		},
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:write"}}, nil
+		},
+		GetUserByIDFunc: func(id uint64) (*entity.User, error) {
+			if id != 1 {
+				return nil, repository.ErrNotFound
+			}
+			return &entity.User{ID: 1, Name: "John Doe", Email: "john@example.com", BirthDate: "1990-01-01", Profile: "user",
+				Address: &entity.Address{Street: "Rua A", City: "Sao Paulo", State: "SP", Country: "Brasil"}}, nil
+		},
+		UpdateUserFunc: func(user *entity.User) error {
+			saved = user
+			if user.Name == "" {
+				return fmt.Errorf("%w: Name cannot be empty", usecase.ErrInvalidUserData)
+			}
+			if user.Email == "taken@example.com" {
+				return usecase.ErrEmailTaken
+			}
+			return nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method, contentType, body string) *httptest.ResponseRecorder {
+		saved = nil
+		req, _ := http.NewRequest(method, "/api/v1/users/1", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token123")
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("If-Match", "*")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// PUT replaces every editable field: the omitted address is cleared
+	w := request("PUT", "application/json", `{"name":"Jane Doe","email":"jane@example.com","birthDate":"1991-02-03"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Jane Doe", saved.Name)
+	assert.Equal(t, "jane@example.com", saved.Email)
+	assert.Nil(t, saved.Address)
+	assert.Equal(t, "user", saved.Profile)
+
+	// Read-only fields are rejected instead of silently ignored
+	assert.Equal(t, http.StatusBadRequest, request("PUT", "application/json", `{"name":"Jane","profile":"admin"}`).Code)
+
+	// Merge patch: null removes a field, nested objects are merged and omitted fields are kept
+	w = request("PATCH", "application/merge-patch+json", `{"name":"Johnny","address":{"city":"Campinas"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Johnny", saved.Name)
+	assert.Equal(t, "john@example.com", saved.Email)
+	assert.Equal(t, &entity.Address{Street: "Rua A", City: "Campinas", State: "SP", Country: "Brasil"}, saved.Address)
+
+	w = request("PATCH", "application/merge-patch+json", `{"address":null}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Nil(t, saved.Address)
+
+	// Clearing a required field fails validation
+	w = request("PATCH", "application/json", `{"name":""}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Name cannot be empty")
+
+	// An email that belongs to another user is a conflict
+	w = request("PATCH", "application/merge-patch+json", `{"email":"taken@example.com"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.JSONEq(t, `{"error": "email already in use"}`, w.Body.String())
+
+	// JSON Patch
+	w = request("PATCH", "application/json-patch+json", `[
+		{"op":"test","path":"/name","value":"John Doe"},
+		{"op":"replace","path":"/name","value":"John D."},
+		{"op":"copy","from":"/address/state","path":"/address/city"},
+		{"op":"remove","path":"/address/country"}
+	]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "John D.", saved.Name)
+	assert.Equal(t, &entity.Address{Street: "Rua A", City: "SP", State: "SP"}, saved.Address)
+
+	w = request("PATCH", "application/json-patch+json", `[{"op":"test","path":"/name","value":"Someone else"},{"op":"replace","path":"/name","value":"X"}]`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Nil(t, saved)
+	assert.Equal(t, http.StatusBadRequest, request("PATCH", "application/json-patch+json", `[{"op":"remove","path":"/missing"}]`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("PATCH", "application/json-patch+json", `[{"op":"add","path":"/profile","value":"admin"}]`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("PATCH", "application/json-patch+json", `{"op":"add"}`).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, request("PATCH", "text/plain", `name=x`).Code)
+}
+
+func TestJSONPatch(t *testing.T) {
+	document := []byte(`{"a":{"b":[1,2,3]},"c":"x"}`)
+
+	tests := []struct {
+		name     string
+		patch    string
+		expected string
+		err      error
+	}{
+		{"add to object", `[{"op":"add","path":"/d","value":{"e":null}}]`, `{"a":{"b":[1,2,3]},"c":"x","d":{"e":null}}`, nil},
+		{"insert into array", `[{"op":"add","path":"/a/b/1","value":9}]`, `{"a":{"b":[1,9,2,3]},"c":"x"}`, nil},
+		{"append to array", `[{"op":"add","path":"/a/b/-","value":4}]`, `{"a":{"b":[1,2,3,4]},"c":"x"}`, nil},
+		{"remove from array", `[{"op":"remove","path":"/a/b/0"}]`, `{"a":{"b":[2,3]},"c":"x"}`, nil},
+		{"replace", `[{"op":"replace","path":"/c","value":"y"}]`, `{"a":{"b":[1,2,3]},"c":"y"}`, nil},
+		{"move", `[{"op":"move","from":"/c","path":"/a/c"}]`, `{"a":{"b":[1,2,3],"c":"x"}}`, nil},
+		{"escaped pointer", `[{"op":"add","path":"/x~1y~0z","value":1}]`, `{"a":{"b":[1,2,3]},"c":"x","x/y~z":1}`, nil},
+		{"successful test", `[{"op":"test","path":"/a/b","value":[1,2,3]}]`, `{"a":{"b":[1,2,3]},"c":"x"}`, nil},
+		{"failed test", `[{"op":"test","path":"/c","value":"z"}]`, "", errPatchTestFailed},
+		{"replace missing path", `[{"op":"replace","path":"/z","value":1}]`, "", errInvalidPatch},
+		{"index out of bounds", `[{"op":"add","path":"/a/b/5","value":1}]`, "", errInvalidPatch},
+		{"leading zero index", `[{"op":"remove","path":"/a/b/01"}]`, "", errInvalidPatch},
+		{"move into child", `[{"op":"move","from":"/a","path":"/a/b/0"}]`, "", errInvalidPatch},
+		{"missing value", `[{"op":"add","path":"/d"}]`, "", errInvalidPatch},
+		{"unknown operation", `[{"op":"merge","path":"/d"}]`, "", errInvalidPatch},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := applyJSONPatch(document, []byte(test.patch))
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.JSONEq(t, test.expected, string(result))
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	// Examples from RFC 7396, appendix A
+	tests := []struct{ target, patch, expected string }{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"e":null,"a":1}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+		{`{}`, `{"a":{"bb":{"ccc":null}}}`, `{"a":{"bb":{}}}`},
+		{`{"a":{"b":"c","d":"e"}}`, `{"a":{"d":null,"f":"g"}}`, `{"a":{"b":"c","f":"g"}}`},
+	}
+
+	for _, test := range tests {
+		result, err := applyMergePatch([]byte(test.target), []byte(test.patch))
+		assert.NoError(t, err)
+		assert.JSONEq(t, test.expected, string(result))
+	}
+
+	_, err := applyMergePatch([]byte(`{}`), []byte(`{broken`))
+	assert.ErrorIs(t, err, errInvalidPatch)
+}
+
+func TestUserHandler_ETags(t *testing.T) {
+	stored := &entity.User{ID: 1, Name: "John Doe", Email: "john@example.com", BirthDate: "1990-01-01", Profile: "user", Version: 3}
+	var deletedVersion uint64
+
+	// Mock UserUseCase
+	mock := &mockUserUseCase{
+		AuthorizeUserWriteFunc: func(actor *usecase.Principal, userID uint64) error {
+			return nil
+		},
+		ValidateAccessTokenFunc: func(tokenString string) (*usecase.Principal, error) {
+			return &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:read", "users:write", "users:delete"}}, nil
+		},
+		GetUserByIDFunc: func(id uint64) (*entity.User, error) {
+			user := *stored
+			return &user, nil
+		},
+		GetUserByIDWithFieldsFunc: func(id uint64, fields []string) (*entity.User, error) {
+			return &entity.User{ID: stored.ID, Name: stored.Name, Email: stored.Email, Version: stored.Version}, nil
+		},
+		UpdateUserFunc: func(user *entity.User) error {
+			// Simulates a concurrent change saved between the read and the write
+			if user.Name == "Racing" {
+				return repository.ErrVersionConflict
+			}
+			user.Version++
+			return nil
+		},
+		DeleteUserFunc: func(id, version uint64) error {
+			deletedVersion = version
+			return nil
+		},
+	}
+
+	router := NewRouter(mock, &mockOAuthClientUseCase{}, &mockRoleUseCase{}, security.NewHMACKeyManager("test", []byte("secret"))).RegisterRoutes()
+
+	request := func(method string, headers map[string]string, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/api/v1/users/1", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer token123")
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The ETag carries the stored version and the values computed on read
+	etag := func(version int, status string) string {
+		age, _ := utils.CalculateAge(stored.BirthDate)
+		return fmt.Sprintf(`"%d-%d-%s"`, version, age, status)
+	}
+
+	w := request("GET", nil, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, etag(3, "active"), w.Header().Get("ETag"))
+
+	// If-None-Match uses the weak comparison
+	w = request("GET", map[string]string{"If-None-Match": etag(2, "active") + ", W/" + etag(3, "active")}, "")
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+	assert.Equal(t, etag(3, "active"), w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, request("GET", map[string]string{"If-None-Match": etag(2, "active")}, "").Code)
+
+	// A suspension that ends changes the representation without a new version
+	until := time.Now().Add(time.Hour)
+	stored.Status, stored.SuspendedUntil = "suspended", &until
+	suspended := request("GET", nil, "").Header().Get("ETag")
+	assert.Equal(t, etag(3, "suspended"), suspended)
+	ended := time.Now().Add(-time.Minute)
+	stored.SuspendedUntil = &ended
+	w = request("GET", map[string]string{"If-None-Match": suspended}, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"active"`)
+	assert.Equal(t, etag(3, "active"), w.Header().Get("ETag"))
+
+	// If-Match must match the current version
+	w = request("PATCH", map[string]string{"If-Match": etag(2, "active")}, `{"name":"Jane"}`)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, http.StatusPreconditionFailed, request("PUT", map[string]string{"If-Match": "W/" + etag(3, "active")}, `{"name":"Jane","email":"jane@example.com","birthDate":"1990-01-01"}`).Code)
+	w = request("PATCH", map[string]string{"If-Match": etag(3, "active")}, `{"name":"Jane"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, etag(4, "active"), w.Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, request("PATCH", map[string]string{"If-Match": "*"}, `{"name":"Jane"}`).Code)
+
+	// Even with "*" the write still fails if the user changed after it was read
+	assert.Equal(t, http.StatusPreconditionFailed, request("PATCH", map[string]string{"If-Match": "*"}, `{"name":"Racing"}`).Code)
+
+	// Changes to /users/:id require If-Match
+	for _, method := range []string{"PUT", "PATCH", "DELETE"} {
+		w = request(method, nil, `{"name":"Jane","email":"jane@example.com","birthDate":"1990-01-01"}`)
+		assert.Equal(t, http.StatusPreconditionRequired, w.Code, method)
+		assert.JSONEq(t, `{"error": "If-Match header is required"}`, w.Body.String())
+	}
+
+	assert.Equal(t, http.StatusPreconditionFailed, request("DELETE", map[string]string{"If-Match": etag(1, "active")}, "").Code)
+	assert.Equal(t, http.StatusNoContent, request("DELETE", map[string]string{"If-Match": etag(3, "active")}, "").Code)
+	assert.Equal(t, uint64(3), deletedVersion)
+
+	// A projection has its own ETag, which is not accepted by If-Match
+	w = request("GET", nil, "")
+	full := w.Header().Get("ETag")
+	req, _ := http.NewRequest("GET", "/api/v1/users/1?fields=name,email", nil)
+	req.Header.Set("Authorization", "Bearer token123")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	projection := w.Header().Get("ETag")
+	assert.NotEqual(t, full, projection)
+	assert.True(t, strings.HasPrefix(projection, `"3-`))
+	req, _ = http.NewRequest("GET", "/api/v1/users/1?fields=email,name", nil)
+	req.Header.Set("Authorization", "Bearer token123")
+	req.Header.Set("If-None-Match", projection)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	req.Header.Set("If-None-Match", full)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusPreconditionFailed, request("PATCH", map[string]string{"If-Match": projection}, `{"name":"Jane"}`).Code)
 }
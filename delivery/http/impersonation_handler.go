@@ -0,0 +1,70 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/middleware"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+func (h *UserHandler) ImpersonateUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	var impersonateRequest struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&impersonateRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	actor, _ := middleware.GetPrincipal(c)
+	tokens, err := h.userUseCase.ImpersonateUser(actor, id, impersonateRequest.Reason, c.ClientIP())
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrImpersonationReason):
+			response.BadRequest(c, err)
+		case errors.Is(err, usecase.ErrImpersonationNotAllowed):
+			response.Error(c, http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrNotFound):
+			response.NotFound(c, err)
+		case errors.Is(err, usecase.ErrInvalidToken):
+			response.StatusUnauthorized(c)
+		default:
+			response.InternalServerError(c, err)
+		}
+		return
+	}
+
+	response.Success(c, http.StatusOK, tokens)
+}
+
+func (h *UserHandler) ListImpersonationSessions(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		response.BadRequest(c, errors.New("page must be a positive integer"))
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "100"))
+	if err != nil || pageSize < 1 {
+		response.BadRequest(c, errors.New("pageSize must be a positive integer"))
+		return
+	}
+
+	sessions, err := h.userUseCase.ListImpersonationSessions(page, pageSize)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, sessions)
+}
@@ -0,0 +1,189 @@
+package http
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+// Tamanho máximo do arquivo de importação
+const maxImportBytes = 32 << 20
+
+var errUnsupportedImportFormat = errors.New("import format must be csv or ndjson")
+
+// Colunas do CSV de importação; as demais, exceto as de endereço, são obrigatórias
+var importRequiredColumns = []string{"name", "email", "password", "birthDate"}
+
+// Importa usuários de um arquivo CSV (com cabeçalho) ou NDJSON enviado no corpo da requisição
+func (h *UserHandler) ImportUsers(c *gin.Context) {
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dryRun", "false"))
+	if err != nil {
+		response.BadRequest(c, errors.New("dryRun must be a boolean"))
+		return
+	}
+
+	format, err := importFormat(c)
+	if err != nil {
+		response.Error(c, http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	var rows []usecase.ImportUserData
+	if format == "csv" {
+		rows, err = parseImportCSV(body)
+	} else {
+		rows, err = parseImportNDJSON(body)
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			response.Error(c, http.StatusRequestEntityTooLarge, gin.H{"error": "import file is too large"})
+			return
+		}
+		response.BadRequest(c, err)
+		return
+	}
+
+	report, err := h.userUseCase.ImportUsers(rows, dryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrEmptyImport):
+			response.BadRequest(c, err)
+		case errors.Is(err, usecase.ErrImportTooLarge):
+			response.Error(c, http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		default:
+			response.InternalServerError(c, err)
+		}
+		return
+	}
+
+	response.Success(c, http.StatusOK, report)
+}
+
+// O formato vem de ?format= ou, na falta dele, do Content-Type
+func importFormat(c *gin.Context) (string, error) {
+	if format := c.Query("format"); format != "" {
+		if format != "csv" && format != "ndjson" {
+			return "", errUnsupportedImportFormat
+		}
+		return format, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return "csv", nil
+	case "application/x-ndjson", "application/ndjson", "application/jsonl":
+		return "ndjson", nil
+	}
+	return "", errUnsupportedImportFormat
+}
+
+func parseImportCSV(body io.Reader) ([]usecase.ImportUserData, error) {
+	reader := csv.NewReader(body)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(name)] = i
+	}
+	for _, name := range importRequiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing CSV column %q", name)
+		}
+	}
+	value := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var rows []usecase.ImportUserData
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		line, _ := reader.FieldPos(0)
+
+		// Linhas com quantidade errada de colunas são reportadas; erros de sintaxe interrompem a leitura
+		if err != nil {
+			if !errors.Is(err, csv.ErrFieldCount) {
+				return nil, err
+			}
+			rows = append(rows, usecase.ImportUserData{Line: line, Err: errors.New("wrong number of columns")})
+			continue
+		}
+
+		row := usecase.ImportUserData{
+			Line: line,
+			CreateUserData: usecase.CreateUserData{
+				Name:      value(record, "name"),
+				Email:     value(record, "email"),
+				Password:  value(record, "password"),
+				BirthDate: value(record, "birthDate"),
+			},
+			Profile: value(record, "profile"),
+		}
+		address := entity.Address{
+			Street:  value(record, "street"),
+			City:    value(record, "city"),
+			State:   value(record, "state"),
+			Country: value(record, "country"),
+		}
+		if address != (entity.Address{}) {
+			row.Address = &address
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Cada linha não vazia é um objeto JSON no formato de POST /users, com o campo opcional "profile"
+func parseImportNDJSON(body io.Reader) ([]usecase.ImportUserData, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []usecase.ImportUserData
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var input struct {
+			usecase.CreateUserData
+			Profile string `json:"profile"`
+		}
+		row := usecase.ImportUserData{Line: line}
+		if err := json.Unmarshal([]byte(text), &input); err != nil {
+			row.Err = fmt.Errorf("invalid JSON: %v", err)
+		} else {
+			row.CreateUserData, row.Profile = input.CreateUserData, input.Profile
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
@@ -0,0 +1,300 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	errInvalidPatch    = errors.New("invalid patch")
+	errPatchTestFailed = errors.New("patch test operation failed")
+)
+
+// Aplica um JSON Merge Patch (RFC 7396): null remove o campo, objetos são mesclados e os demais valores substituem o atual
+func applyMergePatch(document, patch []byte) ([]byte, error) {
+	var target, changes interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+	return json.Marshal(mergePatch(target, changes))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergePatch(targetObject[key], value)
+	}
+	return targetObject
+}
+
+type patchOperation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from"`
+	// Ausente quando a operação não informa value; um null explícito chega como "null"
+	Value json.RawMessage `json:"value"`
+}
+
+// Aplica um JSON Patch (RFC 6902). As operações são aplicadas em ordem e a primeira falha descarta todo o patch
+func applyJSONPatch(document, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	var operations []patchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+
+	for i, operation := range operations {
+		var err error
+		if target, err = operation.apply(target); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, operation.Op, operation.Path, err)
+		}
+	}
+	return json.Marshal(target)
+}
+
+func (o patchOperation) apply(document interface{}) (interface{}, error) {
+	path, err := parsePointer(o.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o.Op {
+	case "add", "replace", "test":
+		if o.Value == nil {
+			return nil, fmt.Errorf("%w: value is required", errInvalidPatch)
+		}
+		var value interface{}
+		if err := json.Unmarshal(o.Value, &value); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+		}
+
+		switch o.Op {
+		case "add":
+			return addValue(document, path, value)
+		case "replace":
+			return replaceValue(document, path, value)
+		}
+		current, err := getValue(document, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, errPatchTestFailed
+		}
+		return document, nil
+
+	case "remove":
+		document, _, err := removeValue(document, path)
+		return document, err
+
+	case "move", "copy":
+		from, err := parsePointer(o.From)
+		if err != nil {
+			return nil, err
+		}
+		if o.Op == "move" {
+			if strings.HasPrefix(o.Path, o.From+"/") {
+				return nil, fmt.Errorf("%w: a value cannot be moved into one of its children", errInvalidPatch)
+			}
+			document, value, err := removeValue(document, from)
+			if err != nil {
+				return nil, err
+			}
+			return addValue(document, path, value)
+		}
+
+		value, err := getValue(document, from)
+		if err != nil {
+			return nil, err
+		}
+		// A cópia não pode compartilhar objetos com a origem, que ainda pode ser alterada por outras operações
+		copied, err := deepCopy(value)
+		if err != nil {
+			return nil, err
+		}
+		return addValue(document, path, copied)
+	}
+
+	return nil, fmt.Errorf("%w: unknown operation %q", errInvalidPatch, o.Op)
+}
+
+// Converte um JSON Pointer (RFC 6901) em seus segmentos. O ponteiro vazio indica o documento inteiro
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("%w: path %q must start with /", errInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func getValue(document interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := document.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: path not found", errInvalidPatch)
+			}
+			document = value
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			document = node[i]
+		default:
+			return nil, fmt.Errorf("%w: path not found", errInvalidPatch)
+		}
+	}
+	return document, nil
+}
+
+func addValue(document interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return changeParent(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[i+1:], node[i:])
+			node[i] = value
+			return node, nil
+		}
+		return nil, fmt.Errorf("%w: path not found", errInvalidPatch)
+	})
+}
+
+func replaceValue(document interface{}, path []string, value interface{}) (interface{}, error) {
+	document, _, err := removeValue(document, path)
+	if err != nil {
+		return nil, err
+	}
+	return addValue(document, path, value)
+}
+
+// Remove o valor do caminho e o retorna
+func removeValue(document interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, document, nil
+	}
+
+	var removed interface{}
+	document, err := changeParent(document, path, func(parent interface{}, token string) (interface{}, error) {
+		switch node := parent.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: path not found", errInvalidPatch)
+			}
+			removed = value
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			i, err := arrayIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = node[i]
+			return append(node[:i], node[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: path not found", errInvalidPatch)
+	})
+	return document, removed, err
+}
+
+// Percorre o caminho até o pai do último segmento e aplica a alteração, devolvendo o documento atualizado.
+// Arrays podem mudar de tamanho, então cada nível grava de volta o filho alterado
+func changeParent(document interface{}, path []string, change func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return change(document, path[0])
+	}
+
+	switch node := document.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: path not found", errInvalidPatch)
+		}
+		updated, err := changeParent(child, path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = updated
+		return node, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := changeParent(node[i], path[1:], change)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = updated
+		return node, nil
+	}
+	return nil, fmt.Errorf("%w: path not found", errInvalidPatch)
+}
+
+// Índices não podem ter zeros à esquerda; "-" indica a posição após o último item e só é aceito ao adicionar
+func arrayIndex(token string, length int, adding bool) (int, error) {
+	if token == "-" && adding {
+		return length, nil
+	}
+
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || strconv.Itoa(i) != token {
+		return 0, fmt.Errorf("%w: invalid array index %q", errInvalidPatch, token)
+	}
+	if i > length || (i == length && !adding) {
+		return 0, fmt.Errorf("%w: array index %d out of bounds", errInvalidPatch, i)
+	}
+	return i, nil
+}
+
+func deepCopy(value interface{}) (interface{}, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var copied interface{}
+	err = json.Unmarshal(encoded, &copied)
+	return copied, err
+}
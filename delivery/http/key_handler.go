@@ -0,0 +1,23 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/security"
+)
+
+type KeyHandler struct {
+	keyManager *security.KeyManager
+}
+
+func NewKeyHandler(keyManager *security.KeyManager) *KeyHandler {
+	return &KeyHandler{keyManager: keyManager}
+}
+
+func (h *KeyHandler) JWKS(c *gin.Context) {
+	// As chaves mudam raramente, permitindo que os clientes mantenham o conjunto em cache
+	c.Header("Cache-Control", "public, max-age=300")
+	response.Success(c, http.StatusOK, h.keyManager.JWKS())
+}
@@ -0,0 +1,153 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+type OAuthHandler struct {
+	oauthUseCase usecase.OAuthClientUseCase
+}
+
+func NewOAuthHandler(oauthUseCase usecase.OAuthClientUseCase) *OAuthHandler {
+	return &OAuthHandler{oauthUseCase: oauthUseCase}
+}
+
+// Endpoint de token OAuth2 (RFC 6749), suportando somente o grant client_credentials
+func (h *OAuthHandler) Token(c *gin.Context) {
+	// Respostas de token nunca devem ser armazenadas em cache (seção 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	if c.ContentType() != "application/x-www-form-urlencoded" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "content type must be application/x-www-form-urlencoded")
+		return
+	}
+
+	grantType := c.PostForm("grant_type")
+	if grantType == "" {
+		oauthError(c, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	}
+	if grantType != "client_credentials" {
+		oauthError(c, http.StatusBadRequest, "unsupported_grant_type", "only client_credentials is supported")
+		return
+	}
+
+	// As credenciais podem vir no cabeçalho Authorization (Basic) ou no corpo, mas não em ambos
+	clientID, clientSecret, basicAuth := c.Request.BasicAuth()
+	if basicAuth {
+		if c.PostForm("client_id") != "" || c.PostForm("client_secret") != "" {
+			oauthError(c, http.StatusBadRequest, "invalid_request", "multiple client authentication methods")
+			return
+		}
+		// No esquema Basic as credenciais são codificadas como application/x-www-form-urlencoded (seção 2.3.1)
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = c.PostForm("client_id"), c.PostForm("client_secret")
+	}
+
+	if clientID == "" || clientSecret == "" {
+		oauthInvalidClient(c, basicAuth)
+		return
+	}
+
+	token, err := h.oauthUseCase.IssueClientToken(clientID, clientSecret, strings.Fields(c.PostForm("scope")))
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidClient):
+			oauthInvalidClient(c, basicAuth)
+		case errors.Is(err, usecase.ErrInvalidScope):
+			oauthError(c, http.StatusBadRequest, "invalid_scope", err.Error())
+		default:
+			oauthError(c, http.StatusInternalServerError, "server_error", err.Error())
+		}
+		return
+	}
+
+	response.Success(c, http.StatusOK, token)
+}
+
+func (h *OAuthHandler) RegisterClient(c *gin.Context) {
+	var registerRequest struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	if err := c.ShouldBindJSON(&registerRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if registerRequest.Name == "" {
+		response.BadRequest(c, errors.New("name is required"))
+		return
+	}
+
+	client, err := h.oauthUseCase.RegisterClient(registerRequest.Name, registerRequest.Scopes)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidScope) {
+			response.BadRequest(c, err)
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	// O segredo é exibido somente nesta resposta
+	response.Success(c, http.StatusCreated, client)
+}
+
+func (h *OAuthHandler) ListClients(c *gin.Context) {
+	clients, err := h.oauthUseCase.ListClients()
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, clients)
+}
+
+func (h *OAuthHandler) RevokeClient(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if err := h.oauthUseCase.RevokeClient(id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(c, err)
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.NoContent(c)
+}
+
+// Resposta de erro no formato da RFC 6749 (seção 5.2)
+func oauthError(c *gin.Context, status int, code, description string) {
+	response.Error(c, status, gin.H{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func oauthInvalidClient(c *gin.Context, basicAuth bool) {
+	// Clientes que tentaram o esquema Basic recebem o desafio correspondente
+	if basicAuth {
+		c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	oauthError(c, http.StatusUnauthorized, "invalid_client", usecase.ErrInvalidClient.Error())
+}
@@ -0,0 +1,55 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+// Preenche o cabeçalho Link (RFC 8288) com as páginas vizinhas, mantendo os filtros da requisição
+func setPaginationLinks(c *gin.Context, page *usecase.UserPage, useCursor bool) {
+	pageSize := strconv.Itoa(page.PageSize)
+	var links []string
+	add := func(rel string, params map[string]string) {
+		links = append(links, fmt.Sprintf(`<%s>; rel="%s"`, pageURL(c, params), rel))
+	}
+
+	if useCursor {
+		add("first", map[string]string{"cursor": "", "pageSize": pageSize})
+		if page.PrevCursor != "" {
+			add("prev", map[string]string{"cursor": page.PrevCursor, "pageSize": pageSize})
+		}
+		if page.NextCursor != "" {
+			add("next", map[string]string{"cursor": page.NextCursor, "pageSize": pageSize})
+		}
+	} else {
+		lastPage := int((page.Total + int64(page.PageSize) - 1) / int64(page.PageSize))
+		if lastPage < 1 {
+			lastPage = 1
+		}
+
+		add("first", map[string]string{"page": "1", "pageSize": pageSize})
+		if page.Page > 1 {
+			add("prev", map[string]string{"page": strconv.Itoa(page.Page - 1), "pageSize": pageSize})
+		}
+		if page.Page < lastPage {
+			add("next", map[string]string{"page": strconv.Itoa(page.Page + 1), "pageSize": pageSize})
+		}
+		add("last", map[string]string{"page": strconv.Itoa(lastPage), "pageSize": pageSize})
+	}
+
+	c.Header("Link", strings.Join(links, ", "))
+}
+
+func pageURL(c *gin.Context, params map[string]string) string {
+	url := *c.Request.URL
+	query := url.Query()
+	for key, value := range params {
+		query.Set(key, value)
+	}
+	url.RawQuery = query.Encode()
+	return url.RequestURI()
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var forgotRequest struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&forgotRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if forgotRequest.Email == "" {
+		response.BadRequest(c, errors.New("email is required"))
+		return
+	}
+
+	if err := h.userUseCase.RequestPasswordReset(forgotRequest.Email); err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	// A resposta é a mesma para e-mails cadastrados ou não
+	response.Success(c, http.StatusAccepted, gin.H{
+		"message": "Se o e-mail estiver cadastrado, as instruções para redefinir a senha serão enviadas",
+	})
+}
+
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var resetRequest struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+
+	if err := c.ShouldBindJSON(&resetRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if resetRequest.Token == "" || resetRequest.Password == "" {
+		response.BadRequest(c, errors.New("token and password are required"))
+		return
+	}
+
+	err := h.userUseCase.ResetPassword(resetRequest.Token, resetRequest.Password)
+	if err != nil {
+		if errors.Is(err, usecase.ErrInvalidResetToken) || errors.Is(err, entity.ErrPasswordTooShort) {
+			response.BadRequest(c, err)
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.NoContent(c)
+}
+
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	var changeRequest struct {
+		CurrentPassword string `json:"currentPassword"`
+		NewPassword     string `json:"newPassword"`
+	}
+
+	if err := c.ShouldBindJSON(&changeRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if changeRequest.CurrentPassword == "" || changeRequest.NewPassword == "" {
+		response.BadRequest(c, errors.New("currentPassword and newPassword are required"))
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+
+	tokens, err := h.userUseCase.ChangePassword(userID, changeRequest.CurrentPassword, changeRequest.NewPassword)
+	if err != nil {
+		if respondLoginThrottled(c, err) {
+			return
+		}
+		if errors.Is(err, usecase.ErrInvalidCurrentPassword) || errors.Is(err, entity.ErrPasswordTooShort) {
+			response.BadRequest(c, err)
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, tokens)
+}
@@ -0,0 +1,180 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+type RoleHandler struct {
+	roleUseCase usecase.RoleUseCase
+}
+
+func NewRoleHandler(roleUseCase usecase.RoleUseCase) *RoleHandler {
+	return &RoleHandler{roleUseCase: roleUseCase}
+}
+
+func (h *RoleHandler) ListRoles(c *gin.Context) {
+	roles, err := h.roleUseCase.ListRoles()
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, roles)
+}
+
+func (h *RoleHandler) ListPermissions(c *gin.Context) {
+	permissions, err := h.roleUseCase.ListPermissions()
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, permissions)
+}
+
+func (h *RoleHandler) CreateRole(c *gin.Context) {
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	role, err := h.roleUseCase.CreateRole(input.Name, input.Description, input.Permissions)
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusCreated, role)
+}
+
+func (h *RoleHandler) UpdateRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	// O nome do papel não pode ser alterado, pois os perfis fazem referência a ele
+	var input struct {
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	role, err := h.roleUseCase.UpdateRole(id, input.Description, input.Permissions)
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, role)
+}
+
+func (h *RoleHandler) DeleteRole(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if err := h.roleUseCase.DeleteRole(id); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	response.NoContent(c)
+}
+
+func (h *RoleHandler) GetUserRoles(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	roles, err := h.roleUseCase.GetUserRoles(userID)
+	if err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, roles)
+}
+
+func (h *RoleHandler) AssignRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	var input struct {
+		RoleID uint64 `json:"roleId"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+	if input.RoleID == 0 {
+		response.BadRequest(c, errors.New("roleId is required"))
+		return
+	}
+
+	if err := h.roleUseCase.AssignRole(userID, input.RoleID); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	response.NoContent(c)
+}
+
+func (h *RoleHandler) RemoveRole(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+	roleID, err := strconv.ParseUint(c.Param("roleId"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if err := h.roleUseCase.RemoveRole(userID, roleID); err != nil {
+		respondRoleError(c, err)
+		return
+	}
+
+	response.NoContent(c)
+}
+
+func respondRoleError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		response.NotFound(c, err)
+	case errors.Is(err, usecase.ErrRoleNameTaken):
+		response.Error(c, http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrBuiltinRole):
+		response.Error(c, http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrUnknownPermission), errors.Is(err, entity.ErrInvalidRoleName):
+		response.BadRequest(c, err)
+	default:
+		response.InternalServerError(c, err)
+	}
+}
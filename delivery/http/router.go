@@ -3,27 +3,61 @@ package http
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/middleware"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/security"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
 )
 
 type Router struct {
-	authHandler *AuthHandler
-	userHandler *UserHandler
+	authHandler    *AuthHandler
+	userHandler    *UserHandler
+	keyHandler     *KeyHandler
+	oauthHandler   *OAuthHandler
+	roleHandler    *RoleHandler
+	tokenValidator middleware.TokenValidator
 }
 
-func NewRouter(userUseCase usecase.UserUseCase) *Router {
+func NewRouter(userUseCase usecase.UserUseCase, oauthUseCase usecase.OAuthClientUseCase, roleUseCase usecase.RoleUseCase, keyManager *security.KeyManager) *Router {
 	authHandler := NewAuthHandler(userUseCase)
 	userHandler := NewUserHandler(userUseCase)
+	keyHandler := NewKeyHandler(keyManager)
+	oauthHandler := NewOAuthHandler(oauthUseCase)
+	roleHandler := NewRoleHandler(roleUseCase)
 
 	return &Router{
-		authHandler: authHandler,
-		userHandler: userHandler,
+		authHandler:    authHandler,
+		userHandler:    userHandler,
+		keyHandler:     keyHandler,
+		oauthHandler:   oauthHandler,
+		roleHandler:    roleHandler,
+		tokenValidator: userUseCase,
 	}
 }
 
 func (r *Router) RegisterRoutes() *gin.Engine {
 	router := gin.Default()
 
+	// Anotações do Swagger para a rota de chaves públicas
+	// @Summary Chaves públicas (JWKS)
+	// @Description Retorna as chaves públicas usadas para verificar a assinatura dos tokens
+	// @Tags Auth
+	// @Produce json
+	// @Success 200 {object} security.JWKS
+	// @Router /.well-known/jwks.json [get]
+	router.GET("/.well-known/jwks.json", r.keyHandler.JWKS)
+
+	// Anotações do Swagger para a rota de token OAuth2
+	// @Summary Token OAuth2 (client_credentials)
+	// @Description Emite um token de acesso para um cliente registrado. As credenciais podem ser enviadas via HTTP Basic ou nos campos client_id e client_secret
+	// @Tags OAuth
+	// @Accept x-www-form-urlencoded
+	// @Produce json
+	// @Param grant_type formData string true "Deve ser client_credentials"
+	// @Param scope formData string false "Escopos solicitados, separados por espaço"
+	// @Success 200 {object} usecase.ClientToken
+	// @Router /oauth/token [post]
+	router.POST("/oauth/token", r.oauthHandler.Token)
+
 	v1 := router.Group("/api/v1")
 	{
 		// Anotações do Swagger para a rota de login
@@ -37,6 +71,80 @@ func (r *Router) RegisterRoutes() *gin.Engine {
 		// @Router /api/v1/login [post]
 		v1.POST("/login", r.authHandler.Login)
 
+		// Anotações do Swagger para a rota de segundo fator do login
+		// @Summary Concluir login com dois fatores
+		// @Description Troca o desafio retornado pelo login por um par de tokens, mediante um código TOTP ou de recuperação
+		// @Tags Auth
+		// @Accept json
+		// @Produce json
+		// @Param input body TwoFactorLoginInput true "Desafio e código"
+		// @Success 200 {object} TokenResponse
+		// @Router /api/v1/login/2fa [post]
+		v1.POST("/login/2fa", r.authHandler.LoginTwoFactor)
+
+		// Anotações do Swagger para a rota de renovação de token
+		// @Summary Renovar token
+		// @Description Troca um refresh token válido por um novo par de tokens (rotação). A reutilização de um refresh token já trocado revoga toda a sessão
+		// @Tags Auth
+		// @Accept json
+		// @Produce json
+		// @Param input body RefreshTokenInput true "Refresh token"
+		// @Success 200 {object} TokenResponse
+		// @Router /api/v1/token/refresh [post]
+		v1.POST("/token/refresh", r.authHandler.RefreshToken)
+
+		// Anotações do Swagger para a rota de solicitação de redefinição de senha
+		// @Summary Esqueci minha senha
+		// @Description Envia ao e-mail informado um link de uso único para redefinir a senha
+		// @Tags Auth
+		// @Accept json
+		// @Produce json
+		// @Param input body ForgotPasswordInput true "E-mail do usuário"
+		// @Success 202 {object} MessageResponse
+		// @Router /api/v1/password/forgot [post]
+		v1.POST("/password/forgot", r.authHandler.ForgotPassword)
+
+		// Anotações do Swagger para a rota de redefinição de senha
+		// @Summary Redefinir senha
+		// @Description Define uma nova senha a partir do token recebido por e-mail
+		// @Tags Auth
+		// @Accept json
+		// @Param input body ResetPasswordInput true "Token e nova senha"
+		// @Success 204 "No Content"
+		// @Router /api/v1/password/reset [post]
+		v1.POST("/password/reset", r.authHandler.ResetPassword)
+
+		// Anotações do Swagger para a rota de verificação de e-mail
+		// @Summary Verificar e-mail
+		// @Description Confirma o e-mail do usuário a partir do link enviado no cadastro
+		// @Tags Auth
+		// @Produce json
+		// @Param token query string true "Token de verificação"
+		// @Success 200 {object} MessageResponse
+		// @Router /api/v1/verify-email [get]
+		v1.GET("/verify-email", r.authHandler.VerifyEmail)
+
+		// Anotações do Swagger para a rota de confirmação da troca de e-mail
+		// @Summary Confirmar troca de e-mail
+		// @Description Substitui o e-mail do usuário pelo novo endereço pendente, a partir do link enviado a ele
+		// @Tags Auth
+		// @Produce json
+		// @Param token query string true "Token de confirmação"
+		// @Success 200 {object} MessageResponse
+		// @Router /api/v1/verify-email/change [get]
+		v1.GET("/verify-email/change", r.authHandler.ConfirmEmailChange)
+
+		// Anotações do Swagger para a rota de reenvio da verificação de e-mail
+		// @Summary Reenviar verificação de e-mail
+		// @Description Envia um novo link de verificação para o e-mail informado, se ainda não confirmado
+		// @Tags Auth
+		// @Accept json
+		// @Produce json
+		// @Param input body ResendVerificationInput true "E-mail do usuário"
+		// @Success 202 {object} MessageResponse
+		// @Router /api/v1/verify-email/resend [post]
+		v1.POST("/verify-email/resend", r.authHandler.ResendVerificationEmail)
+
 		// Anotações do Swagger para a rota de criação de usuário
 		// @Summary Criar usuário
 		// @Description Cria um novo usuário
@@ -49,18 +157,216 @@ func (r *Router) RegisterRoutes() *gin.Engine {
 		v1.POST("/users", r.userHandler.CreateUser)
 
 		// Rotas protegidas pelo middleware
-		v1.Use(middleware.AuthMiddleware())
+		v1.Use(middleware.AuthMiddleware(r.tokenValidator))
+
+		// Anotações do Swagger para a rota de logout
+		// @Summary Fazer logout
+		// @Description Revoga o token de acesso atual e, opcionalmente, o refresh token informado ou todas as sessões do usuário
+		// @Tags Auth
+		// @Accept json
+		// @Param input body LogoutInput false "Refresh token e/ou encerramento de todas as sessões"
+		// @Success 204 "No Content"
+		// @Router /api/v1/logout [post]
+		v1.POST("/logout", r.authHandler.Logout)
+
+		// Anotações do Swagger para a rota do próprio usuário
+		// @Summary Obter o próprio usuário
+		// @Description Retorna os dados do usuário autenticado
+		// @Tags Users
+		// @Produce json
+		// @Success 200 {object} UserResponse
+		// @Router /api/v1/users/me [get]
+		v1.GET("/users/me", r.userHandler.GetMe)
+
+		// Anotações do Swagger para a rota de substituição do próprio usuário
+		// @Summary Substituir o próprio usuário
+		// @Description Substitui os dados editáveis do usuário autenticado. Campos ausentes são limpos
+		// @Tags Users
+		// @Accept json
+		// @Produce json
+		// @Param input body usecase.UpdateUserData true "Todos os dados editáveis do usuário"
+		// @Param If-Match header string true "ETag da versão lida; sem ele a resposta é 428 e, se o usuário tiver sido alterado, 412"
+		// @Success 200 {object} UserResponse
+		// @Router /api/v1/users/me [put]
+		v1.PUT("/users/me", r.userHandler.ReplaceMe)
+
+		// Anotações do Swagger para a rota de atualização do próprio usuário
+		// @Summary Atualizar o próprio usuário
+		// @Description Atualiza parcialmente o usuário autenticado com um JSON Merge Patch (RFC 7396) ou um JSON Patch (RFC 6902)
+		// @Tags Users
+		// @Accept application/merge-patch+json
+		// @Accept application/json-patch+json
+		// @Produce json
+		// @Param input body usecase.UpdateUserData true "Campos alterados; null remove o campo"
+		// @Param If-Match header string true "ETag da versão lida; sem ele a resposta é 428 e, se o usuário tiver sido alterado, 412"
+		// @Success 200 {object} UserResponse
+		// @Router /api/v1/users/me [patch]
+		v1.PATCH("/users/me", r.userHandler.UpdateMe)
+
+		// Anotações do Swagger para a rota de exclusão do próprio usuário
+		// @Summary Excluir o próprio usuário
+		// @Description Exclui a conta do usuário autenticado e encerra todas as suas sessões
+		// @Tags Users
+		// @Param If-Match header string true "ETag da versão lida; sem ele a resposta é 428 e, se o usuário tiver sido alterado, 412"
+		// @Success 204 "No Content"
+		// @Router /api/v1/users/me [delete]
+		v1.DELETE("/users/me", middleware.DenyImpersonation(), r.userHandler.DeleteMe)
+
+		// Anotações do Swagger para a rota de troca de senha
+		// @Summary Trocar senha
+		// @Description Troca a senha do usuário autenticado, exigindo a senha atual. As demais sessões são encerradas e um novo par de tokens é retornado
+		// @Tags Users
+		// @Accept json
+		// @Produce json
+		// @Param input body ChangePasswordInput true "Senha atual e nova senha"
+		// @Success 200 {object} TokenResponse
+		// @Router /api/v1/users/me/password [post]
+		v1.POST("/users/me/password", middleware.DenyImpersonation(), middleware.DenyAPIKey(), r.userHandler.ChangePassword)
+
+		// Anotações do Swagger para a rota de cadastro da autenticação em dois fatores
+		// @Summary Iniciar ativação de dois fatores
+		// @Description Gera um novo segredo TOTP e a URI otpauth para o aplicativo autenticador. A ativação só ocorre após a confirmação
+		// @Tags Users
+		// @Produce json
+		// @Success 200 {object} TwoFactorSetupResponse
+		// @Router /api/v1/users/me/2fa/setup [post]
+		v1.POST("/users/me/2fa/setup", middleware.DenyImpersonation(), middleware.DenyAPIKey(), r.userHandler.SetupTwoFactor)
+
+		// Anotações do Swagger para a rota de confirmação da autenticação em dois fatores
+		// @Summary Confirmar ativação de dois fatores
+		// @Description Ativa a autenticação em dois fatores a partir de um código TOTP válido e retorna os códigos de recuperação
+		// @Tags Users
+		// @Accept json
+		// @Produce json
+		// @Param input body TwoFactorCodeInput true "Código TOTP"
+		// @Success 200 {object} RecoveryCodesResponse
+		// @Router /api/v1/users/me/2fa/confirm [post]
+		v1.POST("/users/me/2fa/confirm", middleware.DenyImpersonation(), middleware.DenyAPIKey(), r.userHandler.ConfirmTwoFactor)
+
+		// Anotações do Swagger para a rota de desativação da autenticação em dois fatores
+		// @Summary Desativar dois fatores
+		// @Description Desativa a autenticação em dois fatores mediante um código TOTP ou de recuperação
+		// @Tags Users
+		// @Accept json
+		// @Param input body TwoFactorCodeInput true "Código TOTP ou de recuperação"
+		// @Success 204 "No Content"
+		// @Router /api/v1/users/me/2fa [delete]
+		v1.DELETE("/users/me/2fa", middleware.DenyImpersonation(), middleware.DenyAPIKey(), r.userHandler.DisableTwoFactor)
+
+		// Anotações do Swagger para a rota de criação de chave de API
+		// @Summary Criar chave de API
+		// @Description Cria uma chave de API pessoal para uso em "Authorization: ApiKey <chave>". A chave completa é retornada somente nesta resposta
+		// @Tags API Keys
+		// @Accept json
+		// @Produce json
+		// @Param input body CreateAPIKeyInput true "Nome e expiração opcional da chave"
+		// @Success 201 {object} usecase.CreatedAPIKey
+		// @Router /api/v1/users/me/api-keys [post]
+		v1.POST("/users/me/api-keys", middleware.DenyImpersonation(), middleware.DenyAPIKey(), r.userHandler.CreateAPIKey)
+
+		// Anotações do Swagger para a rota de listagem de chaves de API
+		// @Summary Listar chaves de API
+		// @Description Lista as chaves de API ativas do usuário autenticado, sem o valor da chave
+		// @Tags API Keys
+		// @Produce json
+		// @Success 200 {array} entity.APIKey
+		// @Router /api/v1/users/me/api-keys [get]
+		v1.GET("/users/me/api-keys", middleware.DenyAPIKey(), r.userHandler.ListAPIKeys)
+
+		// Anotações do Swagger para a rota de revogação de chave de API
+		// @Summary Revogar chave de API
+		// @Description Revoga uma chave de API do usuário autenticado
+		// @Tags API Keys
+		// @Param keyId path int true "ID da chave"
+		// @Success 204 "No Content"
+		// @Router /api/v1/users/me/api-keys/{keyId} [delete]
+		v1.DELETE("/users/me/api-keys/:keyId", middleware.DenyImpersonation(), middleware.DenyAPIKey(), r.userHandler.RevokeAPIKey)
+
+		// Anotações do Swagger para a rota de registro de cliente OAuth
+		// @Summary Registrar cliente OAuth
+		// @Description Registra um cliente para acesso entre serviços. O segredo é retornado somente nesta resposta
+		// @Tags OAuth
+		// @Accept json
+		// @Produce json
+		// @Param input body RegisterOAuthClientInput true "Nome e escopos permitidos"
+		// @Success 201 {object} usecase.RegisteredOAuthClient
+		// @Router /api/v1/oauth/clients [post]
+		v1.POST("/oauth/clients", middleware.RequirePermission(entity.PermissionClientsManage), r.oauthHandler.RegisterClient)
+
+		// Anotações do Swagger para a rota de listagem de clientes OAuth
+		// @Summary Listar clientes OAuth
+		// @Description Lista os clientes OAuth ativos
+		// @Tags OAuth
+		// @Produce json
+		// @Success 200 {array} entity.OAuthClient
+		// @Router /api/v1/oauth/clients [get]
+		v1.GET("/oauth/clients", middleware.RequirePermission(entity.PermissionClientsManage), r.oauthHandler.ListClients)
+
+		// Anotações do Swagger para a rota de revogação de cliente OAuth
+		// @Summary Revogar cliente OAuth
+		// @Description Revoga um cliente OAuth, impedindo a emissão de novos tokens
+		// @Tags OAuth
+		// @Param id path int true "ID do cliente"
+		// @Success 204 "No Content"
+		// @Router /api/v1/oauth/clients/{id} [delete]
+		v1.DELETE("/oauth/clients/:id", middleware.RequirePermission(entity.PermissionClientsManage), r.oauthHandler.RevokeClient)
+
+		// Anotações do Swagger para a rota de criação de usuário por administrador
+		// @Summary Criar usuário com perfil
+		// @Description Cria um novo usuário com o perfil informado (admin ou user)
+		// @Tags Users
+		// @Accept json
+		// @Produce json
+		// @Param input body CreateUserWithProfileInput true "Dados e perfil do usuário a ser criado"
+		// @Success 201 {object} UserResponse
+		// @Router /api/v1/admin/users [post]
+		v1.POST("/admin/users", middleware.RequirePermission(entity.PermissionUsersWrite, entity.PermissionRolesManage), r.userHandler.CreateUserWithProfile)
+
+		// Anotações do Swagger para a rota de importação de usuários
+		// @Summary Importar usuários
+		// @Description Cria usuários em massa a partir de um arquivo CSV (com cabeçalho) ou NDJSON. Retorna o resultado de cada linha: created, skipped (e-mail já cadastrado) ou failed, com o motivo. Com dryRun=true nada é gravado
+		// @Tags Users
+		// @Accept text/csv
+		// @Accept application/x-ndjson
+		// @Produce json
+		// @Param dryRun query bool false "Somente valida o arquivo"
+		// @Param format query string false "csv ou ndjson; por padrão é deduzido do Content-Type"
+		// @Success 200 {object} usecase.ImportReport
+		// @Router /api/v1/users/import [post]
+		v1.POST("/users/import", middleware.RequirePermission(entity.PermissionUsersWrite, entity.PermissionRolesManage), r.userHandler.ImportUsers)
+
+		// Anotações do Swagger para a rota de exportação de usuários
+		// @Summary Exportar usuários
+		// @Description Exporta em CSV, NDJSON ou XLSX os usuários que atendem aos mesmos filtros da listagem, em ordem de ID. O arquivo é transmitido à medida que é gerado e nunca inclui senhas
+		// @Tags Users
+		// @Produce text/csv
+		// @Produce application/x-ndjson
+		// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+		// @Param format query string false "csv (padrão), ndjson ou xlsx"
+		// @Success 200 {file} file
+		// @Router /api/v1/users/export [get]
+		v1.GET("/users/export", middleware.RequirePermission(entity.PermissionUsersRead), r.userHandler.ExportUsers)
+
+		// Anotações do Swagger para a rota de listagem de usuários excluídos
+		// @Summary Listar usuários excluídos
+		// @Description Lista os usuários excluídos que ainda podem ser restaurados, do mais recente para o mais antigo. Possui paginação
+		// @Tags Users
+		// @Produce json
+		// @Success 200 {array} UserResponse
+		// @Router /api/v1/users/deleted [get]
+		v1.GET("/users/deleted", middleware.RequirePermission(entity.PermissionUsersDelete), r.userHandler.GetDeletedUsers)
 
 		// Anotações do Swagger para a rota de busca de usuário por ID
 		// @Summary Obter usuário por ID
-		// @Description Retorna um usuário com base no ID fornecido
+		// @Description Retorna um usuário com base no ID fornecido. Usuários sem a permissão users:read só podem consultar a si mesmos
 		// @Tags Users
 		// @Accept json
 		// @Produce json
 		// @Param id path int true "ID do usuário"
+		// @Param If-None-Match header string false "ETag já conhecido; se ainda for o atual, a resposta é 304"
 		// @Success 200 {object} UserResponse
 		// @Router /api/v1/users/{id} [get]
-		v1.GET("/users/:id", r.userHandler.GetUserByID)
+		v1.GET("/users/:id", middleware.RequireOwnerOrPermission("id", entity.PermissionUsersRead), r.userHandler.GetUserByID)
 
 		// Anotações do Swagger para a rota de busca de todos os usuários
 		// @Summary Obter todos os usuários
@@ -70,38 +376,199 @@ func (r *Router) RegisterRoutes() *gin.Engine {
 		// @Produce json
 		// @Success 200 {array} UserResponse
 		// @Router /api/v1/users [get]
-		v1.GET("/users", r.userHandler.GetAllUsers)
+		v1.GET("/users", middleware.RequirePermission(entity.PermissionUsersRead), r.userHandler.GetAllUsers)
 
-		// Anotações do Swagger para a rota de atualização de usuário
-		// @Summary Atualizar usuário
-		// @Description Atualiza as informações de um usuário existente
+		// Anotações do Swagger para a rota de substituição de usuário
+		// @Summary Substituir usuário
+		// @Description Substitui os dados editáveis de um usuário existente. Campos ausentes são limpos. Usuários sem a permissão users:write só podem substituir a si mesmos
 		// @Tags Users
 		// @Accept json
 		// @Produce json
 		// @Param id path int true "ID do usuário"
-		// @Param input body UpdateUserInput true "Novos dados do usuário"
+		// @Param input body usecase.UpdateUserData true "Todos os dados editáveis do usuário"
+		// @Param If-Match header string true "ETag da versão lida; sem ele a resposta é 428 e, se o usuário tiver sido alterado, 412"
 		// @Success 200 {object} UserResponse
 		// @Router /api/v1/users/{id} [put]
-		v1.PATCH("/users/:id", middleware.AdminOnlyMiddleware(), r.userHandler.UpdateUser)
+		v1.PUT("/users/:id", middleware.RequireOwnerOrPermission("id", entity.PermissionUsersWrite), r.userHandler.ReplaceUser)
+
+		// Anotações do Swagger para a rota de atualização de usuário
+		// @Summary Atualizar usuário
+		// @Description Atualiza parcialmente um usuário existente com um JSON Merge Patch (RFC 7396) ou, com o Content-Type application/json-patch+json, um JSON Patch (RFC 6902). Usuários sem a permissão users:write só podem atualizar a si mesmos
+		// @Tags Users
+		// @Accept application/merge-patch+json
+		// @Accept application/json-patch+json
+		// @Produce json
+		// @Param id path int true "ID do usuário"
+		// @Param input body usecase.UpdateUserData true "Campos alterados; null remove o campo"
+		// @Param If-Match header string true "ETag da versão lida; sem ele a resposta é 428 e, se o usuário tiver sido alterado, 412"
+		// @Success 200 {object} UserResponse
+		// @Router /api/v1/users/{id} [patch]
+		v1.PATCH("/users/:id", middleware.RequireOwnerOrPermission("id", entity.PermissionUsersWrite), r.userHandler.UpdateUser)
 
 		// Anotações do Swagger para a rota de exclusão de usuário
 		// @Summary Excluir usuário
-		// @Description Exclui um usuário existente
+		// @Description Exclui um usuário existente. Usuários sem a permissão users:delete só podem excluir a si mesmos
 		// @Tags Users
 		// @Accept json
 		// @Produce json
 		// @Param id path int true "ID do usuário"
+		// @Param If-Match header string true "ETag da versão lida; sem ele a resposta é 428 e, se o usuário tiver sido alterado, 412"
 		// @Success 204 "No Content"
 		// @Router /api/v1/users/{id} [delete]
-		v1.DELETE("/users/:id", middleware.AdminOnlyMiddleware(), r.userHandler.DeleteUser)
+		v1.DELETE("/users/:id", middleware.DenyImpersonation(), middleware.RequireOwnerOrPermission("id", entity.PermissionUsersDelete), r.userHandler.DeleteUser)
+
+		// Anotações do Swagger para a rota de restauração de usuário
+		// @Summary Restaurar usuário
+		// @Description Desfaz a exclusão de um usuário ainda não expurgado. As sessões encerradas na exclusão não são restauradas
+		// @Tags Users
+		// @Produce json
+		// @Param id path int true "ID do usuário"
+		// @Success 200 {object} UserResponse
+		// @Router /api/v1/users/{id}/restore [post]
+		v1.POST("/users/:id/restore", middleware.RequirePermission(entity.PermissionUsersDelete), r.userHandler.RestoreUser)
+
+		// Anotações do Swagger para a rota de desbloqueio de usuário
+		// @Summary Desbloquear usuário
+		// @Description Remove o bloqueio temporário de login e as falhas acumuladas da conta
+		// @Tags Users
+		// @Param id path int true "ID do usuário"
+		// @Success 204 "No Content"
+		// @Router /api/v1/users/{id}/unlock [post]
+		v1.POST("/users/:id/unlock", middleware.RequirePermission(entity.PermissionUsersWrite), r.userHandler.UnlockUser)
+
+		// Anotações do Swagger para a rota de alteração de perfil
+		// @Summary Alterar perfil do usuário
+		// @Description Promove ou rebaixa o usuário (admin ou user). O último administrador não pode ser rebaixado
+		// @Tags Users
+		// @Accept json
+		// @Produce json
+		// @Param id path int true "ID do usuário"
+		// @Param input body ChangeProfileInput true "Novo perfil"
+		// @Success 200 {object} UserResponse
+		// @Router /api/v1/users/{id}/profile [put]
+		v1.PUT("/users/:id/profile", middleware.RequirePermission(entity.PermissionRolesManage), r.userHandler.ChangeUserProfile)
+
+		// Anotações do Swagger para a rota de situação da conta
+		// @Summary Alterar situação do usuário
+		// @Description Ativa, suspende (com motivo e prazo opcional) ou desativa a conta. Contas suspensas ou desativadas não fazem login e têm as sessões encerradas
+		// @Tags Users
+		// @Accept json
+		// @Produce json
+		// @Param id path int true "ID do usuário"
+		// @Param input body ChangeStatusInput true "Situação, motivo e prazo da suspensão"
+		// @Success 200 {object} UserResponse
+		// @Router /api/v1/users/{id}/status [put]
+		v1.PUT("/users/:id/status", middleware.RequirePermission(entity.PermissionUsersWrite), r.userHandler.ChangeUserStatus)
+
+		// Anotações do Swagger para a rota de personificação
+		// @Summary Personificar usuário
+		// @Description Emite um token de curta duração para agir como o usuário, com o claim "act" identificando o administrador. Troca de senha, exclusão e alterações de credenciais são bloqueadas com esse token. Cada sessão é registrada
+		// @Tags Users
+		// @Accept json
+		// @Produce json
+		// @Param id path int true "ID do usuário"
+		// @Param input body ImpersonateInput true "Motivo da personificação"
+		// @Success 200 {object} TokenResponse
+		// @Router /api/v1/users/{id}/impersonate [post]
+		v1.POST("/users/:id/impersonate", middleware.DenyImpersonation(), middleware.RequirePermission(entity.PermissionImpersonate), r.userHandler.ImpersonateUser)
+
+		// Anotações do Swagger para a rota de auditoria de personificações
+		// @Summary Listar personificações
+		// @Description Lista as sessões de personificação, da mais recente para a mais antiga. Possui paginação
+		// @Tags Users
+		// @Produce json
+		// @Success 200 {array} entity.ImpersonationSession
+		// @Router /api/v1/impersonations [get]
+		v1.GET("/impersonations", middleware.RequirePermission(entity.PermissionImpersonate), r.userHandler.ListImpersonationSessions)
+
+		// Anotações do Swagger para a rota de papéis de um usuário
+		// @Summary Listar papéis do usuário
+		// @Description Lista os papéis atribuídos diretamente ao usuário, além do papel do seu perfil
+		// @Tags Roles
+		// @Produce json
+		// @Param id path int true "ID do usuário"
+		// @Success 200 {array} entity.Role
+		// @Router /api/v1/users/{id}/roles [get]
+		v1.GET("/users/:id/roles", middleware.RequirePermission(entity.PermissionRolesManage), r.roleHandler.GetUserRoles)
+
+		// Anotações do Swagger para a rota de atribuição de papel
+		// @Summary Atribuir papel
+		// @Description Atribui um papel ao usuário. Os tokens de acesso atuais do usuário são revogados para que a renovação traga as novas permissões
+		// @Tags Roles
+		// @Accept json
+		// @Param id path int true "ID do usuário"
+		// @Param input body AssignRoleInput true "ID do papel"
+		// @Success 204 "No Content"
+		// @Router /api/v1/users/{id}/roles [post]
+		v1.POST("/users/:id/roles", middleware.RequirePermission(entity.PermissionRolesManage), r.roleHandler.AssignRole)
+
+		// Anotações do Swagger para a rota de remoção de papel
+		// @Summary Remover papel
+		// @Description Remove um papel atribuído ao usuário
+		// @Tags Roles
+		// @Param id path int true "ID do usuário"
+		// @Param roleId path int true "ID do papel"
+		// @Success 204 "No Content"
+		// @Router /api/v1/users/{id}/roles/{roleId} [delete]
+		v1.DELETE("/users/:id/roles/:roleId", middleware.RequirePermission(entity.PermissionRolesManage), r.roleHandler.RemoveRole)
+
+		// Anotações do Swagger para a rota de listagem de papéis
+		// @Summary Listar papéis
+		// @Description Lista os papéis com suas permissões
+		// @Tags Roles
+		// @Produce json
+		// @Success 200 {array} entity.Role
+		// @Router /api/v1/roles [get]
+		v1.GET("/roles", middleware.RequirePermission(entity.PermissionRolesManage), r.roleHandler.ListRoles)
+
+		// Anotações do Swagger para a rota de criação de papel
+		// @Summary Criar papel
+		// @Description Cria um papel com as permissões informadas
+		// @Tags Roles
+		// @Accept json
+		// @Produce json
+		// @Param input body RoleInput true "Nome, descrição e permissões"
+		// @Success 201 {object} entity.Role
+		// @Router /api/v1/roles [post]
+		v1.POST("/roles", middleware.RequirePermission(entity.PermissionRolesManage), r.roleHandler.CreateRole)
+
+		// Anotações do Swagger para a rota de atualização de papel
+		// @Summary Atualizar papel
+		// @Description Substitui a descrição e as permissões do papel. O papel admin não pode ser alterado
+		// @Tags Roles
+		// @Accept json
+		// @Produce json
+		// @Param id path int true "ID do papel"
+		// @Param input body RoleInput true "Descrição e permissões"
+		// @Success 200 {object} entity.Role
+		// @Router /api/v1/roles/{id} [put]
+		v1.PUT("/roles/:id", middleware.RequirePermission(entity.PermissionRolesManage), r.roleHandler.UpdateRole)
+
+		// Anotações do Swagger para a rota de exclusão de papel
+		// @Summary Excluir papel
+		// @Description Exclui um papel e suas atribuições. Os papéis dos perfis admin e user não podem ser excluídos
+		// @Tags Roles
+		// @Param id path int true "ID do papel"
+		// @Success 204 "No Content"
+		// @Router /api/v1/roles/{id} [delete]
+		v1.DELETE("/roles/:id", middleware.RequirePermission(entity.PermissionRolesManage), r.roleHandler.DeleteRole)
+
+		// Anotações do Swagger para a rota de listagem de permissões
+		// @Summary Listar permissões
+		// @Description Lista as permissões que podem ser concedidas aos papéis
+		// @Tags Roles
+		// @Produce json
+		// @Success 200 {array} entity.Permission
+		// @Router /api/v1/permissions [get]
+		v1.GET("/permissions", middleware.RequirePermission(entity.PermissionRolesManage), r.roleHandler.ListPermissions)
 
 	}
 
 	return router
 }
 
-func SetupRoutes(userUseCase usecase.UserUseCase) *gin.Engine {
-	router := NewRouter(userUseCase)
+func SetupRoutes(userUseCase usecase.UserUseCase, oauthUseCase usecase.OAuthClientUseCase, roleUseCase usecase.RoleUseCase, keyManager *security.KeyManager) *gin.Engine {
+	router := NewRouter(userUseCase, oauthUseCase, roleUseCase, keyManager)
 	r := router.RegisterRoutes()
 
 	return r
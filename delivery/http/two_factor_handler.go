@@ -0,0 +1,140 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
+)
+
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var twoFactorRequest struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&twoFactorRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if twoFactorRequest.ChallengeToken == "" || twoFactorRequest.Code == "" {
+		response.BadRequest(c, errors.New("challengeToken and code are required"))
+		return
+	}
+
+	tokens, err := h.userUseCase.CompleteTwoFactorLogin(twoFactorRequest.ChallengeToken, twoFactorRequest.Code, c.ClientIP())
+	if err != nil {
+		if respondLoginThrottled(c, err) || respondAccountStatus(c, err) {
+			return
+		}
+		if errors.Is(err, usecase.ErrInvalidChallengeToken) || errors.Is(err, usecase.ErrInvalidTwoFactorCode) {
+			response.Error(c, http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, tokens)
+}
+
+func (h *UserHandler) SetupTwoFactor(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+
+	setup, err := h.userUseCase.SetupTwoFactor(userID)
+	if err != nil {
+		if errors.Is(err, usecase.ErrTwoFactorAlreadyEnabled) {
+			response.Error(c, http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusOK, setup)
+}
+
+func (h *UserHandler) ConfirmTwoFactor(c *gin.Context) {
+	var confirmRequest struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&confirmRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if confirmRequest.Code == "" {
+		response.BadRequest(c, errors.New("code is required"))
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+
+	codes, err := h.userUseCase.ConfirmTwoFactor(userID, confirmRequest.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidTwoFactorCode), errors.Is(err, usecase.ErrTwoFactorSetupNotStarted):
+			response.BadRequest(c, err)
+		case errors.Is(err, usecase.ErrTwoFactorAlreadyEnabled):
+			response.Error(c, http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			response.InternalServerError(c, err)
+		}
+		return
+	}
+
+	// Os códigos de recuperação são exibidos somente nesta resposta
+	response.Success(c, http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func (h *UserHandler) DisableTwoFactor(c *gin.Context) {
+	var disableRequest struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&disableRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if disableRequest.Code == "" {
+		response.BadRequest(c, errors.New("code is required"))
+		return
+	}
+
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+
+	err := h.userUseCase.DisableTwoFactor(userID, disableRequest.Code, c.ClientIP())
+	if err != nil {
+		if respondLoginThrottled(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, usecase.ErrInvalidTwoFactorCode), errors.Is(err, usecase.ErrTwoFactorNotEnabled):
+			response.BadRequest(c, err)
+		case errors.Is(err, usecase.ErrTwoFactorRequired):
+			response.Error(c, http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			response.InternalServerError(c, err)
+		}
+		return
+	}
+
+	response.NoContent(c)
+}
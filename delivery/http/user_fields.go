@@ -0,0 +1,75 @@
+package http
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+// Campos do usuário que podem ser escolhidos em ?fields=, com os mesmos nomes do JSON completo
+var userResponseFields = map[string]func(user *UserResponse) interface{}{
+	"id":               func(user *UserResponse) interface{} { return user.ID },
+	"name":             func(user *UserResponse) interface{} { return user.Name },
+	"email":            func(user *UserResponse) interface{} { return user.Email },
+	"birthDate":        func(user *UserResponse) interface{} { return user.BirthDate },
+	"age":              func(user *UserResponse) interface{} { return user.Age },
+	"profile":          func(user *UserResponse) interface{} { return user.Profile },
+	"address":          func(user *UserResponse) interface{} { return user.Address },
+	"emailVerified":    func(user *UserResponse) interface{} { return user.EmailVerified },
+	"pendingEmail":     func(user *UserResponse) interface{} { return user.PendingEmail },
+	"twoFactorEnabled": func(user *UserResponse) interface{} { return user.TwoFactor },
+	"status":           func(user *UserResponse) interface{} { return user.Status },
+	"statusReason":     func(user *UserResponse) interface{} { return user.StatusReason },
+	"suspendedUntil":   func(user *UserResponse) interface{} { return user.SuspendedUntil },
+	"createdAt":        func(user *UserResponse) interface{} { return user.CreatedAt },
+	"deletedAt":        func(user *UserResponse) interface{} { return user.DeletedAt },
+}
+
+// Lê ?fields=id,name,age. Sem o parâmetro, todos os campos são retornados
+func parseFields(c *gin.Context) ([]string, error) {
+	value := c.Query("fields")
+	if value == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if _, ok := userResponseFields[field]; !ok {
+			return nil, fmt.Errorf("%w: %q", repository.ErrInvalidField, field)
+		}
+		if !seen[field] {
+			seen[field] = true
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+// Indica se o campo faz parte da resposta: sem seleção, todos fazem
+func fieldRequested(fields []string, name string) bool {
+	if len(fields) == 0 {
+		return true
+	}
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+func selectResponseFields(user *UserResponse, fields []string) interface{} {
+	if len(fields) == 0 {
+		return user
+	}
+
+	selected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		selected[field] = userResponseFields[field](user)
+	}
+	return selected
+}
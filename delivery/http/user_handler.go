@@ -1,12 +1,22 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/middleware"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
 )
 
@@ -33,6 +43,10 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	// Atribuir a senha criptografada ao usuário
 	createUser.Password = hashedPassword
 	user, err := h.userUseCase.CreateUser(&createUser)
+	if errors.Is(err, usecase.ErrEmailTaken) {
+		response.StatusConflit(c)
+		return
+	}
 	if err != nil {
 		response.InternalServerError(c, err)
 		return
@@ -41,32 +55,192 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 	response.Success(c, http.StatusCreated, mapUserToResponse(user))
 }
 
-func (h *UserHandler) GetUserByID(c *gin.Context) {
+// Cadastro feito por um administrador, com o perfil informado
+func (h *UserHandler) CreateUserWithProfile(c *gin.Context) {
+	var createUser struct {
+		usecase.CreateUserData
+		Profile string `json:"profile"`
+	}
+	if err := c.ShouldBindJSON(&createUser); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if err := entity.ValidateProfile(createUser.Profile); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	emailExists, _ := h.userUseCase.CheckEmailExists(createUser.Email)
+	if emailExists {
+		response.StatusConflit(c)
+		return
+	}
+
+	// Criptografar a senha antes de inserir no banco de dados
+	hashedPassword, err := usecase.HashPassword(createUser.Password)
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	createUser.Password = hashedPassword
+	user, err := h.userUseCase.CreateUserWithProfile(&createUser.CreateUserData, createUser.Profile)
+	if errors.Is(err, usecase.ErrEmailTaken) {
+		response.StatusConflit(c)
+		return
+	}
+	if err != nil {
+		response.InternalServerError(c, err)
+		return
+	}
+
+	response.Success(c, http.StatusCreated, mapUserToResponse(user))
+}
+
+func (h *UserHandler) ChangeUserProfile(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		response.BadRequest(c, err)
 		return
 	}
 
-	user, err := h.userUseCase.GetUserByID(id)
+	var profileRequest struct {
+		Profile string `json:"profile"`
+	}
+	if err := c.ShouldBindJSON(&profileRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if !h.authorizeUserWrite(c, id) {
+		return
+	}
+
+	user, err := h.userUseCase.ChangeUserProfile(id, profileRequest.Profile)
 	if err != nil {
-		response.NotFound(c, err)
+		switch {
+		case errors.Is(err, entity.ErrInvalidProfile):
+			response.BadRequest(c, err)
+		case errors.Is(err, repository.ErrNotFound):
+			response.NotFound(c, err)
+		case errors.Is(err, usecase.ErrLastAdmin):
+			response.Error(c, http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			response.InternalServerError(c, err)
+		}
 		return
 	}
 
-	// Calcula a idade com base na data de nascimento
-	age, err := utils.CalculateAge(user.BirthDate)
+	response.Success(c, http.StatusOK, mapUserToResponse(user))
+}
+
+// Ativa, suspende (com motivo e prazo opcional) ou desativa a conta do usuário
+func (h *UserHandler) ChangeUserStatus(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		response.InternalServerError(c, err)
+		response.BadRequest(c, err)
 		return
 	}
 
-	// Atribui a idade calculada ao usuário
-	user.Age = age
+	var statusRequest struct {
+		Status string     `json:"status"`
+		Reason string     `json:"reason"`
+		Until  *time.Time `json:"until"`
+	}
+	if err := c.ShouldBindJSON(&statusRequest); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	if !h.authorizeUserWrite(c, id) {
+		return
+	}
+
+	user, err := h.userUseCase.ChangeUserStatus(id, statusRequest.Status, statusRequest.Reason, statusRequest.Until)
+	if err != nil {
+		switch {
+		case errors.Is(err, entity.ErrInvalidStatus), errors.Is(err, usecase.ErrInvalidSuspensionEnd):
+			response.BadRequest(c, err)
+		case errors.Is(err, repository.ErrNotFound):
+			response.NotFound(c, err)
+		case errors.Is(err, usecase.ErrInvalidStatusTransition), errors.Is(err, usecase.ErrLastAdmin):
+			response.Error(c, http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			response.InternalServerError(c, err)
+		}
+		return
+	}
 
 	response.Success(c, http.StatusOK, mapUserToResponse(user))
 }
 
+func (h *UserHandler) GetUserByID(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	h.getUser(c, id)
+}
+
+// Retorna o usuário autenticado
+func (h *UserHandler) GetMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+
+	h.getUser(c, userID)
+}
+
+func (h *UserHandler) getUser(c *gin.Context, id uint64) {
+	fields, err := parseFields(c)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	var user *entity.User
+	if len(fields) == 0 {
+		user, err = h.userUseCase.GetUserByID(id)
+	} else {
+		user, err = h.userUseCase.GetUserByIDWithFields(id, fields)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidField) {
+			response.BadRequest(c, err)
+			return
+		}
+		response.NotFound(c, err)
+		return
+	}
+
+	// O cliente já possui a versão atual do usuário
+	etag := userFieldsETag(user, fields)
+	c.Header("ETag", etag)
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" && etagMatches(ifNoneMatch, etag, true) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	// Calcula a idade com base na data de nascimento, quando ela foi solicitada
+	if fieldRequested(fields, "age") {
+		age, err := utils.CalculateAge(user.BirthDate)
+		if err != nil {
+			response.InternalServerError(c, err)
+			return
+		}
+
+		// Atribui a idade calculada ao usuário
+		user.Age = age
+	}
+
+	response.Success(c, http.StatusOK, selectResponseFields(mapUserToResponse(user), fields))
+}
+
 func (h *UserHandler) GetAllUsers(c *gin.Context) {
 	page := c.DefaultQuery("page", "1")
 	pageSize := c.DefaultQuery("pageSize", "100")
@@ -83,71 +257,267 @@ func (h *UserHandler) GetAllUsers(c *gin.Context) {
 		return
 	}
 
-	users, err := h.userUseCase.GetAllUsers(pageInt, pageSizeInt)
+	filter, err := parseUserFilter(c)
 	if err != nil {
-		response.InternalServerError(c, err)
+		response.BadRequest(c, err)
+		return
+	}
+	if filter.Fields, err = parseFields(c); err != nil {
+		response.BadRequest(c, err)
 		return
 	}
 
-	// Mapear e calcular a idade de cada usuário
-	var responseUsers []*UserResponse
-	for _, user := range users {
-		// Calcula a idade com base na data de nascimento
-		age, err := utils.CalculateAge(user.BirthDate)
-		if err != nil {
-			continue
+	// A presença de "cursor" (mesmo vazio) ativa a paginação por cursor; sem ele, vale page/pageSize
+	_, useCursor := c.GetQuery("cursor")
+	pagination := usecase.Pagination{
+		Page:      pageInt,
+		PageSize:  pageSizeInt,
+		Cursor:    c.Query("cursor"),
+		UseCursor: useCursor,
+	}
+
+	userPage, err := h.userUseCase.GetAllUsers(filter, pagination)
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidSort) || errors.Is(err, usecase.ErrInvalidFilter) || errors.Is(err, usecase.ErrInvalidCursor) ||
+			errors.Is(err, repository.ErrInvalidField) {
+			response.BadRequest(c, err)
+			return
 		}
+		response.InternalServerError(c, err)
+		return
+	}
 
+	// Mapear e calcular a idade de cada usuário
+	responseUsers := make([]interface{}, 0, len(userPage.Users))
+	for _, user := range userPage.Users {
 		// Cria um novo objeto ResponseUser
 		responseUser := mapUserToResponse(user)
 
-		// Atribui a idade ao usuário
-		responseUser.Age = age
+		// Calcula a idade com base na data de nascimento, quando ela foi solicitada
+		if fieldRequested(filter.Fields, "age") {
+			age, err := utils.CalculateAge(user.BirthDate)
+			if err != nil {
+				continue
+			}
 
-		// Adiciona o usuário mapeado ao array de responseUsers
-		responseUsers = append(responseUsers, responseUser)
-	}
+			// Atribui a idade ao usuário
+			responseUser.Age = age
+		}
 
-	response.Success(c, http.StatusOK, responseUsers)
+		// Adiciona o usuário mapeado, somente com os campos solicitados, ao array de responseUsers
+		responseUsers = append(responseUsers, selectResponseFields(responseUser, filter.Fields))
+	}
 
+	setPaginationLinks(c, userPage, useCursor)
+	response.Success(c, http.StatusOK, &UserListResponse{
+		Data:       responseUsers,
+		Total:      userPage.Total,
+		Page:       userPage.Page,
+		PageSize:   userPage.PageSize,
+		NextCursor: userPage.NextCursor,
+		PrevCursor: userPage.PrevCursor,
+	})
 }
 
+// Atualiza parcialmente o usuário com um JSON Merge Patch ou, com o Content-Type application/json-patch+json, um JSON Patch
 func (h *UserHandler) UpdateUser(c *gin.Context) {
 	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
 		response.BadRequest(c, err)
 		return
 	}
+	if !requireIfMatch(c) {
+		return
+	}
+	if !h.authorizeUserWrite(c, id) {
+		return
+	}
+
+	h.updateUser(c, id)
+}
+
+// Atualiza os dados do usuário autenticado
+func (h *UserHandler) UpdateMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+	if !requireIfMatch(c) {
+		return
+	}
+
+	h.updateUser(c, userID)
+}
 
+// Substitui todos os dados editáveis do usuário. Campos ausentes são limpos
+func (h *UserHandler) ReplaceUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+	if !requireIfMatch(c) {
+		return
+	}
+	if !h.authorizeUserWrite(c, id) {
+		return
+	}
+
+	h.replaceUser(c, id)
+}
+
+// Substitui os dados do usuário autenticado
+func (h *UserHandler) ReplaceMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+	if !requireIfMatch(c) {
+		return
+	}
+
+	h.replaceUser(c, userID)
+}
+
+func (h *UserHandler) replaceUser(c *gin.Context, id uint64) {
 	user, err := h.userUseCase.GetUserByID(id)
 	if err != nil {
 		response.NotFound(c, err)
 		return
 	}
+	if !checkIfMatch(c, user) {
+		return
+	}
 
-	var updateUser usecase.UpdateUserData
-	if err := c.ShouldBindJSON(&updateUser); err != nil {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
 		response.BadRequest(c, err)
 		return
 	}
 
-	if updateUser.BirthDate != "" {
-		user.BirthDate = updateUser.BirthDate
+	var data usecase.UpdateUserData
+	if err := decodeUserData(body, &data); err != nil {
+		response.BadRequest(c, err)
+		return
 	}
 
-	if updateUser.Address != nil {
-		user.Address = updateUser.Address
+	h.saveUser(c, user, &data)
+}
+
+func (h *UserHandler) updateUser(c *gin.Context, id uint64) {
+	// Sem Content-Type, ou com application/json, o corpo é tratado como JSON Merge Patch
+	mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	var applyPatch func(document, patch []byte) ([]byte, error)
+	switch mediaType {
+	case "", "application/json", "application/merge-patch+json":
+		applyPatch = applyMergePatch
+	case "application/json-patch+json":
+		applyPatch = applyJSONPatch
+	default:
+		response.Error(c, http.StatusUnsupportedMediaType, gin.H{"error": "content type must be application/merge-patch+json or application/json-patch+json"})
+		return
+	}
+
+	user, err := h.userUseCase.GetUserByID(id)
+	if err != nil {
+		response.NotFound(c, err)
+		return
+	}
+	if !checkIfMatch(c, user) {
+		return
 	}
 
-	if updateUser.Email != "" {
-		user.Email = updateUser.Email
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
 	}
 
-	if err := h.userUseCase.UpdateUser(user); err != nil {
+	// O patch é aplicado sobre o documento com os campos editáveis do usuário
+	document, err := json.Marshal(&usecase.UpdateUserData{
+		Name:      user.Name,
+		Email:     user.Email,
+		BirthDate: user.BirthDate,
+		Address:   user.Address,
+	})
+	if err != nil {
 		response.InternalServerError(c, err)
 		return
 	}
 
+	patched, err := applyPatch(document, patch)
+	if err != nil {
+		if errors.Is(err, errPatchTestFailed) {
+			response.Error(c, http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		response.BadRequest(c, err)
+		return
+	}
+
+	var data usecase.UpdateUserData
+	if err := decodeUserData(patched, &data); err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	h.saveUser(c, user, &data)
+}
+
+// Campos desconhecidos ou somente leitura (como profile e status, alterados em rotas próprias) são rejeitados
+func decodeUserData(body []byte, data *usecase.UpdateUserData) error {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(data)
+}
+
+// Alterações em outro usuário são recusadas quando o alvo tem permissões, como as de administrador, que quem as faz não tem
+func (h *UserHandler) authorizeUserWrite(c *gin.Context, id uint64) bool {
+	principal, _ := middleware.GetPrincipal(c)
+	err := h.userUseCase.AuthorizeUserWrite(principal, id)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, usecase.ErrUserWriteNotAllowed):
+		response.Error(c, http.StatusForbidden, gin.H{"error": "Você não tem permissão para alterar este usuário"})
+	case errors.Is(err, repository.ErrNotFound):
+		response.NotFound(c, err)
+	default:
+		response.InternalServerError(c, err)
+	}
+	return false
+}
+
+func (h *UserHandler) saveUser(c *gin.Context, user *entity.User, data *usecase.UpdateUserData) {
+	// O e-mail recebe as redefinições de senha: trocá-lo durante a personificação permitiria tomar a conta
+	if principal, ok := middleware.GetPrincipal(c); ok && principal.IsImpersonated() && !strings.EqualFold(user.Email, data.Email) {
+		response.Error(c, http.StatusForbidden, gin.H{"error": "A alteração do e-mail não é permitida durante a personificação de um usuário"})
+		return
+	}
+
+	user.Name = data.Name
+	user.Email = data.Email
+	user.BirthDate = data.BirthDate
+	user.Address = data.Address
+
+	// A gravação também confere a versão: uma alteração concorrente desde a leitura resulta em 412
+	if err := h.userUseCase.UpdateUser(user); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrInvalidUserData):
+			response.BadRequest(c, err)
+		case errors.Is(err, usecase.ErrEmailTaken):
+			response.Error(c, http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrVersionConflict):
+			respondPreconditionFailed(c)
+		default:
+			response.InternalServerError(c, err)
+		}
+		return
+	}
+
+	c.Header("ETag", userETag(user))
 	response.Success(c, http.StatusOK, mapUserToResponse(user))
 }
 
@@ -157,8 +527,72 @@ func (h *UserHandler) DeleteUser(c *gin.Context) {
 		response.BadRequest(c, err)
 		return
 	}
+	if !requireIfMatch(c) {
+		return
+	}
+	if !h.authorizeUserWrite(c, id) {
+		return
+	}
+
+	h.deleteUser(c, id)
+}
+
+// Exclui a conta do usuário autenticado, encerrando todas as suas sessões
+func (h *UserHandler) DeleteMe(c *gin.Context) {
+	userID, ok := currentUserID(c)
+	if !ok {
+		response.StatusUnauthorized(c)
+		return
+	}
+	if !requireIfMatch(c) {
+		return
+	}
+
+	h.deleteUser(c, userID)
+}
+
+func (h *UserHandler) deleteUser(c *gin.Context, id uint64) {
+	// A exclusão só ocorre se o usuário ainda estiver na versão conferida
+	user, err := h.userUseCase.GetUserByID(id)
+	if err != nil {
+		response.NotFound(c, err)
+		return
+	}
+	if !checkIfMatch(c, user) {
+		return
+	}
+
+	if err := h.userUseCase.DeleteUser(id, user.Version); err != nil {
+		switch {
+		case errors.Is(err, usecase.ErrLastAdmin):
+			response.Error(c, http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, repository.ErrVersionConflict):
+			respondPreconditionFailed(c)
+		default:
+			response.InternalServerError(c, err)
+		}
+		return
+	}
+
+	response.NoContent(c)
+}
+
+func (h *UserHandler) UnlockUser(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
 
-	if err := h.userUseCase.DeleteUser(id); err != nil {
+	if !h.authorizeUserWrite(c, id) {
+		return
+	}
+
+	if err := h.userUseCase.UnlockUser(id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			response.NotFound(c, err)
+			return
+		}
 		response.InternalServerError(c, err)
 		return
 	}
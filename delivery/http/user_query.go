@@ -0,0 +1,82 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+// Monta os filtros da listagem de usuários a partir da query string.
+// Os campos de ordenação são validados pelo repositório, que mantém a lista de campos permitidos
+func parseUserFilter(c *gin.Context) (*repository.UserFilter, error) {
+	filter := &repository.UserFilter{
+		Search:  strings.TrimSpace(c.Query("q")),
+		Name:    strings.TrimSpace(c.Query("name")),
+		Email:   strings.TrimSpace(c.Query("email")),
+		Profile: c.Query("profile"),
+		City:    c.Query("city"),
+		State:   c.Query("state"),
+		Country: c.Query("country"),
+	}
+
+	var err error
+	if filter.MinAge, err = queryAge(c, "minAge"); err != nil {
+		return nil, err
+	}
+	if filter.MaxAge, err = queryAge(c, "maxAge"); err != nil {
+		return nil, err
+	}
+	if filter.CreatedFrom, err = queryTime(c, "createdFrom"); err != nil {
+		return nil, err
+	}
+	if filter.CreatedTo, err = queryTime(c, "createdTo"); err != nil {
+		return nil, err
+	}
+
+	// sort=name,-createdAt: o prefixo "-" indica ordem decrescente
+	if sort := c.Query("sort"); sort != "" {
+		for _, field := range strings.Split(sort, ",") {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			if field == "" {
+				return nil, fmt.Errorf("%w: empty field", repository.ErrInvalidSort)
+			}
+			filter.Sort = append(filter.Sort, repository.UserSort{Field: field, Desc: desc})
+		}
+	}
+
+	return filter, nil
+}
+
+func queryAge(c *gin.Context, key string) (*int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	age, err := strconv.Atoi(value)
+	if err != nil || age < 0 {
+		return nil, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return &age, nil
+}
+
+// Aceita data (YYYY-MM-DD) ou data e hora no formato RFC 3339
+func queryTime(c *gin.Context, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			return &parsed, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be a date (YYYY-MM-DD) or an RFC 3339 timestamp", key)
+}
@@ -0,0 +1,148 @@
+package http
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Limite de linhas de uma planilha do Excel. Ao atingi-lo, as linhas seguintes vão para uma nova planilha
+const xlsxMaxRows = 1048576
+
+// Gera um arquivo XLSX linha a linha, gravando cada planilha diretamente no arquivo ZIP de destino.
+// Os textos são gravados como inline strings, sem tabela de strings compartilhadas, para não manter o conteúdo em memória
+type xlsxWriter struct {
+	archive *zip.Writer
+	header  []string
+	sheet   io.Writer
+	sheets  int
+	rows    int
+}
+
+func newXLSXWriter(w io.Writer, header []string) (*xlsxWriter, error) {
+	x := &xlsxWriter{archive: zip.NewWriter(w), header: header}
+	if err := x.nextSheet(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// Números e booleanos são gravados com o tipo correspondente; os demais valores, como texto
+func (x *xlsxWriter) WriteRow(values []interface{}) error {
+	if x.rows == xlsxMaxRows {
+		if err := x.nextSheet(); err != nil {
+			return err
+		}
+	}
+	return x.writeRow(values)
+}
+
+// Conclui a planilha atual e grava as partes do pacote que dependem da quantidade de planilhas
+func (x *xlsxWriter) Close() error {
+	if err := x.endSheet(); err != nil {
+		return err
+	}
+
+	var overrides, sheets, relationships strings.Builder
+	for i := 1; i <= x.sheets; i++ {
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i)
+		fmt.Fprintf(&sheets, `<sheet name="users%s" sheetId="%d" r:id="rId%d"/>`, sheetSuffix(i), i, i)
+		fmt.Fprintf(&relationships, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, i, i)
+	}
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+			`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+			`<Default Extension="xml" ContentType="application/xml"/>` +
+			`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+			overrides.String() + `</Types>`},
+		{"_rels/.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets>` + sheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			relationships.String() + `</Relationships>`},
+	}
+	for _, part := range parts {
+		w, err := x.archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, xml.Header+part.content); err != nil {
+			return err
+		}
+	}
+
+	return x.archive.Close()
+}
+
+func (x *xlsxWriter) nextSheet() error {
+	if x.sheet != nil {
+		if err := x.endSheet(); err != nil {
+			return err
+		}
+	}
+
+	x.sheets++
+	sheet, err := x.archive.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", x.sheets))
+	if err != nil {
+		return err
+	}
+	x.sheet, x.rows = sheet, 0
+
+	_, err = io.WriteString(x.sheet, xml.Header+`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	if err != nil {
+		return err
+	}
+
+	// Cada planilha repete o cabeçalho
+	header := make([]interface{}, len(x.header))
+	for i, name := range x.header {
+		header[i] = name
+	}
+	return x.writeRow(header)
+}
+
+func (x *xlsxWriter) endSheet() error {
+	_, err := io.WriteString(x.sheet, `</sheetData></worksheet>`)
+	return err
+}
+
+func (x *xlsxWriter) writeRow(values []interface{}) error {
+	var row strings.Builder
+	row.WriteString("<row>")
+	for _, value := range values {
+		switch v := value.(type) {
+		case int, uint64:
+			fmt.Fprintf(&row, `<c><v>%d</v></c>`, v)
+		case bool:
+			cell := 0
+			if v {
+				cell = 1
+			}
+			fmt.Fprintf(&row, `<c t="b"><v>%d</v></c>`, cell)
+		default:
+			row.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			// Caracteres inválidos em XML são substituídos, sem interromper a exportação
+			_ = xml.EscapeText(&row, []byte(fmt.Sprint(v)))
+			row.WriteString(`</t></is></c>`)
+		}
+	}
+	row.WriteString("</row>")
+
+	if _, err := io.WriteString(x.sheet, row.String()); err != nil {
+		return err
+	}
+	x.rows++
+	return nil
+}
+
+func sheetSuffix(sheet int) string {
+	if sheet == 1 {
+		return ""
+	}
+	return fmt.Sprintf(" %d", sheet)
+}
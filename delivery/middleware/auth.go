@@ -1,17 +1,25 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/response"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+// Responsável por validar as credenciais recebidas: tokens de acesso (assinatura, expiração e revogação) e chaves de API
+type TokenValidator interface {
+	ValidateAccessToken(tokenString string) (*usecase.Principal, error)
+	ValidateAPIKey(key string) (*usecase.Principal, error)
+}
+
+func AuthMiddleware(validator TokenValidator) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Verificar o cabeçalho Authorization no formato "Bearer <token>"
+		// Verificar o cabeçalho Authorization no formato "Bearer <token>" ou "ApiKey <chave>"
 		tokenString := c.GetHeader("Authorization")
 		if tokenString == "" {
 			response.Error(c, http.StatusUnauthorized, gin.H{
@@ -23,7 +31,7 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		// Extrair o token do cabeçalho
 		tokenArr := strings.Split(tokenString, " ")
-		if len(tokenArr) != 2 || tokenArr[0] != "Bearer" {
+		if len(tokenArr) != 2 || (tokenArr[0] != "Bearer" && tokenArr[0] != "ApiKey") {
 			response.Error(c, http.StatusUnauthorized, gin.H{
 				"error": "Token de autenticação inválido",
 			})
@@ -32,65 +40,143 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 		tokenString = tokenArr[1]
 
-		// Verificar a validade do token
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Defina a chave secreta usada para assinar o token
-			return []byte("VMYCRUDTEST"), nil
-		})
-		if err != nil || !token.Valid {
-			response.Error(c, http.StatusUnauthorized, gin.H{
-				"error": "Token de autenticação inválido",
-			})
+		// Verificar a validade do token ou da chave de API
+		var principal *usecase.Principal
+		var err error
+		if tokenArr[0] == "ApiKey" {
+			principal, err = validator.ValidateAPIKey(tokenString)
+		} else {
+			principal, err = validator.ValidateAccessToken(tokenString)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, usecase.ErrInvalidAPIKey):
+				response.Error(c, http.StatusUnauthorized, gin.H{
+					"error": "Chave de API inválida",
+				})
+			case errors.Is(err, usecase.ErrUserSuspended):
+				response.Error(c, http.StatusForbidden, gin.H{
+					"error": "Conta de usuário suspensa",
+				})
+			case errors.Is(err, usecase.ErrUserDisabled):
+				response.Error(c, http.StatusForbidden, gin.H{
+					"error": "Conta de usuário desativada",
+				})
+			case errors.Is(err, usecase.ErrTokenRevoked):
+				response.Error(c, http.StatusUnauthorized, gin.H{
+					"error": "Token de autenticação revogado",
+				})
+			case errors.Is(err, usecase.ErrInvalidToken):
+				response.Error(c, http.StatusUnauthorized, gin.H{
+					"error": "Token de autenticação inválido",
+				})
+			default:
+				response.InternalServerError(c, err)
+			}
 			c.Abort()
 			return
 		}
 
-		// Obter os claims do token
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			response.Error(c, http.StatusUnauthorized, gin.H{
-				"error": "Token de autenticação inválido",
-			})
+		// Definir os dados do usuário no contexto
+		c.Set("ID", uint(principal.UserID))
+
+		// Definir o perfil do usuário no contexto
+		c.Set("profile", principal.Profile)
+
+		// Durante a personificação, "ID" é o usuário personificado e "actorID" o administrador que age por ele
+		if principal.IsImpersonated() {
+			c.Set("actorID", uint(principal.ActorID))
+		}
+
+		// Manter a identidade completa para handlers que precisam do token (ex.: logout)
+		c.Set("principal", principal)
+
+		// Continuar para o próximo handler
+		c.Next()
+	}
+}
+
+func AdminOnlyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Verificar se o perfil do usuário é "admin"
+		userProfile := c.GetString("profile")
+		if userProfile != "admin" {
+			response.Error(c, http.StatusForbidden, gin.H{"error": "Apenas usuários com perfil de administrador podem realizar esta operação"})
 			c.Abort()
 			return
 		}
 
-		// Obter o valor do claim "id"
-		userID, ok := claims["id"].(float64)
-		if !ok {
-			response.Error(c, http.StatusUnauthorized, gin.H{
-				"error": "Token de autenticação inválido",
-			})
+		// Administradores obrigados a usar dois fatores precisam ativá-los antes de usar as rotas administrativas
+		if principal, ok := GetPrincipal(c); ok && principal.TwoFactorPending {
+			response.Error(c, http.StatusForbidden, gin.H{"error": "É necessário ativar a autenticação em dois fatores para realizar esta operação"})
 			c.Abort()
 			return
 		}
 
-		// Definir os dados do usuário no contexto
-		c.Set("ID", uint(userID))
+		// Continuar para o próximo handler
+		c.Next()
+	}
+}
 
-		profile, ok := claims["profile"].(string)
-		if !ok {
-			response.Error(c, http.StatusUnauthorized, gin.H{
-				"error": "Token de autenticação inválido",
-			})
+// Exige todas as permissões informadas. Para clientes OAuth, as permissões correspondem aos escopos concedidos ao token
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !authorizePermissions(c, permissions) {
 			c.Abort()
 			return
 		}
 
-		// Definir o perfil do usuário no contexto
-		c.Set("profile", profile)
+		// Continuar para o próximo handler
+		c.Next()
+	}
+}
+
+// Libera o acesso ao próprio usuário, identificado pelo parâmetro da rota; os demais precisam das permissões informadas
+func RequireOwnerOrPermission(param string, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		if ok && principal.ClientID == "" && c.Param(param) == strconv.FormatUint(principal.UserID, 10) {
+			c.Next()
+			return
+		}
+
+		if !authorizePermissions(c, permissions) {
+			c.Abort()
+			return
+		}
 
 		// Continuar para o próximo handler
 		c.Next()
 	}
 }
 
-func AdminOnlyMiddleware() gin.HandlerFunc {
+func authorizePermissions(c *gin.Context, permissions []string) bool {
+	principal, ok := GetPrincipal(c)
+	if !ok {
+		response.Error(c, http.StatusForbidden, gin.H{"error": "Você não tem permissão para realizar esta operação"})
+		return false
+	}
+
+	// Usuários obrigados a usar dois fatores precisam ativá-los antes de usar as rotas protegidas por permissão
+	if principal.TwoFactorPending {
+		response.Error(c, http.StatusForbidden, gin.H{"error": "É necessário ativar a autenticação em dois fatores para realizar esta operação"})
+		return false
+	}
+
+	for _, permission := range permissions {
+		if !principal.HasPermission(permission) {
+			response.Error(c, http.StatusForbidden, gin.H{"error": "Você não tem permissão para realizar esta operação"})
+			return false
+		}
+	}
+	return true
+}
+
+// Bloqueia operações sensíveis (ex.: troca de senha, exclusão) quando o token é de personificação
+func DenyImpersonation() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Verificar se o perfil do usuário é "admin"
-		userProfile := c.GetString("profile")
-		if userProfile != "admin" {
-			response.Error(c, http.StatusForbidden, gin.H{"error": "Apenas usuários com perfil de administrador podem realizar esta operação"})
+		if principal, ok := GetPrincipal(c); ok && principal.IsImpersonated() {
+			response.Error(c, http.StatusForbidden, gin.H{"error": "Esta operação não é permitida durante a personificação de um usuário"})
 			c.Abort()
 			return
 		}
@@ -99,3 +185,28 @@ func AdminOnlyMiddleware() gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// Bloqueia o gerenciamento das credenciais (senha, dois fatores e chaves de API) quando a requisição é autenticada
+// por uma chave de API, para que uma chave vazada não sirva para criar outras nem para tomar a conta
+func DenyAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if principal, ok := GetPrincipal(c); ok && principal.APIKeyID != 0 {
+			response.Error(c, http.StatusForbidden, gin.H{"error": "Esta operação não é permitida com uma chave de API"})
+			c.Abort()
+			return
+		}
+
+		// Continuar para o próximo handler
+		c.Next()
+	}
+}
+
+// Retorna a identidade autenticada definida pelo AuthMiddleware
+func GetPrincipal(c *gin.Context) (*usecase.Principal, bool) {
+	value, ok := c.Get("principal")
+	if !ok {
+		return nil, false
+	}
+	principal, ok := value.(*usecase.Principal)
+	return principal, ok
+}
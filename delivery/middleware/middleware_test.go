@@ -7,12 +7,42 @@ import (
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
 	"github.com/stretchr/testify/assert"
 )
 
+type mockTokenValidator struct {
+	revoked map[string]bool
+}
+
+func (m *mockTokenValidator) ValidateAccessToken(tokenString string) (*usecase.Principal, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte("VMYCRUDTEST"), nil
+	})
+	if err != nil || !token.Valid {
+		return nil, usecase.ErrInvalidToken
+	}
+	if m.revoked[tokenString] {
+		return nil, usecase.ErrTokenRevoked
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	return &usecase.Principal{
+		UserID:  uint64(claims["id"].(float64)),
+		Profile: claims["profile"].(string),
+	}, nil
+}
+
+func (m *mockTokenValidator) ValidateAPIKey(key string) (*usecase.Principal, error) {
+	if key != "vmy_valid" {
+		return nil, usecase.ErrInvalidAPIKey
+	}
+	return &usecase.Principal{UserID: 3, Profile: "user", APIKeyID: 9}, nil
+}
+
 func TestAuthMiddleware_ValidToken(t *testing.T) {
 	router := gin.Default()
-	router.Use(AuthMiddleware())
+	router.Use(AuthMiddleware(&mockTokenValidator{}))
 
 	validToken := generateValidToken()
 
@@ -32,7 +62,7 @@ func TestAuthMiddleware_ValidToken(t *testing.T) {
 
 func TestAuthMiddleware_InvalidToken(t *testing.T) {
 	router := gin.Default()
-	router.Use(AuthMiddleware())
+	router.Use(AuthMiddleware(&mockTokenValidator{}))
 
 	invalidToken := "invalid-token"
 
@@ -50,6 +80,76 @@ func TestAuthMiddleware_InvalidToken(t *testing.T) {
 	assert.JSONEq(t, `{"error": "Token de autenticação inválido"}`, w.Body.String())
 }
 
+func TestAuthMiddleware_RevokedToken(t *testing.T) {
+	revokedToken := generateValidToken()
+
+	router := gin.Default()
+	router.Use(AuthMiddleware(&mockTokenValidator{revoked: map[string]bool{revokedToken: true}}))
+
+	router.GET("/protected", func(c *gin.Context) {
+		c.String(http.StatusOK, "Access granted")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+revokedToken)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error": "Token de autenticação revogado"}`, w.Body.String())
+}
+
+func TestAuthMiddleware_SetsPrincipal(t *testing.T) {
+	router := gin.Default()
+	router.Use(AuthMiddleware(&mockTokenValidator{}))
+
+	router.GET("/protected", func(c *gin.Context) {
+		principal, ok := GetPrincipal(c)
+		assert.True(t, ok)
+		assert.Equal(t, uint64(2), principal.UserID)
+		assert.Equal(t, uint(2), c.GetUint("ID"))
+		assert.Equal(t, "user", c.GetString("profile"))
+		c.String(http.StatusOK, "Access granted")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+generateNonAdminToken())
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuthMiddleware_APIKey(t *testing.T) {
+	router := gin.Default()
+	router.Use(AuthMiddleware(&mockTokenValidator{}))
+
+	router.GET("/protected", func(c *gin.Context) {
+		principal, _ := GetPrincipal(c)
+		assert.Equal(t, uint64(9), principal.APIKeyID)
+		assert.Equal(t, uint(3), c.GetUint("ID"))
+		assert.Equal(t, "user", c.GetString("profile"))
+		c.String(http.StatusOK, "Access granted")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "ApiKey vmy_valid")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "ApiKey vmy_invalid")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.JSONEq(t, `{"error": "Chave de API inválida"}`, w.Body.String())
+}
+
 func TestAdminOnlyMiddleware_AdminUser(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
@@ -87,6 +187,91 @@ func TestAdminOnlyMiddleware_NonAdminUser(t *testing.T) {
 	assert.JSONEq(t, `{"error": "Apenas usuários com perfil de administrador podem realizar esta operação"}`, w.Body.String())
 }
 
+func TestAdminOnlyMiddleware_TwoFactorPending(t *testing.T) {
+	router := gin.Default()
+	router.Use(func(c *gin.Context) {
+		c.Set("profile", "admin")
+		c.Set("principal", &usecase.Principal{UserID: 1, Profile: "admin", TwoFactorPending: true})
+	})
+	router.Use(AdminOnlyMiddleware())
+
+	router.GET("/admin-only", func(c *gin.Context) {
+		c.String(http.StatusOK, "Access granted")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin-only", nil)
+	w := httptest.NewRecorder()
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "É necessário ativar a autenticação em dois fatores para realizar esta operação"}`, w.Body.String())
+}
+
+func TestRequirePermission(t *testing.T) {
+	principal := &usecase.Principal{UserID: 1, Profile: "user", Permissions: []string{"users:read"}}
+
+	router := gin.Default()
+	router.Use(func(c *gin.Context) {
+		c.Set("principal", principal)
+	})
+	router.GET("/read", RequirePermission("users:read"), func(c *gin.Context) {
+		c.String(http.StatusOK, "Access granted")
+	})
+	router.GET("/write", RequirePermission("users:read", "users:write"), func(c *gin.Context) {
+		c.String(http.StatusOK, "Access granted")
+	})
+
+	request := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, request("/read").Code)
+	w := request("/write")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "Você não tem permissão para realizar esta operação"}`, w.Body.String())
+
+	// OAuth clients are authorized by the scopes granted to the token
+	principal = &usecase.Principal{ClientID: "client123", Scopes: []string{"users:read", "users:write"}}
+	assert.Equal(t, http.StatusOK, request("/write").Code)
+
+	// Users that must enable two-factor authentication are restricted until they do
+	principal = &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:read"}, TwoFactorPending: true}
+	w = request("/read")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error": "É necessário ativar a autenticação em dois fatores para realizar esta operação"}`, w.Body.String())
+}
+
+func TestRequireOwnerOrPermission(t *testing.T) {
+	principal := &usecase.Principal{UserID: 1, Profile: "user"}
+
+	router := gin.Default()
+	router.Use(func(c *gin.Context) {
+		c.Set("principal", principal)
+	})
+	router.GET("/users/:id", RequireOwnerOrPermission("id", "users:read"), func(c *gin.Context) {
+		c.String(http.StatusOK, "Access granted")
+	})
+
+	request := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, request("/users/1"))
+	assert.Equal(t, http.StatusForbidden, request("/users/2"))
+
+	principal = &usecase.Principal{UserID: 1, Profile: "admin", Permissions: []string{"users:read"}}
+	assert.Equal(t, http.StatusOK, request("/users/2"))
+
+	// OAuth clients never own a user
+	principal = &usecase.Principal{ClientID: "1"}
+	assert.Equal(t, http.StatusForbidden, request("/users/0"))
+}
+
 func generateValidToken() string {
 	token := jwt.New(jwt.SigningMethodHS256)
 	claims := token.Claims.(jwt.MapClaims)
@@ -0,0 +1,20 @@
+package entity
+
+import "time"
+
+// Chave de API pessoal para clientes sem interação humana. Somente o hash da chave é persistido
+type APIKey struct {
+	ID         uint64     `gorm:"primaryKey" json:"id"`
+	UserID     uint64     `gorm:"not null;index" json:"-"`
+	Name       string     `gorm:"not null" json:"name"`
+	Prefix     string     `gorm:"not null;size:16" json:"prefix"`
+	KeyHash    string     `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (k *APIKey) IsActive(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
@@ -2,6 +2,7 @@ package entity
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -128,3 +129,14 @@ func TestAddress_Value(t *testing.T) {
 	expectedValue := `{"street":"123 Main St","city":"Anytown","state":"CA","country":"USA"}`
 	assert.Equal(t, expectedValue, value)
 }
+
+func TestUser_EffectiveStatus(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+
+	assert.Equal(t, UserStatusActive, (&User{}).EffectiveStatus(now))
+	assert.Equal(t, UserStatusSuspended, (&User{Status: UserStatusSuspended}).EffectiveStatus(now))
+	assert.Equal(t, UserStatusSuspended, (&User{Status: UserStatusSuspended, SuspendedUntil: &future}).EffectiveStatus(now))
+	assert.Equal(t, UserStatusActive, (&User{Status: UserStatusSuspended, SuspendedUntil: &past}).EffectiveStatus(now))
+	assert.Equal(t, UserStatusDisabled, (&User{Status: UserStatusDisabled}).EffectiveStatus(now))
+}
@@ -0,0 +1,15 @@
+package entity
+
+import "time"
+
+// Registro de auditoria de cada token de personificação emitido
+type ImpersonationSession struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	ActorID   uint64    `gorm:"not null;index" json:"actorId"`
+	UserID    uint64    `gorm:"not null;index" json:"userId"`
+	TokenID   string    `gorm:"not null;size:64;uniqueIndex" json:"-"`
+	Reason    string    `gorm:"not null" json:"reason"`
+	ClientIP  string    `gorm:"size:45" json:"clientIp"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,13 @@
+package entity
+
+import "time"
+
+// Tentativas de login de uma chave (conta ou IP de origem), compartilhadas entre as instâncias da API
+type LoginAttempt struct {
+	Key         string `gorm:"column:attempt_key;primaryKey;size:320"`
+	Failures    int    `gorm:"not null;default:0"`
+	Pending     int    `gorm:"not null;default:0"`
+	LastFailure *time.Time
+	LastAttempt *time.Time `gorm:"index"`
+	LockedUntil *time.Time
+}
@@ -0,0 +1,27 @@
+package entity
+
+import (
+	"strings"
+	"time"
+)
+
+// Cliente OAuth2 registrado para acesso entre serviços (client_credentials). Somente o hash do segredo é persistido
+type OAuthClient struct {
+	ID         uint64     `gorm:"primaryKey" json:"id"`
+	ClientID   string     `gorm:"not null;size:64;uniqueIndex" json:"clientId"`
+	Name       string     `gorm:"not null" json:"name"`
+	SecretHash string     `gorm:"not null;size:64" json:"-"`
+	Scope      string     `gorm:"not null" json:"scope"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+// Evita o nome "o_auth_clients" gerado pela convenção do GORM
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// Escopos permitidos ao cliente, armazenados separados por espaço como no parâmetro "scope" do OAuth2
+func (c *OAuthClient) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
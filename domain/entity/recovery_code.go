@@ -0,0 +1,12 @@
+package entity
+
+import "time"
+
+// Código de recuperação de uso único da autenticação em dois fatores. Somente o hash é persistido
+type RecoveryCode struct {
+	ID        uint64 `gorm:"primaryKey"`
+	UserID    uint64 `gorm:"not null;index"`
+	CodeHash  string `gorm:"not null;size:64"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+// Token de acesso revogado individualmente (ex.: logout), identificado pelo claim "jti"
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;size:64"`
+	UserID    uint64    `gorm:"not null;index"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+// Revoga todos os tokens de um usuário emitidos antes de RevokedBefore (ex.: usuário removido)
+type UserTokenRevocation struct {
+	UserID        uint64    `gorm:"primaryKey;autoIncrement:false"`
+	RevokedBefore time.Time `gorm:"not null;precision:6"`
+	UpdatedAt     time.Time
+}
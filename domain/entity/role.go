@@ -0,0 +1,70 @@
+package entity
+
+import (
+	"errors"
+	"regexp"
+	"time"
+)
+
+// Permissões conhecidas pela API
+const (
+	PermissionUsersRead     = "users:read"
+	PermissionUsersWrite    = "users:write"
+	PermissionUsersDelete   = "users:delete"
+	PermissionRolesManage   = "roles:manage"
+	PermissionClientsManage = "clients:manage"
+	PermissionImpersonate   = "users:impersonate"
+)
+
+// Papéis criados pela migração e associados aos perfis "admin" e "user"
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+var ErrInvalidRoleName = errors.New("Role name must start with a letter and contain only lowercase letters, digits, '-' or '_' (2 to 32 characters)")
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,31}$`)
+
+// Permissão atômica verificada pelas rotas (ex.: "users:read")
+type Permission struct {
+	ID          uint64 `gorm:"primaryKey" json:"-"`
+	Name        string `gorm:"not null;size:64;uniqueIndex" json:"name"`
+	Description string `json:"description"`
+}
+
+// Conjunto nomeado de permissões. Todo usuário recebe as permissões do papel com o nome do seu perfil,
+// além dos papéis atribuídos diretamente a ele
+type Role struct {
+	ID          uint64       `gorm:"primaryKey" json:"id"`
+	Name        string       `gorm:"not null;size:32;uniqueIndex" json:"name"`
+	Description string       `json:"description"`
+	Permissions []Permission `gorm:"many2many:role_permissions" json:"permissions"`
+	CreatedAt   time.Time    `json:"createdAt"`
+}
+
+// Atribuição de um papel a um usuário
+type UserRole struct {
+	UserID    uint64 `gorm:"primaryKey;autoIncrement:false"`
+	RoleID    uint64 `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time
+}
+
+func (r *Role) Validate() error {
+	if !roleNamePattern.MatchString(r.Name) {
+		return ErrInvalidRoleName
+	}
+	return nil
+}
+
+func (r *Role) IsBuiltin() bool {
+	return r.Name == RoleAdmin || r.Name == RoleUser
+}
+
+func (r *Role) PermissionNames() []string {
+	names := make([]string, 0, len(r.Permissions))
+	for _, permission := range r.Permissions {
+		names = append(names, permission.Name)
+	}
+	return names
+}
@@ -5,17 +5,53 @@ import (
 	"time"
 
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPasswordTooShort = errors.New("Password must be at least 6 characters long")
+	ErrInvalidProfile   = errors.New("Profile must be either 'admin' or 'user'")
+	ErrInvalidStatus    = errors.New("Status must be one of 'active', 'suspended' or 'disabled'")
+)
+
+// Situação da conta: usuários suspensos ou desativados não podem fazer login nem usar tokens já emitidos
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusDisabled  = "disabled"
 )
 
 type User struct {
-	ID        uint64   `gorm:"primaryKey" json:"id,omitempty"`
-	Name      string   `gorm:"not null" json:"name,omitempty" validate:"nonzero"`
-	Email     string   `gorm:"not null;unique" json:"email,omitempty"`
-	Password  string   `gorm:"not null" json:"password,omitempty"`
-	BirthDate string   `gorm:"not null" json:"birthDate,omitempty"`
-	Age       int      `json:"age,omitempty"`
-	Profile   string   `gorm:"not null" json:"Profile,omitempty"`
-	Address   *Address `json:"address,omitempty"`
+	ID               uint64     `gorm:"primaryKey" json:"id,omitempty"`
+	Name             string     `gorm:"not null" json:"name,omitempty" validate:"nonzero"`
+	Email            string     `gorm:"not null;unique" json:"email,omitempty"`
+	Password         string     `gorm:"not null" json:"password,omitempty"`
+	BirthDate        string     `gorm:"not null" json:"birthDate,omitempty"`
+	Age              int        `json:"age,omitempty"`
+	Profile          string     `gorm:"not null" json:"Profile,omitempty"`
+	Address          *Address   `json:"address,omitempty"`
+	EmailVerified    bool       `gorm:"not null;default:false" json:"emailVerified"`
+	VerifiedAt       *time.Time `json:"verifiedAt,omitempty"`
+	PendingEmail     string     `json:"pendingEmail,omitempty"`
+	TwoFactorSecret  string     `json:"-"`
+	TwoFactorEnabled bool       `gorm:"not null;default:false" json:"twoFactorEnabled"`
+	TOTPLastStep     int64      `gorm:"column:totp_last_step;not null;default:0" json:"-"`
+	Status           string     `gorm:"not null;size:16;default:active" json:"status"`
+	StatusReason     string     `json:"statusReason,omitempty"`
+	SuspendedUntil   *time.Time `json:"suspendedUntil,omitempty"`
+	CreatedAt        time.Time  `gorm:"index" json:"createdAt"`
+	// Incrementada a cada alteração; é a base do ETag e impede que alterações concorrentes se sobrescrevam
+	Version uint64 `gorm:"not null;default:1" json:"-"`
+	// Usuários excluídos permanecem no banco até o expurgo e podem ser restaurados
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// Usuários novos começam na versão 1, mesmo valor padrão da coluna
+func (u *User) BeforeCreate(tx *gorm.DB) error {
+	if u.Version == 0 {
+		u.Version = 1
+	}
+	return nil
 }
 
 func (u *User) Validate() error {
@@ -31,8 +67,8 @@ func (u *User) Validate() error {
 	}
 
 	// Validate the Password field
-	if len(u.Password) < 6 {
-		return errors.New("Password must be at least 6 characters long")
+	if err := ValidatePassword(u.Password); err != nil {
+		return err
 	}
 
 	// Validate the BirthDate field
@@ -42,8 +78,8 @@ func (u *User) Validate() error {
 	}
 
 	// Validate the Profile field
-	if u.Profile != "admin" && u.Profile != "user" {
-		return errors.New("Profile must be either 'admin' or 'user'")
+	if err := ValidateProfile(u.Profile); err != nil {
+		return err
 	}
 
 	// Validate the Address field
@@ -65,3 +101,39 @@ func (u *User) Validate() error {
 	// If all validations pass, return nil
 	return nil
 }
+
+// Política de senha aplicada no cadastro e na troca de senha
+func ValidatePassword(password string) error {
+	if len(password) < 6 {
+		return ErrPasswordTooShort
+	}
+	return nil
+}
+
+func ValidateStatus(status string) error {
+	if status != UserStatusActive && status != UserStatusSuspended && status != UserStatusDisabled {
+		return ErrInvalidStatus
+	}
+	return nil
+}
+
+// Situação vigente da conta: suspensões com prazo deixam de valer quando ele termina.
+// Usuários cadastrados antes da introdução da situação são considerados ativos
+func (u *User) EffectiveStatus(now time.Time) string {
+	switch {
+	case u.Status == "":
+		return UserStatusActive
+	case u.Status == UserStatusSuspended && u.SuspendedUntil != nil && !now.Before(*u.SuspendedUntil):
+		return UserStatusActive
+	default:
+		return u.Status
+	}
+}
+
+// O perfil define o papel base do usuário
+func ValidateProfile(profile string) error {
+	if profile != RoleAdmin && profile != RoleUser {
+		return ErrInvalidProfile
+	}
+	return nil
+}
@@ -58,3 +58,31 @@ func TestIsValidEmail(t *testing.T) {
 		}
 	}
 }
+
+func TestGenerateRandomToken(t *testing.T) {
+	token, err := GenerateRandomToken(32)
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(token) != 43 {
+		t.Errorf("Expected token length to be 43, but got %d", len(token))
+	}
+
+	other, _ := GenerateRandomToken(32)
+	if token == other {
+		t.Error("Expected tokens to be different")
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	hash := HashToken("token")
+	if len(hash) != 64 {
+		t.Errorf("Expected hash length to be 64, but got %d", len(hash))
+	}
+	if hash != HashToken("token") {
+		t.Error("Expected hash to be deterministic")
+	}
+	if hash == HashToken("other") {
+		t.Error("Expected different tokens to have different hashes")
+	}
+}
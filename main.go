@@ -1,23 +1,79 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
+	"github.com/mvzcanhaco/api-users-crud-verifymy/config"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/db"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/delivery/http"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/notifier"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/security"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/usecase"
 )
 
 func main() {
 
+	cfg := config.Load()
+
+	// Carregar as chaves de assinatura dos tokens
+	keyManager, err := security.NewKeyManager(cfg.Keys)
+	if err != nil {
+		log.Fatalf("Failed to load signing keys: %v", err)
+	}
+
+	// Inicializar o envio de notificações
+	notification := notifier.NewLogNotifier()
+	if cfg.Notifier.Driver == "file" {
+		notification = notifier.NewFileNotifier(cfg.Notifier.FilePath)
+	}
+
 	db := db.SetupDatabase()
 
 	// Inicializar as dependências
 	userRepo := repository.NewUserRepositoryImpl(db)
-	userUseCase := usecase.NewUserUseCaseImpl(userRepo)
-	r := http.SetupRoutes(userUseCase)
+	refreshTokenRepo := repository.NewRefreshTokenRepositoryImpl(db)
+	revocationRepo := repository.NewTokenRevocationRepositoryImpl(db)
+	if cfg.Auth.RevocationStore == "memory" {
+		revocationRepo = repository.NewInMemoryTokenRevocationRepository()
+	}
+	passwordResetRepo := repository.NewPasswordResetRepositoryImpl(db)
+	recoveryCodeRepo := repository.NewRecoveryCodeRepositoryImpl(db)
+	loginAttemptRepo := repository.NewLoginAttemptRepositoryImpl(db)
+	if cfg.LoginProtection.Store == "memory" {
+		loginAttemptRepo = repository.NewInMemoryLoginAttemptRepository()
+	}
+	apiKeyRepo := repository.NewAPIKeyRepositoryImpl(db)
+	roleRepo := repository.NewRoleRepositoryImpl(db)
+	impersonationRepo := repository.NewImpersonationRepositoryImpl(db)
+	oauthClientRepo := repository.NewOAuthClientRepositoryImpl(db)
+	userUseCase := usecase.NewUserUseCaseImpl(
+		cfg,
+		keyManager,
+		notification,
+		userRepo,
+		refreshTokenRepo,
+		revocationRepo,
+		passwordResetRepo,
+		recoveryCodeRepo,
+		loginAttemptRepo,
+		apiKeyRepo,
+		roleRepo,
+		impersonationRepo,
+		oauthClientRepo,
+	)
+	oauthUseCase := usecase.NewOAuthClientUseCaseImpl(cfg, keyManager, oauthClientRepo)
+	roleUseCase := usecase.NewRoleUseCaseImpl(roleRepo, userRepo, revocationRepo)
+
+	// Expurgar periodicamente os usuários excluídos após o período de retenção
+	go usecase.RunDeletedUserPurger(context.Background(), userUseCase, cfg.Retention.PurgeInterval)
+
+	// Remover periodicamente as tentativas de login que não afetam mais nenhum login
+	go usecase.RunLoginAttemptPurger(context.Background(), userUseCase, cfg.LoginProtection.PurgeInterval)
+
+	r := http.SetupRoutes(userUseCase, oauthUseCase, roleUseCase, keyManager)
 
 	port := os.Getenv("PORT")
 	if port == "" {
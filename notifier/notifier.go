@@ -0,0 +1,56 @@
+package notifier
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Responsável por entregar mensagens aos usuários (e-mail, SMS, etc.)
+type Notifier interface {
+	Notify(message Message) error
+}
+
+// Escreve as mensagens no log da aplicação, útil para desenvolvimento local
+type LogNotifier struct{}
+
+func NewLogNotifier() Notifier {
+	return &LogNotifier{}
+}
+
+func (n *LogNotifier) Notify(message Message) error {
+	log.Printf("Notificação para %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
+
+// Acrescenta as mensagens em um arquivo, útil para testes locais
+type FileNotifier struct {
+	mu   sync.Mutex
+	path string
+}
+
+func NewFileNotifier(path string) Notifier {
+	return &FileNotifier{path: path}
+}
+
+func (n *FileNotifier) Notify(message Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	file, err := os.OpenFile(n.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = fmt.Fprintf(file, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), message.To, message.Subject, message.Body)
+	return err
+}
@@ -0,0 +1,29 @@
+package notifier
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileNotifier_Notify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "messages.log")
+	n := NewFileNotifier(path)
+
+	err := n.Notify(Message{To: "john@example.com", Subject: "Hello", Body: "First"})
+	assert.NoError(t, err)
+	err = n.Notify(Message{To: "jane@example.com", Subject: "Hello", Body: "Second"})
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "To: john@example.com")
+	assert.Contains(t, string(content), "To: jane@example.com")
+	assert.Contains(t, string(content), "Second")
+}
+
+func TestLogNotifier_Notify(t *testing.T) {
+	assert.NoError(t, NewLogNotifier().Notify(Message{To: "john@example.com", Subject: "Hello", Body: "Body"}))
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"gorm.io/gorm"
+)
+
+type APIKeyRepository interface {
+	Create(key *entity.APIKey) error
+	FindByHash(keyHash string) (*entity.APIKey, error)
+	ListByUser(userID uint64) ([]*entity.APIKey, error)
+	Revoke(id, userID uint64) (bool, error)
+	RevokeAllForUser(userID uint64) error
+	TouchLastUsed(id uint64, usedAt time.Time) error
+}
+
+type APIKeyRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepositoryImpl(db *gorm.DB) APIKeyRepository {
+	return &APIKeyRepositoryImpl{
+		db: db,
+	}
+}
+
+func (r *APIKeyRepositoryImpl) Create(key *entity.APIKey) error {
+	return r.db.Create(key).Error
+}
+
+func (r *APIKeyRepositoryImpl) FindByHash(keyHash string) (*entity.APIKey, error) {
+	var key entity.APIKey
+	if err := r.db.Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &key, nil
+}
+
+// Lista as chaves ainda não revogadas do usuário, incluindo as expiradas
+func (r *APIKeyRepositoryImpl) ListByUser(userID uint64) ([]*entity.APIKey, error) {
+	var keys []*entity.APIKey
+	err := r.db.Where("user_id = ? AND revoked_at IS NULL", userID).Order("id").Find(&keys).Error
+	return keys, err
+}
+
+// Revoga a chave somente se pertencer ao usuário e ainda estiver ativa
+func (r *APIKeyRepositoryImpl) Revoke(id, userID uint64) (bool, error) {
+	result := r.db.Model(&entity.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *APIKeyRepositoryImpl) RevokeAllForUser(userID uint64) error {
+	return r.db.Model(&entity.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *APIKeyRepositoryImpl) TouchLastUsed(id uint64, usedAt time.Time) error {
+	return r.db.Model(&entity.APIKey{}).Where("id = ?", id).Update("last_used_at", usedAt).Error
+}
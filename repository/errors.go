@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+	"gorm.io/gorm"
+)
+
+// Código do MySQL para violação de índice único (ER_DUP_ENTRY)
+const mysqlDuplicateEntry = 1062
+
+var (
+	ErrNotFound = errors.New("record not found")
+	// O registro foi alterado por outra requisição depois de lido
+	ErrVersionConflict = errors.New("record was modified by another request")
+	// A gravação violou um índice único, como o do e-mail
+	ErrDuplicateKey = errors.New("duplicate key")
+)
+
+// Converte os erros do GORM em erros do repositório, evitando que as camadas superiores dependam do GORM
+func translateError(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrDuplicateKey
+	}
+	return err
+}
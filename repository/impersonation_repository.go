@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"gorm.io/gorm"
+)
+
+type ImpersonationRepository interface {
+	Create(session *entity.ImpersonationSession) error
+	FindAll(page, pageSize int) ([]*entity.ImpersonationSession, error)
+}
+
+type ImpersonationRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewImpersonationRepositoryImpl(db *gorm.DB) ImpersonationRepository {
+	return &ImpersonationRepositoryImpl{
+		db: db,
+	}
+}
+
+func (r *ImpersonationRepositoryImpl) Create(session *entity.ImpersonationSession) error {
+	return r.db.Create(session).Error
+}
+
+// Lista as sessões da mais recente para a mais antiga
+func (r *ImpersonationRepositoryImpl) FindAll(page, pageSize int) ([]*entity.ImpersonationSession, error) {
+	var sessions []*entity.ImpersonationSession
+	offset := (page - 1) * pageSize
+	err := r.db.Order("id DESC").Limit(pageSize).Offset(offset).Find(&sessions).Error
+	return sessions, err
+}
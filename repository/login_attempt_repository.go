@@ -0,0 +1,259 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Tentativas de login de uma chave (conta ou IP de origem)
+type LoginAttempts struct {
+	Failures int
+	// Tentativas reservadas que ainda não terminaram
+	Pending     int
+	LastFailure time.Time
+	LastAttempt time.Time
+	LockedUntil time.Time
+}
+
+// Limites aplicados às tentativas de uma chave
+type AttemptLimits struct {
+	// Falhas até o bloqueio
+	MaxFailures int
+	// Período após o qual as falhas antigas são esquecidas
+	Window time.Duration
+	// Duração do bloqueio
+	Lockout time.Duration
+	// Espera mínima após a n-ésima falha; nil quando não há espera entre as tentativas
+	Backoff func(failures int) time.Duration
+}
+
+// Tentativas reservadas há mais tempo que isso são descartadas, para que uma instância encerrada no meio
+// de um login não deixe a chave bloqueada
+const pendingAttemptTimeout = time.Minute
+
+type LoginAttemptRepository interface {
+	// Reserva uma tentativa, desde que a chave não esteja bloqueada, aguardando o intervalo entre falhas ou com
+	// tentativas em andamento suficientes para atingir o limite. A verificação e a reserva são uma única operação
+	// atômica, então requisições simultâneas não ultrapassam o limite
+	Acquire(key string, now time.Time, limits AttemptLimits) (LoginAttempts, bool, error)
+	// Conclui a tentativa reservada como falha, bloqueando a chave ao atingir o limite
+	Fail(key string, now time.Time, limits AttemptLimits) (LoginAttempts, error)
+	// Conclui a tentativa reservada sem registrar falha
+	Release(key string) error
+	Reset(key string) error
+	// Remove as chaves sem falhas dentro da janela, sem bloqueio e sem tentativas recentes, retornando quantas foram removidas
+	PurgeIdle(now time.Time, window time.Duration) (int64, error)
+}
+
+func (a *LoginAttempts) acquire(now time.Time, limits AttemptLimits) bool {
+	a.expire(now, limits.Window)
+
+	if a.LockedUntil.After(now) || a.Failures+a.Pending >= limits.MaxFailures {
+		return false
+	}
+	if a.Failures > 0 && limits.Backoff != nil && a.LastFailure.Add(limits.Backoff(a.Failures)).After(now) {
+		return false
+	}
+
+	a.Pending++
+	a.LastAttempt = now
+	return true
+}
+
+// Ao atingir o limite a chave é bloqueada e o contador de falhas é zerado
+func (a *LoginAttempts) fail(now time.Time, limits AttemptLimits) {
+	a.release()
+	a.Failures++
+	a.LastFailure = now
+	if a.Failures >= limits.MaxFailures {
+		a.Failures = 0
+		a.LockedUntil = now.Add(limits.Lockout)
+	}
+}
+
+func (a *LoginAttempts) release() {
+	if a.Pending > 0 {
+		a.Pending--
+	}
+}
+
+// Descarta as falhas fora da janela e as tentativas reservadas abandonadas
+func (a *LoginAttempts) expire(now time.Time, window time.Duration) {
+	if !a.LockedUntil.After(now) && a.LastFailure.Add(window).Before(now) {
+		a.Failures = 0
+	}
+	if a.LastAttempt.Add(pendingAttemptTimeout).Before(now) {
+		a.Pending = 0
+	}
+}
+
+func (a *LoginAttempts) idle(now time.Time, window time.Duration) bool {
+	a.expire(now, window)
+	return a.Failures == 0 && a.Pending == 0 && !a.LockedUntil.After(now)
+}
+
+// Mantém as tentativas no banco de dados, compartilhadas entre as instâncias e preservadas entre reinícios
+type LoginAttemptRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewLoginAttemptRepositoryImpl(db *gorm.DB) LoginAttemptRepository {
+	return &LoginAttemptRepositoryImpl{
+		db: db,
+	}
+}
+
+func (r *LoginAttemptRepositoryImpl) Acquire(key string, now time.Time, limits AttemptLimits) (LoginAttempts, bool, error) {
+	var acquired bool
+	attempts, err := r.change(key, func(attempts *LoginAttempts) {
+		acquired = attempts.acquire(now, limits)
+	})
+	if err != nil {
+		return LoginAttempts{}, false, err
+	}
+	return attempts, acquired, nil
+}
+
+func (r *LoginAttemptRepositoryImpl) Fail(key string, now time.Time, limits AttemptLimits) (LoginAttempts, error) {
+	return r.change(key, func(attempts *LoginAttempts) {
+		attempts.fail(now, limits)
+	})
+}
+
+func (r *LoginAttemptRepositoryImpl) Release(key string) error {
+	_, err := r.change(key, func(attempts *LoginAttempts) {
+		attempts.release()
+	})
+	return err
+}
+
+func (r *LoginAttemptRepositoryImpl) Reset(key string) error {
+	return r.db.Where("attempt_key = ?", key).Delete(&entity.LoginAttempt{}).Error
+}
+
+func (r *LoginAttemptRepositoryImpl) PurgeIdle(now time.Time, window time.Duration) (int64, error) {
+	result := r.db.Where("(last_attempt IS NULL OR last_attempt < ?) AND (last_failure IS NULL OR last_failure < ?) AND (locked_until IS NULL OR locked_until < ?)",
+		now.Add(-pendingAttemptTimeout), now.Add(-window), now).
+		Delete(&entity.LoginAttempt{})
+	return result.RowsAffected, result.Error
+}
+
+// Aplica a alteração com a linha da chave bloqueada (SELECT ... FOR UPDATE), para que requisições simultâneas,
+// inclusive de instâncias diferentes, avaliem a chave uma de cada vez
+func (r *LoginAttemptRepositoryImpl) change(key string, apply func(attempts *LoginAttempts)) (LoginAttempts, error) {
+	var attempts LoginAttempts
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// A linha precisa existir para que o bloqueio valha também para a primeira tentativa da chave
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.LoginAttempt{Key: key}).Error; err != nil {
+			return err
+		}
+
+		var row entity.LoginAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("attempt_key = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+
+		attempts = LoginAttempts{
+			Failures:    row.Failures,
+			Pending:     row.Pending,
+			LastFailure: timeValue(row.LastFailure),
+			LastAttempt: timeValue(row.LastAttempt),
+			LockedUntil: timeValue(row.LockedUntil),
+		}
+		apply(&attempts)
+
+		return tx.Model(&row).Select("*").Updates(&entity.LoginAttempt{
+			Key:         key,
+			Failures:    attempts.Failures,
+			Pending:     attempts.Pending,
+			LastFailure: timePointer(attempts.LastFailure),
+			LastAttempt: timePointer(attempts.LastAttempt),
+			LockedUntil: timePointer(attempts.LockedUntil),
+		}).Error
+	})
+	return attempts, err
+}
+
+func timeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+func timePointer(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// Mantém as tentativas em memória: os limites são perdidos ao reiniciar e, em múltiplas instâncias,
+// cada uma os aplica separadamente
+type InMemoryLoginAttemptRepository struct {
+	mu       sync.Mutex
+	attempts map[string]LoginAttempts
+}
+
+func NewInMemoryLoginAttemptRepository() LoginAttemptRepository {
+	return &InMemoryLoginAttemptRepository{
+		attempts: make(map[string]LoginAttempts),
+	}
+}
+
+func (r *InMemoryLoginAttemptRepository) Acquire(key string, now time.Time, limits AttemptLimits) (LoginAttempts, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts := r.attempts[key]
+	acquired := attempts.acquire(now, limits)
+	r.attempts[key] = attempts
+	return attempts, acquired, nil
+}
+
+func (r *InMemoryLoginAttemptRepository) Fail(key string, now time.Time, limits AttemptLimits) (LoginAttempts, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	attempts := r.attempts[key]
+	attempts.fail(now, limits)
+	r.attempts[key] = attempts
+	return attempts, nil
+}
+
+func (r *InMemoryLoginAttemptRepository) Release(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if attempts, ok := r.attempts[key]; ok {
+		attempts.release()
+		r.attempts[key] = attempts
+	}
+	return nil
+}
+
+func (r *InMemoryLoginAttemptRepository) Reset(key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.attempts, key)
+	return nil
+}
+
+func (r *InMemoryLoginAttemptRepository) PurgeIdle(now time.Time, window time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int64
+	for key, attempts := range r.attempts {
+		if attempts.idle(now, window) {
+			delete(r.attempts, key)
+			purged++
+		}
+	}
+	return purged, nil
+}
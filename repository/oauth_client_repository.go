@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"gorm.io/gorm"
+)
+
+type OAuthClientRepository interface {
+	Create(client *entity.OAuthClient) error
+	FindByClientID(clientID string) (*entity.OAuthClient, error)
+	FindAll() ([]*entity.OAuthClient, error)
+	Revoke(id uint64) (bool, error)
+}
+
+type OAuthClientRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewOAuthClientRepositoryImpl(db *gorm.DB) OAuthClientRepository {
+	return &OAuthClientRepositoryImpl{
+		db: db,
+	}
+}
+
+func (r *OAuthClientRepositoryImpl) Create(client *entity.OAuthClient) error {
+	return r.db.Create(client).Error
+}
+
+// Busca somente clientes ativos
+func (r *OAuthClientRepositoryImpl) FindByClientID(clientID string) (*entity.OAuthClient, error) {
+	var client entity.OAuthClient
+	if err := r.db.Where("client_id = ? AND revoked_at IS NULL", clientID).First(&client).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &client, nil
+}
+
+func (r *OAuthClientRepositoryImpl) FindAll() ([]*entity.OAuthClient, error) {
+	var clients []*entity.OAuthClient
+	err := r.db.Where("revoked_at IS NULL").Order("id").Find(&clients).Error
+	return clients, err
+}
+
+func (r *OAuthClientRepositoryImpl) Revoke(id uint64) (bool, error) {
+	result := r.db.Model(&entity.OAuthClient{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
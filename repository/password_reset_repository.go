@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"gorm.io/gorm"
+)
+
+type PasswordResetRepository interface {
+	Create(token *entity.PasswordResetToken) error
+	FindByHash(tokenHash string) (*entity.PasswordResetToken, error)
+	MarkUsed(id uint64) (bool, error)
+	InvalidateForUser(userID uint64) error
+}
+
+type PasswordResetRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewPasswordResetRepositoryImpl(db *gorm.DB) PasswordResetRepository {
+	return &PasswordResetRepositoryImpl{
+		db: db,
+	}
+}
+
+func (r *PasswordResetRepositoryImpl) Create(token *entity.PasswordResetToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *PasswordResetRepositoryImpl) FindByHash(tokenHash string) (*entity.PasswordResetToken, error) {
+	var token entity.PasswordResetToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+// Marca o token como utilizado somente se ainda não foi usado, garantindo o uso único
+func (r *PasswordResetRepositoryImpl) MarkUsed(id uint64) (bool, error) {
+	result := r.db.Model(&entity.PasswordResetToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *PasswordResetRepositoryImpl) InvalidateForUser(userID uint64) error {
+	return r.db.Model(&entity.PasswordResetToken{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Update("used_at", time.Now()).Error
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeRepository interface {
+	ReplaceForUser(userID uint64, codeHashes []string) error
+	Use(userID uint64, codeHash string) (bool, error)
+	DeleteForUser(userID uint64) error
+}
+
+type RecoveryCodeRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRecoveryCodeRepositoryImpl(db *gorm.DB) RecoveryCodeRepository {
+	return &RecoveryCodeRepositoryImpl{
+		db: db,
+	}
+}
+
+// Substitui todos os códigos do usuário pelos novos, invalidando os anteriores
+func (r *RecoveryCodeRepositoryImpl) ReplaceForUser(userID uint64, codeHashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		codes := make([]*entity.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, &entity.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// Marca o código como utilizado somente se ainda não foi usado, garantindo o uso único
+func (r *RecoveryCodeRepositoryImpl) Use(userID uint64, codeHash string) (bool, error) {
+	result := r.db.Model(&entity.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *RecoveryCodeRepositoryImpl) DeleteForUser(userID uint64) error {
+	return r.db.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error
+}
@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"gorm.io/gorm"
+)
+
+type RefreshTokenRepository interface {
+	Create(token *entity.RefreshToken) error
+	FindByHash(tokenHash string) (*entity.RefreshToken, error)
+	Revoke(id uint64) (bool, error)
+	RevokeFamily(familyID string) error
+	RevokeAllForUser(userID uint64) error
+}
+
+type RefreshTokenRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRefreshTokenRepositoryImpl(db *gorm.DB) RefreshTokenRepository {
+	return &RefreshTokenRepositoryImpl{
+		db: db,
+	}
+}
+
+func (r *RefreshTokenRepositoryImpl) Create(token *entity.RefreshToken) error {
+	return r.db.Create(token).Error
+}
+
+func (r *RefreshTokenRepositoryImpl) FindByHash(tokenHash string) (*entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	if err := r.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &token, nil
+}
+
+// Revoga o token somente se ainda estiver ativo. Retorna false se outro processo já o revogou,
+// o que permite detectar o uso concorrente do mesmo refresh token
+func (r *RefreshTokenRepositoryImpl) Revoke(id uint64) (bool, error) {
+	result := r.db.Model(&entity.RefreshToken{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *RefreshTokenRepositoryImpl) RevokeFamily(familyID string) error {
+	return r.db.Model(&entity.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (r *RefreshTokenRepositoryImpl) RevokeAllForUser(userID uint64) error {
+	return r.db.Model(&entity.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,236 @@
+package repository
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+)
+
+type capturedQuery struct {
+	sql  string
+	vars []interface{}
+}
+
+// Abre o GORM com o dialeto do MySQL em DryRun: as consultas são montadas, mas nunca enviadas ao banco.
+// Sem a transação padrão, as gravações também não abrem conexão
+func newDryRunDB(t *testing.T) (*gorm.DB, *[]capturedQuery) {
+	db, err := gorm.Open(mysql.New(mysql.Config{
+		DSN:                       "user:password@tcp(127.0.0.1:3306)/users?parseTime=true",
+		SkipInitializeWithVersion: true,
+	}), &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatalf("Error opening dry run database: %s", err.Error())
+	}
+
+	var queries []capturedQuery
+	capture := func(tx *gorm.DB) {
+		queries = append(queries, capturedQuery{sql: tx.Statement.SQL.String(), vars: tx.Statement.Vars})
+	}
+	if err := db.Callback().Query().After("gorm:query").Register("test:capture", capture); err != nil {
+		t.Fatalf("Error registering callback: %s", err.Error())
+	}
+	if err := db.Callback().Delete().After("gorm:delete").Register("test:capture", capture); err != nil {
+		t.Fatalf("Error registering callback: %s", err.Error())
+	}
+	if err := db.Callback().Create().After("gorm:create").Register("test:capture", capture); err != nil {
+		t.Fatalf("Error registering callback: %s", err.Error())
+	}
+	return db, &queries
+}
+
+func filterSQL(db *gorm.DB, filter *UserFilter, now time.Time) string {
+	return db.ToSQL(func(tx *gorm.DB) *gorm.DB {
+		return filter.where(tx, now).Find(&[]*entity.User{})
+	})
+}
+
+func TestUserFilter_LikeEscaping(t *testing.T) {
+	db, queries := newDryRunDB(t)
+	repo := NewUserRepositoryImpl(db)
+
+	_, err := repo.FindAll(&UserFilter{Search: `50%_off\`, Name: "a_b", Email: "%@example.com"}, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, *queries, 1)
+
+	// Wildcards typed by the user are matched literally
+	query := (*queries)[0]
+	assert.Contains(t, query.sql, "WHERE ((name LIKE ? OR email LIKE ?)) AND name LIKE ? AND email LIKE ?")
+	assert.Equal(t, []interface{}{`%50\%\_off\\%`, `%50\%\_off\\%`, `%a\_b%`, `%\%@example.com%`}, query.vars[:4])
+}
+
+func TestUserFilter_AgeBoundaries(t *testing.T) {
+	db, _ := newDryRunDB(t)
+	minAge, maxAge := 18, 30
+
+	tests := []struct {
+		name string
+		now  time.Time
+		min  string
+		max  string
+	}{
+		{"regular day", time.Date(2026, 10, 18, 15, 0, 0, 0, time.UTC), "2008-10-18", "1995-10-18"},
+		{"first day of the year", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), "2008-01-01", "1995-01-01"},
+		// Born on February 28 of a non-leap year completes the age on February 29, not on March 1
+		{"leap day", time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC), "2010-02-28", "1997-02-28"},
+	}
+	for _, tt := range tests {
+		sql := filterSQL(db, &UserFilter{MinAge: &minAge, MaxAge: &maxAge}, tt.now)
+		assert.Contains(t, sql, "birth_date <= '"+tt.min+"'", tt.name)
+		assert.Contains(t, sql, "birth_date > '"+tt.max+"'", tt.name)
+	}
+
+	// Leap day births in a leap year keep the same day
+	twelve := 12
+	sql := filterSQL(db, &UserFilter{MinAge: &twelve}, time.Date(2028, 2, 29, 12, 0, 0, 0, time.UTC))
+	assert.Contains(t, sql, "birth_date <= '2016-02-29'")
+}
+
+func TestUserFilter_AddressPredicates(t *testing.T) {
+	db, queries := newDryRunDB(t)
+	repo := NewUserRepositoryImpl(db)
+
+	_, err := repo.FindAll(&UserFilter{City: "São Paulo", Country: "Brasil"}, 1, 10)
+	assert.NoError(t, err)
+	assert.Len(t, *queries, 1)
+
+	// The JSON path is a bound parameter, never concatenated into the SQL
+	query := (*queries)[0]
+	assert.Contains(t, query.sql, "JSON_UNQUOTE(JSON_EXTRACT(address, ?)) = ? AND JSON_UNQUOTE(JSON_EXTRACT(address, ?)) = ?")
+	assert.NotContains(t, query.sql, "$.state")
+	assert.Equal(t, []interface{}{"$.city", "São Paulo", "$.country", "Brasil"}, query.vars[:4])
+}
+
+func TestUserFilter_Sort(t *testing.T) {
+	db, queries := newDryRunDB(t)
+	repo := NewUserRepositoryImpl(db)
+
+	// Keys outside the allow-list are rejected before any query is built
+	for _, field := range []string{"password", "name; DROP TABLE users", "birth_date"} {
+		_, err := repo.FindAll(&UserFilter{Sort: []UserSort{{Field: field}}}, 1, 10)
+		assert.True(t, errors.Is(err, ErrInvalidSort), field)
+	}
+	assert.Empty(t, *queries)
+
+	// Age is sorted by the birth date in the opposite direction, with the id as tiebreaker
+	_, err := repo.FindAll(&UserFilter{Sort: []UserSort{{Field: "age", Desc: true}, {Field: "name"}}}, 2, 10)
+	assert.NoError(t, err)
+	assert.Len(t, *queries, 1)
+	assert.Contains(t, (*queries)[0].sql, "ORDER BY birth_date ASC,name ASC,id LIMIT 10 OFFSET 10")
+}
+
+func TestUserRepository_FilterIsApplied(t *testing.T) {
+	db, queries := newDryRunDB(t)
+	repo := NewUserRepositoryImpl(db)
+	filter := &UserFilter{Profile: "admin", State: "SP"}
+
+	_, err := repo.Count(filter)
+	assert.NoError(t, err)
+	_, err = repo.FindAfterID(filter, 10, false, 5)
+	assert.NoError(t, err)
+	err = repo.FindInBatches(filter, 100, func(users []*entity.User) error { return nil })
+	assert.NoError(t, err)
+
+	// Every listing path narrows the query by the same conditions
+	assert.Len(t, *queries, 3)
+	for _, query := range *queries {
+		assert.Contains(t, query.sql, "profile = ? AND JSON_UNQUOTE(JSON_EXTRACT(address, ?)) = ?")
+		assert.Contains(t, query.vars, "admin")
+		assert.Contains(t, query.vars, "SP")
+	}
+	assert.Contains(t, (*queries)[0].sql, "SELECT count(*)")
+	assert.Contains(t, (*queries)[1].sql, "id > ?")
+}
+
+func TestTranslateError(t *testing.T) {
+	assert.Equal(t, ErrNotFound, translateError(gorm.ErrRecordNotFound))
+	assert.Equal(t, ErrDuplicateKey, translateError(&mysqldriver.MySQLError{Number: 1062, Message: "Duplicate entry 'john@example.com' for key 'users.email'"}))
+
+	// Other MySQL errors are returned unchanged
+	deadlock := &mysqldriver.MySQLError{Number: 1213, Message: "Deadlock found when trying to get lock"}
+	assert.Equal(t, deadlock, translateError(deadlock))
+	assert.NoError(t, translateError(nil))
+}
+
+func TestUserRepository_EmailInUse(t *testing.T) {
+	db, queries := newDryRunDB(t)
+	repo := NewUserRepositoryImpl(db)
+
+	_, err := repo.EmailInUse("john@example.com", 7)
+	assert.NoError(t, err)
+	assert.Len(t, *queries, 1)
+
+	// Deleted users and pending changes of other users keep the email reserved
+	query := (*queries)[0]
+	assert.Contains(t, query.sql, "WHERE (email = ? OR pending_email = ?) AND id <> ?")
+	assert.NotContains(t, query.sql, "deleted_at IS NULL")
+	assert.Equal(t, []interface{}{"john@example.com", "john@example.com", uint64(7)}, query.vars)
+}
+
+func TestLoginAttemptRepository_PurgeIdle(t *testing.T) {
+	db, queries := newDryRunDB(t)
+	repo := NewLoginAttemptRepositoryImpl(db)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	_, err := repo.PurgeIdle(now, 15*time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, *queries, 1)
+
+	// A single statement removes the keys without recent attempts, failures in the window or an active lockout
+	query := (*queries)[0]
+	assert.Contains(t, query.sql, "DELETE FROM `login_attempts` WHERE (last_attempt IS NULL OR last_attempt < ?) AND (last_failure IS NULL OR last_failure < ?) AND (locked_until IS NULL OR locked_until < ?)")
+	assert.Equal(t, []interface{}{now.Add(-pendingAttemptTimeout), now.Add(-15 * time.Minute), now}, query.vars)
+}
+
+func TestInMemoryLoginAttemptRepository_PurgeIdle(t *testing.T) {
+	repo := NewInMemoryLoginAttemptRepository()
+	limits := AttemptLimits{MaxFailures: 2, Window: 15 * time.Minute, Lockout: time.Hour}
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	for _, key := range []string{"released", "failed", "locked", "pending"} {
+		_, acquired, _ := repo.Acquire(key, start, limits)
+		assert.True(t, acquired, key)
+	}
+	repo.Release("released")
+	repo.Fail("failed", start, limits)
+	repo.Fail("locked", start, limits)
+	repo.Acquire("locked", start, AttemptLimits{MaxFailures: 3, Window: limits.Window})
+	repo.Fail("locked", start, limits)
+
+	// Acquiring a key leaves the others untouched until the purge runs
+	later := start.Add(2 * time.Minute)
+	repo.Acquire("other", later, limits)
+	purged, err := repo.PurgeIdle(later, limits.Window)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), purged, "released and abandoned pending attempts")
+
+	// Failures are kept for the whole window and lockouts until they end
+	purged, _ = repo.PurgeIdle(start.Add(16*time.Minute), limits.Window)
+	assert.Equal(t, int64(2), purged, "expired failures and the other key")
+	purged, _ = repo.PurgeIdle(start.Add(61*time.Minute), limits.Window)
+	assert.Equal(t, int64(1), purged, "expired lockout")
+}
+
+func TestTokenRevocationRepository_RevokeAllForUsers(t *testing.T) {
+	db, queries := newDryRunDB(t)
+	repo := NewTokenRevocationRepositoryImpl(db)
+	cutoff := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	assert.NoError(t, repo.RevokeAllForUsers(nil, cutoff))
+	assert.Empty(t, *queries)
+
+	// All users are revoked by a single upsert
+	assert.NoError(t, repo.RevokeAllForUsers([]uint64{1, 2, 3}, cutoff))
+	assert.Len(t, *queries, 1)
+	query := (*queries)[0]
+	assert.Contains(t, query.sql, "INSERT INTO `user_token_revocations`")
+	assert.Contains(t, query.sql, "ON DUPLICATE KEY UPDATE `revoked_before`=VALUES(`revoked_before`),`updated_at`=VALUES(`updated_at`)")
+	assert.Contains(t, query.vars, uint64(3))
+	assert.Equal(t, 2, strings.Count(query.sql, "),("), "one VALUES tuple per user")
+}
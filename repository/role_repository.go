@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"gorm.io/gorm"
+)
+
+type RoleRepository interface {
+	Create(role *entity.Role) error
+	FindByID(id uint64) (*entity.Role, error)
+	FindByName(name string) (*entity.Role, error)
+	FindAll() ([]*entity.Role, error)
+	UpdatePermissions(role *entity.Role, permissions []entity.Permission) error
+	Delete(id uint64) error
+	FindPermissions() ([]entity.Permission, error)
+	FindPermissionsByName(names []string) ([]entity.Permission, error)
+	FindByUser(userID uint64) ([]*entity.Role, error)
+	AssignToUser(userID, roleID uint64) error
+	RemoveFromUser(userID, roleID uint64) (bool, error)
+	PermissionsForUser(userID uint64, profile string) ([]string, error)
+	FindUserIDs(role *entity.Role) ([]uint64, error)
+}
+
+type RoleRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewRoleRepositoryImpl(db *gorm.DB) RoleRepository {
+	return &RoleRepositoryImpl{
+		db: db,
+	}
+}
+
+func (r *RoleRepositoryImpl) Create(role *entity.Role) error {
+	return r.db.Create(role).Error
+}
+
+func (r *RoleRepositoryImpl) FindByID(id uint64) (*entity.Role, error) {
+	var role entity.Role
+	if err := r.db.Preload("Permissions").First(&role, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &role, nil
+}
+
+func (r *RoleRepositoryImpl) FindByName(name string) (*entity.Role, error) {
+	var role entity.Role
+	if err := r.db.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &role, nil
+}
+
+func (r *RoleRepositoryImpl) FindAll() ([]*entity.Role, error) {
+	var roles []*entity.Role
+	err := r.db.Preload("Permissions").Order("id").Find(&roles).Error
+	return roles, err
+}
+
+// Substitui as permissões do papel pelas informadas
+func (r *RoleRepositoryImpl) UpdatePermissions(role *entity.Role, permissions []entity.Permission) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Update("description", role.Description).Error; err != nil {
+			return err
+		}
+		return tx.Model(role).Association("Permissions").Replace(permissions)
+	})
+}
+
+// Remove o papel junto com suas atribuições
+func (r *RoleRepositoryImpl) Delete(id uint64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role_id = ?", id).Delete(&entity.UserRole{}).Error; err != nil {
+			return err
+		}
+		role := &entity.Role{ID: id}
+		if err := tx.Model(role).Association("Permissions").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(role).Error
+	})
+}
+
+func (r *RoleRepositoryImpl) FindPermissions() ([]entity.Permission, error) {
+	var permissions []entity.Permission
+	err := r.db.Order("name").Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *RoleRepositoryImpl) FindPermissionsByName(names []string) ([]entity.Permission, error) {
+	var permissions []entity.Permission
+	if len(names) == 0 {
+		return permissions, nil
+	}
+	err := r.db.Where("name IN ?", names).Find(&permissions).Error
+	return permissions, err
+}
+
+func (r *RoleRepositoryImpl) FindByUser(userID uint64) ([]*entity.Role, error) {
+	var roles []*entity.Role
+	err := r.db.Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ?", userID).
+		Order("roles.id").
+		Find(&roles).Error
+	return roles, err
+}
+
+// Atribui o papel ao usuário; atribuições repetidas são ignoradas
+func (r *RoleRepositoryImpl) AssignToUser(userID, roleID uint64) error {
+	userRole := &entity.UserRole{UserID: userID, RoleID: roleID, CreatedAt: time.Now()}
+	return r.db.Where(entity.UserRole{UserID: userID, RoleID: roleID}).FirstOrCreate(userRole).Error
+}
+
+func (r *RoleRepositoryImpl) RemoveFromUser(userID, roleID uint64) (bool, error) {
+	result := r.db.Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&entity.UserRole{})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Permissões efetivas: as do papel com o nome do perfil somadas às dos papéis atribuídos ao usuário
+func (r *RoleRepositoryImpl) PermissionsForUser(userID uint64, profile string) ([]string, error) {
+	var names []string
+	err := r.db.Model(&entity.Permission{}).
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Joins("JOIN roles ON roles.id = role_permissions.role_id").
+		Joins("LEFT JOIN user_roles ON user_roles.role_id = roles.id AND user_roles.user_id = ?", userID).
+		Where("roles.name = ? OR user_roles.user_id IS NOT NULL", profile).
+		Order("permissions.name").
+		Pluck("permissions.name", &names).Error
+	return names, err
+}
+
+// Usuários que recebem as permissões do papel: os que o têm atribuído e os do perfil com o mesmo nome
+func (r *RoleRepositoryImpl) FindUserIDs(role *entity.Role) ([]uint64, error) {
+	var ids []uint64
+	assigned := r.db.Model(&entity.UserRole{}).Select("user_id").Where("role_id = ?", role.ID)
+	err := r.db.Model(&entity.User{}).
+		Where("profile = ? OR id IN (?)", role.Name, assigned).
+		Pluck("id", &ids).Error
+	return ids, err
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TokenRevocationRepository interface {
+	RevokeToken(jti string, userID uint64, expiresAt time.Time) error
+	ConsumeToken(jti string, userID uint64, expiresAt time.Time) (bool, error)
+	RevokeUserTokens(userID uint64, issuedBefore time.Time) error
+	// Aplica o mesmo corte a vários usuários de uma só vez
+	RevokeAllForUsers(userIDs []uint64, issuedBefore time.Time) error
+	IsRevoked(jti string, userID uint64, issuedAt time.Time) (bool, error)
+}
+
+type TokenRevocationRepositoryImpl struct {
+	db *gorm.DB
+}
+
+func NewTokenRevocationRepositoryImpl(db *gorm.DB) TokenRevocationRepository {
+	return &TokenRevocationRepositoryImpl{
+		db: db,
+	}
+}
+
+func (r *TokenRevocationRepositoryImpl) RevokeToken(jti string, userID uint64, expiresAt time.Time) error {
+	revoked := &entity.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	}
+	if err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(revoked).Error; err != nil {
+		return err
+	}
+
+	// Tokens expirados já são rejeitados pela validação, não precisam continuar na lista
+	return r.db.Where("expires_at < ?", time.Now()).Delete(&entity.RevokedToken{}).Error
+}
+
+// Marca um token de uso único como utilizado. Retorna false se ele já tinha sido utilizado ou revogado
+func (r *TokenRevocationRepositoryImpl) ConsumeToken(jti string, userID uint64, expiresAt time.Time) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+func (r *TokenRevocationRepositoryImpl) RevokeUserTokens(userID uint64, issuedBefore time.Time) error {
+	revocation := &entity.UserTokenRevocation{
+		UserID:        userID,
+		RevokedBefore: issuedBefore,
+	}
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_before", "updated_at"}),
+	}).Create(revocation).Error
+}
+
+func (r *TokenRevocationRepositoryImpl) RevokeAllForUsers(userIDs []uint64, issuedBefore time.Time) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	revocations := make([]*entity.UserTokenRevocation, 0, len(userIDs))
+	for _, userID := range userIDs {
+		revocations = append(revocations, &entity.UserTokenRevocation{
+			UserID:        userID,
+			RevokedBefore: issuedBefore,
+		})
+	}
+	return r.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"revoked_before", "updated_at"}),
+	}).Create(&revocations).Error
+}
+
+func (r *TokenRevocationRepositoryImpl) IsRevoked(jti string, userID uint64, issuedAt time.Time) (bool, error) {
+	if jti != "" {
+		var count int64
+		if err := r.db.Model(&entity.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+			return false, err
+		}
+		if count > 0 {
+			return true, nil
+		}
+	}
+
+	var revocation entity.UserTokenRevocation
+	err := r.db.Where("user_id = ?", userID).Limit(1).Find(&revocation).Error
+	if err != nil {
+		return false, err
+	}
+	return issuedBefore(issuedAt, revocation.RevokedBefore), nil
+}
+
+// Implementação em memória, útil para testes e para execuções com uma única instância
+type InMemoryTokenRevocationRepository struct {
+	mu          sync.RWMutex
+	tokens      map[string]time.Time
+	userCutoffs map[uint64]time.Time
+}
+
+func NewInMemoryTokenRevocationRepository() TokenRevocationRepository {
+	return &InMemoryTokenRevocationRepository{
+		tokens:      make(map[string]time.Time),
+		userCutoffs: make(map[uint64]time.Time),
+	}
+}
+
+func (r *InMemoryTokenRevocationRepository) RevokeToken(jti string, userID uint64, expiresAt time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removeExpired()
+	r.tokens[jti] = expiresAt
+	return nil
+}
+
+func (r *InMemoryTokenRevocationRepository) ConsumeToken(jti string, userID uint64, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.removeExpired()
+	if _, ok := r.tokens[jti]; ok {
+		return false, nil
+	}
+	r.tokens[jti] = expiresAt
+	return true, nil
+}
+
+// Tokens expirados já são rejeitados pela validação, não precisam continuar na lista
+func (r *InMemoryTokenRevocationRepository) removeExpired() {
+	now := time.Now()
+	for revokedJTI, expiration := range r.tokens {
+		if expiration.Before(now) {
+			delete(r.tokens, revokedJTI)
+		}
+	}
+}
+
+func (r *InMemoryTokenRevocationRepository) RevokeUserTokens(userID uint64, issuedBefore time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.userCutoffs[userID] = issuedBefore
+	return nil
+}
+
+func (r *InMemoryTokenRevocationRepository) RevokeAllForUsers(userIDs []uint64, issuedBefore time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, userID := range userIDs {
+		r.userCutoffs[userID] = issuedBefore
+	}
+	return nil
+}
+
+func (r *InMemoryTokenRevocationRepository) IsRevoked(jti string, userID uint64, issuedAt time.Time) (bool, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if _, ok := r.tokens[jti]; ok && jti != "" {
+		return true, nil
+	}
+	return issuedBefore(issuedAt, r.userCutoffs[userID]), nil
+}
+
+// O claim "iat" e o corte têm precisão de microssegundos
+func issuedBefore(issuedAt, cutoff time.Time) bool {
+	if cutoff.IsZero() {
+		return false
+	}
+	return issuedAt.Before(cutoff)
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidField = errors.New("unknown field")
+
+// Campos de usuário aceitos em fields, com as colunas necessárias para montá-los. Somente estas colunas chegam ao SQL
+var userFieldColumns = map[string][]string{
+	"id":               {"id"},
+	"name":             {"name"},
+	"email":            {"email"},
+	"birthDate":        {"birth_date"},
+	"age":              {"birth_date"},
+	"profile":          {"profile"},
+	"address":          {"address"},
+	"emailVerified":    {"email_verified"},
+	"pendingEmail":     {"pending_email"},
+	"twoFactorEnabled": {"two_factor_enabled"},
+	"status":           {"status"},
+	"statusReason":     {"status_reason"},
+	"suspendedUntil":   {"suspended_until"},
+	"createdAt":        {"created_at"},
+	"deletedAt":        {"deleted_at"},
+}
+
+// Seleciona somente as colunas dos campos informados. O id e a versão são sempre carregados,
+// pois a paginação e o ETag dependem deles
+func selectUserFields(db *gorm.DB, fields []string) (*gorm.DB, error) {
+	if len(fields) == 0 {
+		return db, nil
+	}
+
+	columns := []string{"id", "version"}
+	seen := map[string]bool{"id": true, "version": true}
+	for _, field := range fields {
+		fieldColumns, ok := userFieldColumns[field]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidField, field)
+		}
+		for _, column := range fieldColumns {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+	return db.Select(columns), nil
+}
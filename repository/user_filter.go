@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrInvalidSort = errors.New("invalid sort field")
+
+// Critérios de busca da listagem de usuários. Campos vazios não filtram
+type UserFilter struct {
+	// Trecho do nome ou do e-mail
+	Search  string
+	Name    string
+	Email   string
+	Profile string
+	MinAge  *int
+	MaxAge  *int
+	City    string
+	State   string
+	Country string
+	// Intervalo da data de cadastro, com início inclusivo e fim exclusivo
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	Sort        []UserSort
+	// Campos a carregar; vazio carrega todos
+	Fields []string
+}
+
+type UserSort struct {
+	Field string
+	Desc  bool
+}
+
+type sortColumn struct {
+	column string
+	// A idade é ordenada pela data de nascimento, em sentido inverso
+	inverted bool
+}
+
+// Campos aceitos em sort. Somente estes nomes chegam ao SQL
+var userSortColumns = map[string]sortColumn{
+	"id":        {column: "id"},
+	"name":      {column: "name"},
+	"email":     {column: "email"},
+	"profile":   {column: "profile"},
+	"status":    {column: "status"},
+	"birthDate": {column: "birth_date"},
+	"age":       {column: "birth_date", inverted: true},
+	"createdAt": {column: "created_at"},
+}
+
+func (f *UserFilter) apply(db *gorm.DB, now time.Time) (*gorm.DB, error) {
+	if f == nil {
+		return db.Order("id"), nil
+	}
+
+	db, err := selectUserFields(f.where(db, now), f.Fields)
+	if err != nil {
+		return nil, err
+	}
+	return applyUserSort(db, f.Sort)
+}
+
+// Aplica somente as condições do filtro, sem a ordenação
+func (f *UserFilter) where(db *gorm.DB, now time.Time) *gorm.DB {
+	if f == nil {
+		return db
+	}
+
+	if f.Search != "" {
+		pattern := likePattern(f.Search)
+		db = db.Where("(name LIKE ? OR email LIKE ?)", pattern, pattern)
+	}
+	if f.Name != "" {
+		db = db.Where("name LIKE ?", likePattern(f.Name))
+	}
+	if f.Email != "" {
+		db = db.Where("email LIKE ?", likePattern(f.Email))
+	}
+	if f.Profile != "" {
+		db = db.Where("profile = ?", f.Profile)
+	}
+
+	// A data de nascimento é gravada como YYYY-MM-DD, então a comparação de texto respeita a ordem das datas
+	if f.MinAge != nil {
+		db = db.Where("birth_date <= ?", yearsBefore(now, *f.MinAge))
+	}
+	if f.MaxAge != nil {
+		db = db.Where("birth_date > ?", yearsBefore(now, *f.MaxAge+1))
+	}
+
+	// O endereço é gravado como JSON: os campos são extraídos no próprio banco
+	address := []struct{ path, value string }{
+		{"$.city", f.City},
+		{"$.state", f.State},
+		{"$.country", f.Country},
+	}
+	for _, field := range address {
+		if field.value != "" {
+			db = db.Where("JSON_UNQUOTE(JSON_EXTRACT(address, ?)) = ?", field.path, field.value)
+		}
+	}
+
+	if f.CreatedFrom != nil {
+		db = db.Where("created_at >= ?", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		db = db.Where("created_at < ?", *f.CreatedTo)
+	}
+
+	return db
+}
+
+// Ordena pelos campos informados, desempatando pelo id para manter a paginação estável
+func applyUserSort(db *gorm.DB, sort []UserSort) (*gorm.DB, error) {
+	sortedByID := false
+	for _, s := range sort {
+		column, ok := userSortColumns[s.Field]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidSort, s.Field)
+		}
+
+		direction := "ASC"
+		if s.Desc != column.inverted {
+			direction = "DESC"
+		}
+		db = db.Order(column.column + " " + direction)
+		sortedByID = sortedByID || column.column == "id"
+	}
+
+	if !sortedByID {
+		db = db.Order("id")
+	}
+	return db, nil
+}
+
+// Data, no formato YYYY-MM-DD, em que quem completa a idade hoje nasceu. Em 29 de fevereiro, quando o ano de
+// nascimento não é bissexto, a data é 28 de fevereiro, e não 1º de março, como em utils.CalculateAge
+func yearsBefore(now time.Time, years int) string {
+	date := now.AddDate(-years, 0, 0)
+	if date.Day() != now.Day() {
+		date = date.AddDate(0, 0, -date.Day())
+	}
+	return date.Format("2006-01-02")
+}
+
+// Escapa os curingas do LIKE para que o termo seja buscado literalmente
+func likePattern(term string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + replacer.Replace(term) + "%"
+}
@@ -1,17 +1,33 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type UserRepository interface {
 	Create(user *entity.User) error
+	CreateBatch(users []*entity.User) error
+	ExistingEmails(emails []string) (map[string]bool, error)
 	FindByID(id uint64) (*entity.User, error)
-	FindAll(page, pageSize int) ([]*entity.User, error)
+	FindByIDWithFields(id uint64, fields []string) (*entity.User, error)
+	FindAll(filter *UserFilter, page, pageSize int) ([]*entity.User, error)
+	FindAfterID(filter *UserFilter, cursorID uint64, backward bool, limit int) ([]*entity.User, error)
+	Count(filter *UserFilter) (int64, error)
+	FindInBatches(filter *UserFilter, batchSize int, process func(users []*entity.User) error) error
 	Update(user *entity.User) error
-	Delete(id uint64) error
+	UseTOTPStep(id uint64, step int64) (bool, error)
+	Delete(id, version uint64) (bool, error)
 	FindByEmail(email string) (*entity.User, error)
+	UpdateProfile(id uint64, profile string) (bool, error)
+	UpdateStatus(id uint64, status, reason string, suspendedUntil *time.Time) (bool, error)
+	EmailInUse(email string, exceptID uint64) (bool, error)
+	FindDeleted(page, pageSize int) ([]*entity.User, error)
+	Restore(id uint64) error
+	PurgeDeleted(before time.Time, limit int) (int64, error)
 }
 
 type UserRepositoryImpl struct {
@@ -25,22 +41,71 @@ func NewUserRepositoryImpl(db *gorm.DB) UserRepository {
 }
 
 func (r *UserRepositoryImpl) Create(user *entity.User) error {
-	return r.db.Create(user).Error
+	return translateError(r.db.Create(user).Error)
+}
+
+// Insere os usuários em uma única transação: se algum falhar, nenhum é inserido
+func (r *UserRepositoryImpl) CreateBatch(users []*entity.User) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&users).Error
+	})
+}
+
+// Retorna quais dos e-mails já estão em uso, inclusive por usuários excluídos ainda não expurgados
+func (r *UserRepositoryImpl) ExistingEmails(emails []string) (map[string]bool, error) {
+	const chunkSize = 1000
+
+	existing := make(map[string]bool)
+	for start := 0; start < len(emails); start += chunkSize {
+		end := start + chunkSize
+		if end > len(emails) {
+			end = len(emails)
+		}
+
+		var found []string
+		err := r.db.Unscoped().Model(&entity.User{}).Where("email IN ?", emails[start:end]).Pluck("email", &found).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, email := range found {
+			existing[email] = true
+		}
+	}
+	return existing, nil
 }
 
 func (r *UserRepositoryImpl) FindByID(id uint64) (*entity.User, error) {
 	var user entity.User
 	if err := r.db.First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
+	return &user, nil
+}
+
+// Carrega somente as colunas necessárias para os campos informados
+func (r *UserRepositoryImpl) FindByIDWithFields(id uint64, fields []string) (*entity.User, error) {
+	query, err := selectUserFields(r.db, fields)
+	if err != nil {
 		return nil, err
 	}
+
+	var user entity.User
+	if err := query.First(&user, id).Error; err != nil {
+		return nil, translateError(err)
+	}
 	return &user, nil
 }
 
-func (r *UserRepositoryImpl) FindAll(page, pageSize int) ([]*entity.User, error) {
+func (r *UserRepositoryImpl) FindAll(filter *UserFilter, page, pageSize int) ([]*entity.User, error) {
 	var users []*entity.User
 	offset := (page - 1) * pageSize
 
-	result := r.db.Limit(pageSize).Offset(offset).Find(&users)
+	query, err := filter.apply(r.db, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	result := query.Limit(pageSize).Offset(offset).Find(&users)
 	if result.Error != nil {
 		return nil, result.Error
 	}
@@ -48,19 +113,256 @@ func (r *UserRepositoryImpl) FindAll(page, pageSize int) ([]*entity.User, error)
 	return users, nil
 }
 
+// Paginação por keyset: retorna os usuários com ID maior que o cursor, em ordem crescente,
+// ou, com backward, os com ID menor, em ordem decrescente
+func (r *UserRepositoryImpl) FindAfterID(filter *UserFilter, cursorID uint64, backward bool, limit int) ([]*entity.User, error) {
+	var users []*entity.User
+
+	query := filter.where(r.db, time.Now())
+	if filter != nil {
+		var err error
+		if query, err = selectUserFields(query, filter.Fields); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case backward:
+		query = query.Where("id < ?", cursorID).Order("id DESC")
+	case cursorID > 0:
+		query = query.Where("id > ?", cursorID).Order("id")
+	default:
+		query = query.Order("id")
+	}
+
+	if err := query.Limit(limit).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *UserRepositoryImpl) Count(filter *UserFilter) (int64, error) {
+	var total int64
+	err := filter.where(r.db.Model(&entity.User{}), time.Now()).Count(&total).Error
+	return total, err
+}
+
+// Percorre os usuários que atendem ao filtro em lotes ordenados pelo ID, sem carregar todos na memória.
+// A ordenação do filtro é ignorada
+func (r *UserRepositoryImpl) FindInBatches(filter *UserFilter, batchSize int, process func(users []*entity.User) error) error {
+	query := filter.where(r.db, time.Now())
+	if filter != nil {
+		var err error
+		if query, err = selectUserFields(query, filter.Fields); err != nil {
+			return err
+		}
+	}
+
+	var users []*entity.User
+	return query.FindInBatches(&users, batchSize, func(tx *gorm.DB, batch int) error {
+		return process(users)
+	}).Error
+}
+
+// Grava o usuário somente se ele não foi alterado desde que foi lido, incrementando a versão.
+// Caso contrário, retorna ErrVersionConflict sem alterar nada. O último passo TOTP só é gravado por UseTOTPStep
 func (r *UserRepositoryImpl) Update(user *entity.User) error {
-	return r.db.Save(user).Error
+	version := user.Version
+	user.Version++
+
+	result := r.db.Model(user).
+		Where("version = ?", version).
+		Select("*").
+		Omit("id", "created_at", "deleted_at", "totp_last_step").
+		Updates(user)
+	if result.Error == nil && result.RowsAffected == 0 {
+		result.Error = ErrVersionConflict
+	}
+	if result.Error != nil {
+		user.Version = version
+		return translateError(result.Error)
+	}
+	return nil
+}
+
+// Registra o passo de tempo do código TOTP aceito. Retorna false se um código do mesmo passo ou de um posterior
+// já foi usado; a atualização condicional impede que requisições simultâneas aceitem o mesmo código
+func (r *UserRepositoryImpl) UseTOTPStep(id uint64, step int64) (bool, error) {
+	result := r.db.Model(&entity.User{}).
+		Where("id = ? AND totp_last_step < ?", id, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Exclui logicamente o usuário. Retorna false, sem excluir, se ele for o último administrador.
+// Com version diferente de zero, só exclui se o usuário ainda estiver nessa versão
+func (r *UserRepositoryImpl) Delete(id, version uint64) (bool, error) {
+	return r.keepingAdmin(id, func(tx *gorm.DB) error {
+		query := tx.Where("id = ?", id)
+		if version != 0 {
+			query = query.Where("version = ?", version)
+		}
+
+		result := query.Delete(&entity.User{})
+		if result.Error == nil && version != 0 && result.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+		return result.Error
+	})
+}
+
+// Altera o perfil do usuário. Retorna false, sem alterar, se ele for o último administrador e deixar de sê-lo
+func (r *UserRepositoryImpl) UpdateProfile(id uint64, profile string) (bool, error) {
+	update := func(tx *gorm.DB) error {
+		return tx.Model(&entity.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"profile": profile,
+			"version": gorm.Expr("version + 1"),
+		}).Error
+	}
+	if profile == entity.RoleAdmin {
+		return true, update(r.db)
+	}
+	return r.keepingAdmin(id, update)
 }
 
-func (r *UserRepositoryImpl) Delete(id uint64) error {
-	return r.db.Delete(&entity.User{}, id).Error
+// Altera a situação da conta. Retorna false, sem alterar, se o usuário for o último administrador ativo e deixar de sê-lo
+func (r *UserRepositoryImpl) UpdateStatus(id uint64, status, reason string, suspendedUntil *time.Time) (bool, error) {
+	update := func(tx *gorm.DB) error {
+		return tx.Model(&entity.User{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"status":          status,
+			"status_reason":   reason,
+			"suspended_until": suspendedUntil,
+			"version":         gorm.Expr("version + 1"),
+		}).Error
+	}
+	if status == entity.UserStatusActive {
+		return true, update(r.db)
+	}
+	return r.keepingAdmin(id, update)
+}
+
+// Executa a alteração bloqueando os administradores ativos, para que alterações concorrentes não removam todos eles
+func (r *UserRepositoryImpl) keepingAdmin(id uint64, change func(tx *gorm.DB) error) (bool, error) {
+	allowed := true
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		// Somente administradores ativos contam: suspensões com prazo vencido voltam a valer como ativas
+		var adminIDs []uint64
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Model(&entity.User{}).
+			Where("profile = ?", entity.RoleAdmin).
+			Where("status = ? OR (status = ? AND suspended_until <= ?)", entity.UserStatusActive, entity.UserStatusSuspended, time.Now()).
+			Pluck("id", &adminIDs).Error
+		if err != nil {
+			return err
+		}
+
+		if len(adminIDs) == 1 && adminIDs[0] == id {
+			allowed = false
+			return nil
+		}
+		return change(tx)
+	})
+	if err != nil {
+		return false, err
+	}
+	return allowed, nil
 }
 
 func (r *UserRepositoryImpl) FindByEmail(email string) (*entity.User, error) {
 	var user entity.User
 	result := r.db.Where("email = ?", email).First(&user)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, translateError(result.Error)
 	}
 	return &user, nil
 }
+
+// Considera também os usuários excluídos: o e-mail continua reservado até o expurgo, permitindo a restauração.
+// O e-mail pendente de confirmação de outro usuário também está reservado; exceptID ignora o próprio usuário
+func (r *UserRepositoryImpl) EmailInUse(email string, exceptID uint64) (bool, error) {
+	var count int64
+	err := r.db.Unscoped().Model(&entity.User{}).
+		Where("(email = ? OR pending_email = ?) AND id <> ?", email, email, exceptID).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Lista os usuários excluídos, do mais recente para o mais antigo
+func (r *UserRepositoryImpl) FindDeleted(page, pageSize int) ([]*entity.User, error) {
+	var users []*entity.User
+	offset := (page - 1) * pageSize
+
+	result := r.db.Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Limit(pageSize).
+		Offset(offset).
+		Find(&users)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	return users, nil
+}
+
+func (r *UserRepositoryImpl) Restore(id uint64) error {
+	result := r.db.Unscoped().
+		Model(&entity.User{}).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Updates(map[string]interface{}{
+			"deleted_at": nil,
+			"version":    gorm.Expr("version + 1"),
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Remove definitivamente até limit usuários excluídos antes do instante informado, junto com as suas credenciais.
+// O registro das personificações é mantido para auditoria
+func (r *UserRepositoryImpl) PurgeDeleted(before time.Time, limit int) (int64, error) {
+	var purged int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var ids []uint64
+		err := tx.Unscoped().
+			Model(&entity.User{}).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Order("id").
+			Limit(limit).
+			Pluck("id", &ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		dependents := []interface{}{
+			&entity.RefreshToken{},
+			&entity.PasswordResetToken{},
+			&entity.RecoveryCode{},
+			&entity.APIKey{},
+			&entity.UserRole{},
+			&entity.UserTokenRevocation{},
+		}
+		for _, model := range dependents {
+			if err := tx.Where("user_id IN ?", ids).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		result := tx.Unscoped().Where("id IN ?", ids).Delete(&entity.User{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
@@ -0,0 +1,67 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"sort"
+)
+
+// JSON Web Key Set (RFC 7517) com as chaves públicas usadas na verificação dos tokens
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"`
+}
+
+// Retorna as chaves públicas. Chaves simétricas (HS256) nunca são publicadas
+func (m *KeyManager) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	for _, key := range m.keys {
+		switch publicKey := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "RSA",
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				KeyID:     key.ID,
+				N:         encodeBase64URL(publicKey.N.Bytes()),
+				E:         encodeBase64URL(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			size := (publicKey.Curve.Params().BitSize + 7) / 8
+			jwks.Keys = append(jwks.Keys, JWK{
+				KeyType:   "EC",
+				Use:       "sig",
+				Algorithm: key.Algorithm,
+				KeyID:     key.ID,
+				Curve:     publicKey.Curve.Params().Name,
+				X:         encodeBase64URL(publicKey.X.FillBytes(make([]byte, size))),
+				Y:         encodeBase64URL(publicKey.Y.FillBytes(make([]byte, size))),
+			})
+		}
+	}
+
+	// Ordem estável para facilitar o cache pelos clientes
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+
+	return jwks
+}
+
+func encodeBase64URL(bytes []byte) string {
+	return base64.RawURLEncoding.EncodeToString(bytes)
+}
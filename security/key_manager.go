@@ -0,0 +1,218 @@
+package security
+
+import (
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/config"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+type Key struct {
+	ID        string
+	Algorithm string
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Gerencia as chaves usadas para assinar e verificar os tokens JWT.
+// Somente a chave ativa assina novos tokens, mas todas as chaves carregadas são aceitas na verificação,
+// o que permite a rotação sem invalidar os tokens já emitidos
+type KeyManager struct {
+	active *Key
+	keys   map[string]*Key
+}
+
+func NewKeyManager(cfg config.KeysConfig) (*KeyManager, error) {
+	active, err := loadSigningKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	manager := &KeyManager{
+		active: active,
+		keys:   map[string]*Key{active.ID: active},
+	}
+
+	for _, entry := range cfg.VerificationKeys {
+		key, err := parseVerificationKey(entry)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := manager.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicated key id %q", key.ID)
+		}
+		manager.keys[key.ID] = key
+	}
+
+	return manager, nil
+}
+
+// Cria um gerenciador com uma única chave HS256
+func NewHMACKeyManager(keyID string, secret []byte) *KeyManager {
+	key := &Key{
+		ID:        keyID,
+		Algorithm: jwt.SigningMethodHS256.Alg(),
+		method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+	return &KeyManager{
+		active: key,
+		keys:   map[string]*Key{keyID: key},
+	}
+}
+
+// Assina os claims com a chave ativa, informando o "kid" no cabeçalho
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(m.active.method, claims)
+	token.Header["kid"] = m.active.ID
+	return token.SignedString(m.active.signKey)
+}
+
+// Verifica a assinatura e a validade do token usando a chave indicada pelo "kid"
+func (m *KeyManager) Parse(tokenString string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		key := m.active
+		// Tokens sem "kid" foram emitidos antes da rotação de chaves e usam a chave ativa
+		if kid, ok := token.Header["kid"].(string); ok {
+			key, ok = m.keys[kid]
+			if !ok {
+				return nil, ErrUnknownKey
+			}
+		}
+
+		// O algoritmo precisa ser o da chave, evitando ataques de troca de algoritmo
+		if token.Method.Alg() != key.Algorithm {
+			return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+		}
+		return key.verifyKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	return claims, nil
+}
+
+func loadSigningKey(cfg config.KeysConfig) (*Key, error) {
+	switch cfg.Algorithm {
+	case "HS256":
+		secret := []byte(cfg.Secret)
+		if len(secret) == 0 {
+			if !cfg.AllowEphemeralSecret {
+				return nil, errors.New("JWT_SECRET is required for HS256")
+			}
+			// Somente em desenvolvimento: os tokens deixam de valer a cada reinício da aplicação
+			log.Println("JWT_SECRET não configurado, utilizando um segredo temporário")
+			generated, err := utils.GenerateRandomToken(32)
+			if err != nil {
+				return nil, err
+			}
+			secret = []byte(generated)
+		}
+		return NewHMACKeyManager(cfg.KeyID, secret).active, nil
+	case "RS256", "ES256":
+		pemBytes, err := os.ReadFile(cfg.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read private key: %w", err)
+		}
+		return parsePrivateKey(cfg.KeyID, cfg.Algorithm, pemBytes)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", cfg.Algorithm)
+	}
+}
+
+func parsePrivateKey(keyID, algorithm string, pemBytes []byte) (*Key, error) {
+	key := &Key{ID: keyID, Algorithm: algorithm}
+
+	switch algorithm {
+	case "RS256":
+		privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		key.method = jwt.SigningMethodRS256
+		key.signKey = privateKey
+		key.verifyKey = &privateKey.PublicKey
+	case "ES256":
+		privateKey, err := jwt.ParseECPrivateKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		if privateKey.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 requires a P-256 key")
+		}
+		key.method = jwt.SigningMethodES256
+		key.signKey = privateKey
+		key.verifyKey = &privateKey.PublicKey
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	return key, nil
+}
+
+// Interpreta uma chave somente de verificação no formato "kid:ALG:valor", onde o valor é o segredo
+// para HS256 ou o caminho do arquivo PEM com a chave pública para RS256/ES256
+func parseVerificationKey(entry string) (*Key, error) {
+	parts := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid verification key %q, expected kid:ALG:value", entry)
+	}
+	keyID, algorithm, value := parts[0], parts[1], parts[2]
+
+	key := &Key{ID: keyID, Algorithm: algorithm}
+	switch algorithm {
+	case "HS256":
+		key.method = jwt.SigningMethodHS256
+		key.verifyKey = []byte(value)
+		return key, nil
+	case "RS256", "ES256":
+		pemBytes, err := os.ReadFile(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key %q: %w", keyID, err)
+		}
+		return parsePublicKey(key, pemBytes)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+}
+
+func parsePublicKey(key *Key, pemBytes []byte) (*Key, error) {
+	switch key.Algorithm {
+	case "RS256":
+		publicKey, err := jwt.ParseRSAPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		key.method = jwt.SigningMethodRS256
+		key.verifyKey = publicKey
+	case "ES256":
+		publicKey, err := jwt.ParseECPublicKeyFromPEM(pemBytes)
+		if err != nil {
+			return nil, err
+		}
+		if publicKey.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 requires a P-256 key")
+		}
+		key.method = jwt.SigningMethodES256
+		key.verifyKey = publicKey
+	}
+	return key, nil
+}
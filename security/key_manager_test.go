@@ -0,0 +1,163 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeRSAKey(t *testing.T, dir, name string) (privateFile, publicFile string) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicBytes, _ := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+
+	privateFile = filepath.Join(dir, name+".pem")
+	publicFile = filepath.Join(dir, name+".pub.pem")
+	os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(privateKey)}), 0600)
+	os.WriteFile(publicFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicBytes}), 0600)
+	return privateFile, publicFile
+}
+
+func writeECKey(t *testing.T, dir, name string) string {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateBytes, _ := x509.MarshalECPrivateKey(privateKey)
+
+	privateFile := filepath.Join(dir, name+".pem")
+	os.WriteFile(privateFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateBytes}), 0600)
+	return privateFile
+}
+
+func testClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"id":  1,
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+}
+
+func TestKeyManager_HS256(t *testing.T) {
+	manager, err := NewKeyManager(config.KeysConfig{Algorithm: "HS256", KeyID: "hs", Secret: "secret"})
+	assert.NoError(t, err)
+
+	tokenString, err := manager.Sign(testClaims())
+	assert.NoError(t, err)
+
+	claims, err := manager.Parse(tokenString)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), claims["id"])
+
+	// Symmetric keys are never published
+	assert.Empty(t, manager.JWKS().Keys)
+
+	// Tokens signed with another secret are rejected
+	other := NewHMACKeyManager("hs", []byte("other"))
+	otherToken, _ := other.Sign(testClaims())
+	_, err = manager.Parse(otherToken)
+	assert.Error(t, err)
+}
+
+func TestKeyManager_RS256Rotation(t *testing.T) {
+	dir := t.TempDir()
+	oldPrivate, oldPublic := writeRSAKey(t, dir, "old")
+	newPrivate, _ := writeRSAKey(t, dir, "new")
+
+	oldManager, err := NewKeyManager(config.KeysConfig{Algorithm: "RS256", KeyID: "old", PrivateKeyFile: oldPrivate})
+	assert.NoError(t, err)
+	oldToken, _ := oldManager.Sign(testClaims())
+
+	// The new active key still accepts tokens signed with the previous key
+	manager, err := NewKeyManager(config.KeysConfig{
+		Algorithm:        "RS256",
+		KeyID:            "new",
+		PrivateKeyFile:   newPrivate,
+		VerificationKeys: []string{"old:RS256:" + oldPublic},
+	})
+	assert.NoError(t, err)
+
+	_, err = manager.Parse(oldToken)
+	assert.NoError(t, err)
+
+	newToken, _ := manager.Sign(testClaims())
+	token, _, _ := new(jwt.Parser).ParseUnverified(newToken, jwt.MapClaims{})
+	assert.Equal(t, "new", token.Header["kid"])
+	assert.Equal(t, "RS256", token.Header["alg"])
+
+	jwks := manager.JWKS()
+	assert.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "new", jwks.Keys[0].KeyID)
+	assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+	assert.Equal(t, "AQAB", jwks.Keys[0].E)
+}
+
+func TestKeyManager_ES256(t *testing.T) {
+	privateFile := writeECKey(t, t.TempDir(), "ec")
+
+	manager, err := NewKeyManager(config.KeysConfig{Algorithm: "ES256", KeyID: "ec", PrivateKeyFile: privateFile})
+	assert.NoError(t, err)
+
+	tokenString, err := manager.Sign(testClaims())
+	assert.NoError(t, err)
+	_, err = manager.Parse(tokenString)
+	assert.NoError(t, err)
+
+	jwks := manager.JWKS()
+	assert.Len(t, jwks.Keys, 1)
+	assert.Equal(t, "EC", jwks.Keys[0].KeyType)
+	assert.Equal(t, "P-256", jwks.Keys[0].Curve)
+	assert.Len(t, jwks.Keys[0].X, 43)
+}
+
+func TestKeyManager_RejectsAlgorithmMismatch(t *testing.T) {
+	manager := NewHMACKeyManager("default", []byte("secret"))
+
+	// Unknown kid
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	token.Header["kid"] = "unknown"
+	tokenString, _ := token.SignedString([]byte("secret"))
+	_, err := manager.Parse(tokenString)
+	assert.Error(t, err)
+
+	// Algorithm different from the key's algorithm
+	token = jwt.NewWithClaims(jwt.SigningMethodHS512, testClaims())
+	token.Header["kid"] = "default"
+	tokenString, _ = token.SignedString([]byte("secret"))
+	_, err = manager.Parse(tokenString)
+	assert.Error(t, err)
+}
+
+func TestNewKeyManager_InvalidConfig(t *testing.T) {
+	_, err := NewKeyManager(config.KeysConfig{Algorithm: "none", KeyID: "default"})
+	assert.Error(t, err)
+
+	_, err = NewKeyManager(config.KeysConfig{Algorithm: "RS256", KeyID: "default", PrivateKeyFile: "/nonexistent.pem"})
+	assert.Error(t, err)
+
+	_, err = NewKeyManager(config.KeysConfig{Algorithm: "HS256", KeyID: "default", Secret: "secret", VerificationKeys: []string{"invalid"}})
+	assert.Error(t, err)
+
+	// A missing HS256 secret fails unless an ephemeral secret is explicitly allowed
+	_, err = NewKeyManager(config.KeysConfig{Algorithm: "HS256", KeyID: "default"})
+	assert.Error(t, err)
+
+	manager, err := NewKeyManager(config.KeysConfig{Algorithm: "HS256", KeyID: "default", AllowEphemeralSecret: true})
+	assert.NoError(t, err)
+	tokenString, err := manager.Sign(testClaims())
+	assert.NoError(t, err)
+	_, err = manager.Parse(tokenString)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,75 @@
+package security
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateTOTPCode_RFC6238Vectors(t *testing.T) {
+	// Segredo ASCII "12345678901234567890" dos vetores de teste da RFC 6238 (SHA1, últimos 6 dígitos)
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := GenerateTOTPCode(secret, time.Unix(unix, 0))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, code, "time %d", unix)
+	}
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+
+	now := time.Now()
+	code, _ := GenerateTOTPCode(secret, now)
+	previous, _ := GenerateTOTPCode(secret, now.Add(-30*time.Second))
+	old, _ := GenerateTOTPCode(secret, now.Add(-2*time.Minute))
+
+	assert.True(t, ValidateTOTPCode(secret, code, now))
+	assert.True(t, ValidateTOTPCode(secret, previous, now))
+	if old != code && old != previous {
+		assert.False(t, ValidateTOTPCode(secret, old, now))
+	}
+	assert.False(t, ValidateTOTPCode(secret, "12345", now))
+	assert.False(t, ValidateTOTPCode("not base32!", code, now))
+}
+
+func TestMatchTOTPCode(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	// O código do instante 59 pertence ao passo 1, mesmo quando validado no passo seguinte
+	step, ok := MatchTOTPCode(secret, "287082", time.Unix(89, 0))
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), step)
+
+	_, ok = MatchTOTPCode(secret, "287082", time.Unix(150, 0))
+	assert.False(t, ok)
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("Users API", "john@example.com", "JBSWY3DPEHPK3PXP")
+
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Users%20API:john@example.com?"))
+	assert.Contains(t, uri, "secret=JBSWY3DPEHPK3PXP")
+	assert.Contains(t, uri, "issuer=Users+API")
+}
+
+func TestGenerateRecoveryCode(t *testing.T) {
+	code, err := GenerateRecoveryCode()
+	assert.NoError(t, err)
+	assert.Len(t, code, 11)
+	assert.Equal(t, byte('-'), code[5])
+	assert.Equal(t, code, NormalizeRecoveryCode(" "+strings.ToUpper(code)+" "))
+}
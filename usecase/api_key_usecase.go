@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+const (
+	// Prefixo que identifica as chaves de API, facilitando sua detecção em vazamentos
+	apiKeyPrefix = "vmy_"
+	// Quantidade de caracteres da chave exibida na listagem
+	apiKeyDisplayLength = 12
+	// Intervalo mínimo entre as atualizações do último uso, evitando uma escrita a cada requisição
+	apiKeyTouchInterval = time.Minute
+)
+
+func (u *UserUseCaseImpl) CreateAPIKey(userID uint64, name string, expiresAt *time.Time) (*CreatedAPIKey, error) {
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidAPIKeyExpiry
+	}
+
+	if _, err := u.userRepo.FindByID(userID); err != nil {
+		return nil, err
+	}
+
+	random, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	key := apiKeyPrefix + random
+
+	apiKey := &entity.APIKey{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    key[:apiKeyDisplayLength],
+		KeyHash:   utils.HashToken(key),
+		ExpiresAt: expiresAt,
+	}
+	if err := u.apiKeyRepo.Create(apiKey); err != nil {
+		return nil, err
+	}
+
+	return &CreatedAPIKey{APIKey: apiKey, Key: key}, nil
+}
+
+func (u *UserUseCaseImpl) ListAPIKeys(userID uint64) ([]*entity.APIKey, error) {
+	return u.apiKeyRepo.ListByUser(userID)
+}
+
+func (u *UserUseCaseImpl) RevokeAPIKey(userID, keyID uint64) error {
+	revoked, err := u.apiKeyRepo.Revoke(keyID, userID)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// Valida uma chave de API, retornando a identidade do usuário dono da chave
+func (u *UserUseCaseImpl) ValidateAPIKey(key string) (*Principal, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	apiKey, err := u.apiKeyRepo.FindByHash(utils.HashToken(key))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if !apiKey.IsActive(now) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	// Chaves de usuários removidos deixam de ser aceitas
+	user, err := u.userRepo.FindByID(apiKey.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	if err := checkUserStatus(user); err != nil {
+		return nil, err
+	}
+
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) >= apiKeyTouchInterval {
+		if err := u.apiKeyRepo.TouchLastUsed(apiKey.ID, now); err != nil {
+			log.Printf("Failed to update API key last use: %v", err)
+		}
+	}
+
+	// Chaves de API não têm validade curta: as permissões são sempre resolvidas a partir dos papéis atuais
+	permissions, err := u.roleRepo.PermissionsForUser(user.ID, user.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &Principal{
+		UserID:           user.ID,
+		Permissions:      permissions,
+		Profile:          user.Profile,
+		APIKeyID:         apiKey.ID,
+		TwoFactorPending: u.twoFactorSetupRequired(user),
+	}
+	if apiKey.ExpiresAt != nil {
+		principal.ExpiresAt = *apiKey.ExpiresAt
+	}
+	return principal, nil
+}
@@ -1,52 +1,420 @@
 package usecase
 
 import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func (u *UserUseCaseImpl) AuthenticateUser(email, password string) (string, error) {
+func (u *UserUseCaseImpl) AuthenticateUser(email, password, clientIP string) (*AuthTokens, error) {
+	// Contas e IPs com muitas falhas recentes precisam aguardar antes de tentar novamente
+	attempt, err := u.beginLoginAttempt(loginAccountKey(email), loginIPKey(clientIP))
+	if err != nil {
+		return nil, err
+	}
+
 	user, err := u.userRepo.FindByEmail(email)
 	if err != nil {
-		return "", err
+		if !errors.Is(err, repository.ErrNotFound) {
+			u.releaseLoginAttempt(attempt)
+			return nil, err
+		}
+
+		// E-mails inexistentes passam pela mesma comparação bcrypt e contam como falha,
+		// para não serem diferenciados das contas existentes pelo tempo de resposta ou pelo bloqueio
+		checkPassword(password, dummyPasswordHash())
+		if err := u.failLoginAttempt(attempt); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
 
 	// Verificar se a senha está correta
 	if !checkPassword(password, user.Password) {
-		return "", nil
+		if err := u.failLoginAttempt(attempt); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
+	}
+
+	// Com dois fatores ativos a senha não zera as falhas da conta: elas só são zeradas quando o código também é aceito,
+	// para que o login repetido com a senha não libere novas tentativas do código
+	if user.TwoFactorEnabled {
+		u.releaseLoginAttempt(attempt)
+	} else if err := u.succeedLoginAttempt(attempt); err != nil {
+		return nil, err
+	}
+
+	// A situação da conta só é revelada a quem conhece a senha
+	if err := checkUserStatus(user); err != nil {
+		return nil, err
+	}
+
+	// Contas com e-mail não confirmado podem ser bloqueadas por configuração
+	if u.cfg.EmailVerification.Required && !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+
+	// Com dois fatores ativos, a senha só libera um desafio que deve ser trocado pelo código TOTP
+	if user.TwoFactorEnabled {
+		return u.issueTwoFactorChallenge(user)
+	}
+
+	// Retorne os tokens de autenticação, iniciando uma nova família de refresh tokens
+	return u.issueTokens(user, "")
+}
+
+func (u *UserUseCaseImpl) RefreshTokens(refreshToken string) (*AuthTokens, error) {
+	stored, err := u.refreshTokenRepo.FindByHash(utils.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	// Um token já rotacionado sendo reutilizado indica vazamento: revoga toda a família
+	if stored.RevokedAt != nil {
+		return nil, u.revokeReusedFamily(stored.FamilyID)
+	}
+
+	if stored.IsExpired(time.Now()) {
+		return nil, ErrInvalidRefreshToken
 	}
 
-	token, err := generateAuthToken(user.ID, user.Profile)
+	revoked, err := u.refreshTokenRepo.Revoke(stored.ID)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	// Outra requisição rotacionou o mesmo token ao mesmo tempo
+	if !revoked {
+		return nil, u.revokeReusedFamily(stored.FamilyID)
+	}
+
+	user, err := u.userRepo.FindByID(stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, err
+	}
+
+	return u.issueTokens(user, stored.FamilyID)
+}
+
+func (u *UserUseCaseImpl) ValidateAccessToken(tokenString string) (*Principal, error) {
+	claims, err := u.keyManager.Parse(tokenString)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// Tokens de uso específico (ex.: verificação de e-mail) não são tokens de acesso
+	if _, ok := claims["purpose"]; ok {
+		return nil, ErrInvalidToken
+	}
+
+	principal := &Principal{
+		ExpiresAt: claimTime(claims, "exp"),
+	}
+	principal.TokenID, _ = claims["jti"].(string)
+
+	if clientID, ok := claims["client_id"].(string); ok {
+		// Tokens de clientes OAuth carregam escopos no lugar do usuário e do perfil
+		scope, _ := claims["scope"].(string)
+		principal.ClientID = clientID
+		principal.Scopes = strings.Fields(scope)
+	} else {
+		// Obter o valor do claim "id"
+		userID, ok := claims["id"].(float64)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		profile, ok := claims["profile"].(string)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+
+		principal.UserID = uint64(userID)
+		principal.Profile = profile
+		principal.TwoFactorPending, _ = claims["2fa_pending"].(bool)
+
+		// Tokens de personificação identificam o administrador que age como o usuário
+		if act, ok := claims["act"].(map[string]interface{}); ok {
+			actorID, ok := act["id"].(float64)
+			if !ok {
+				return nil, ErrInvalidToken
+			}
+			principal.ActorID = uint64(actorID)
+		}
+
+		// Tokens emitidos antes da introdução das permissões são resolvidos a partir dos papéis
+		if perms, ok := claims["perms"].([]interface{}); ok {
+			principal.Permissions = make([]string, 0, len(perms))
+			for _, perm := range perms {
+				if name, ok := perm.(string); ok {
+					principal.Permissions = append(principal.Permissions, name)
+				}
+			}
+		} else {
+			principal.Permissions, err = u.roleRepo.PermissionsForUser(principal.UserID, principal.Profile)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Rejeita tokens revogados por logout ou de usuários removidos
+	revoked, err := u.revocationRepo.IsRevoked(principal.TokenID, principal.UserID, claimTime(claims, "iat"))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	// Tokens de clientes OAuth revogados deixam de ser aceitos antes de expirar
+	if principal.ClientID != "" {
+		if _, err := u.oauthClientRepo.FindByClientID(principal.ClientID); err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrTokenRevoked
+			}
+			return nil, err
+		}
+	}
+
+	// Usuários suspensos ou desativados deixam de ser aceitos mesmo com tokens ainda válidos
+	if principal.ClientID == "" {
+		user, err := u.userRepo.FindByID(principal.UserID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrTokenRevoked
+			}
+			return nil, err
+		}
+		if err := checkUserStatus(user); err != nil {
+			return nil, err
+		}
+	}
+
+	// Tokens de personificação também dependem do administrador: logout global, desativação ou remoção os invalidam
+	if principal.IsImpersonated() {
+		revoked, err := u.revocationRepo.IsRevoked("", principal.ActorID, claimTime(claims, "iat"))
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+
+		actor, err := u.userRepo.FindByID(principal.ActorID)
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				return nil, ErrTokenRevoked
+			}
+			return nil, err
+		}
+		if err := checkUserStatus(actor); err != nil {
+			return nil, ErrTokenRevoked
+		}
 	}
 
-	// Retorne o token de autenticação
-	return token, nil
+	return principal, nil
+}
+
+func (u *UserUseCaseImpl) Logout(principal *Principal, refreshToken string, allSessions bool) error {
+	if principal == nil {
+		return ErrInvalidToken
+	}
+
+	// Durante a personificação, somente o próprio token é encerrado; as sessões do usuário permanecem
+	if principal.IsImpersonated() {
+		return u.revocationRepo.RevokeToken(principal.TokenID, principal.UserID, principal.ExpiresAt)
+	}
+
+	if allSessions {
+		return u.revokeAllUserTokens(principal.UserID)
+	}
+
+	if principal.TokenID != "" {
+		if err := u.revocationRepo.RevokeToken(principal.TokenID, principal.UserID, principal.ExpiresAt); err != nil {
+			return err
+		}
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+
+	// Encerra também a sessão do refresh token informado, desde que pertença ao mesmo usuário
+	stored, err := u.refreshTokenRepo.FindByHash(utils.HashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if stored.UserID != principal.UserID {
+		return nil
+	}
+	return u.refreshTokenRepo.RevokeFamily(stored.FamilyID)
+}
+
+// Revoga todos os tokens de acesso e refresh tokens emitidos até o momento para o usuário
+func (u *UserUseCaseImpl) revokeAllUserTokens(userID uint64) error {
+	if err := u.refreshTokenRepo.RevokeAllForUser(userID); err != nil {
+		return err
+	}
+	return u.revocationRepo.RevokeUserTokens(userID, revocationCutoff())
+}
+
+// Instante de corte para revogar os tokens de acesso emitidos até agora. O "iat" tem precisão de microssegundos:
+// o corte inclui o microssegundo atual e a espera, de no máximo 1µs, garante que os tokens emitidos em seguida fiquem depois dele
+func revocationCutoff() time.Time {
+	cutoff := time.Now().Truncate(time.Microsecond).Add(time.Microsecond)
+	time.Sleep(time.Until(cutoff))
+	return cutoff
+}
+
+func (u *UserUseCaseImpl) revokeReusedFamily(familyID string) error {
+	if err := u.refreshTokenRepo.RevokeFamily(familyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// Emite um novo par de tokens. Se familyID for vazio, uma nova família de refresh tokens é criada
+func (u *UserUseCaseImpl) issueTokens(user *entity.User, familyID string) (*AuthTokens, error) {
+	if err := checkUserStatus(user); err != nil {
+		return nil, err
+	}
+
+	accessTTL := u.cfg.Auth.AccessTokenTTL
+	setupRequired := u.twoFactorSetupRequired(user)
+
+	// As permissões efetivas são embutidas no token para evitar consultas a cada requisição
+	permissions, err := u.roleRepo.PermissionsForUser(user.ID, user.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	extraClaims := jwt.MapClaims{"perms": permissions}
+	if setupRequired {
+		extraClaims["2fa_pending"] = true
+	}
+	accessToken, err := u.generateAuthToken(user.ID, user.Profile, accessTTL, extraClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	if familyID == "" {
+		familyID, err = utils.GenerateRandomToken(16)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	refreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	// Somente o hash do refresh token é persistido
+	err = u.refreshTokenRepo.Create(&entity.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: utils.HashToken(refreshToken),
+		ExpiresAt: time.Now().Add(u.cfg.Auth.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		AccessToken:            accessToken,
+		RefreshToken:           refreshToken,
+		TokenType:              "Bearer",
+		ExpiresIn:              int64(accessTTL.Seconds()),
+		TwoFactorSetupRequired: setupRequired,
+	}, nil
 }
 
 // Função de geração de token de autenticação
-func generateAuthToken(userID uint64, profile string) (string, error) {
+func (u *UserUseCaseImpl) generateAuthToken(userID uint64, profile string, ttl time.Duration, extraClaims jwt.MapClaims) (string, error) {
+	// Identificador único do token, usado para revogá-lo individualmente
+	tokenID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return "", err
+	}
+
 	// Defina as informações do token, como claims e tempo de expiração
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"id":      userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(), // Token expira em 24 horas
+		"jti":     tokenID,
+		"iat":     numericDateMicro(now),
+		"exp":     now.Add(ttl).Unix(),
 		"profile": profile,
 	}
+	for key, value := range extraClaims {
+		claims[key] = value
+	}
 
-	// Defina a assinatura do token (pode ser uma chave secreta)
-	signingKey := []byte("VMYCRUDTEST")
+	// Assine o token com a chave ativa do gerenciador de chaves
+	return u.keyManager.Sign(claims)
+}
 
-	// Crie o token JWT com as informações e a assinatura
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signedToken, err := token.SignedString(signingKey)
+// Gera um token assinado de uso específico (ex.: verificação de e-mail), que não é aceito como token de acesso
+func (u *UserUseCaseImpl) generatePurposeToken(purpose string, userID uint64, ttl time.Duration, extraClaims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"id":      userID,
+		"purpose": purpose,
+		"iat":     numericDateMicro(now),
+		"exp":     now.Add(ttl).Unix(),
+	}
+	for key, value := range extraClaims {
+		claims[key] = value
+	}
+	return u.keyManager.Sign(claims)
+}
+
+// Valida um token de uso específico, retornando o ID do usuário e os claims
+func (u *UserUseCaseImpl) parsePurposeToken(tokenString, purpose string) (uint64, jwt.MapClaims, error) {
+	claims, err := u.keyManager.Parse(tokenString)
 	if err != nil {
-		return "", err
+		return 0, nil, err
 	}
+	if claims["purpose"] != purpose {
+		return 0, nil, ErrInvalidToken
+	}
+	userID, ok := claims["id"].(float64)
+	if !ok {
+		return 0, nil, ErrInvalidToken
+	}
+	return uint64(userID), claims, nil
+}
 
-	return signedToken, nil
+// NumericDate com a fração de segundo em microssegundos, para que a revogação distinga tokens emitidos no mesmo segundo
+func numericDateMicro(t time.Time) float64 {
+	return float64(t.UnixMicro()) / 1e6
+}
+
+// Converte um claim numérico (NumericDate) em time.Time, preservando os microssegundos
+func claimTime(claims jwt.MapClaims, key string) time.Time {
+	value, ok := claims[key].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.UnixMicro(int64(math.Round(value * 1e6)))
 }
 
 func HashPassword(password string) (string, error) {
@@ -57,6 +425,23 @@ func HashPassword(password string) (string, error) {
 	return string(hashedPassword), nil
 }
 
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// Hash bcrypt de um valor aleatório, com o mesmo custo das senhas reais, usado na comparação de e-mails inexistentes
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		random, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			random = time.Now().String()
+		}
+		dummyHash, _ = HashPassword(random)
+	})
+	return dummyHash
+}
+
 func checkPassword(password, hashedPassword string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
 	return err == nil
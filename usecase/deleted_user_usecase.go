@@ -0,0 +1,63 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+)
+
+// Quantidade de usuários removidos por transação no expurgo
+const purgeBatchSize = 500
+
+// Desfaz a exclusão do usuário. As sessões encerradas na exclusão continuam revogadas
+func (uc *UserUseCaseImpl) RestoreUser(id uint64) (*entity.User, error) {
+	if err := uc.userRepo.Restore(id); err != nil {
+		return nil, err
+	}
+	return uc.userRepo.FindByID(id)
+}
+
+func (uc *UserUseCaseImpl) GetDeletedUsers(page, pageSize int) ([]*entity.User, error) {
+	if page <= 0 || pageSize <= 0 {
+		return nil, errors.New("page and pageSize must be greater than 0")
+	}
+	return uc.userRepo.FindDeleted(page, uc.limitPageSize(pageSize))
+}
+
+// Remove definitivamente os usuários excluídos há mais tempo que o período de retenção
+func (uc *UserUseCaseImpl) PurgeDeletedUsers() (int64, error) {
+	before := time.Now().Add(-uc.cfg.Retention.DeletedUsers)
+
+	var total int64
+	for {
+		purged, err := uc.userRepo.PurgeDeleted(before, purgeBatchSize)
+		total += purged
+		if err != nil || purged < purgeBatchSize {
+			return total, err
+		}
+	}
+}
+
+// Executa o expurgo na inicialização e a cada intervalo, até o contexto ser cancelado
+func RunDeletedUserPurger(ctx context.Context, userUseCase UserUseCase, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := userUseCase.PurgeDeletedUsers()
+		if err != nil {
+			log.Printf("Falha ao expurgar usuários excluídos: %v", err)
+		} else if purged > 0 {
+			log.Printf("%d usuários excluídos foram expurgados", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
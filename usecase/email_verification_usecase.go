@@ -0,0 +1,167 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/notifier"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+const (
+	emailVerificationPurpose = "email_verification"
+	emailChangePurpose       = "email_change"
+)
+
+func (u *UserUseCaseImpl) VerifyEmail(token string) error {
+	userID, claims, err := u.parsePurposeToken(token, emailVerificationPurpose)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+
+	// O link vale somente para o e-mail para o qual foi enviado
+	if claims["email"] != user.Email {
+		return ErrInvalidVerificationToken
+	}
+
+	if user.EmailVerified {
+		return nil
+	}
+
+	now := time.Now()
+	user.EmailVerified = true
+	user.VerifiedAt = &now
+	return u.userRepo.Update(user)
+}
+
+// Reenvia o link de verificação. Assim como na redefinição de senha, e-mails não cadastrados não geram erro
+func (u *UserUseCaseImpl) ResendVerificationEmail(email string) error {
+	user, err := u.userRepo.FindByEmail(email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if user.EmailVerified {
+		return nil
+	}
+
+	return u.sendVerificationEmail(user)
+}
+
+func (u *UserUseCaseImpl) sendVerificationEmail(user *entity.User) error {
+	ttl := u.cfg.EmailVerification.TokenTTL
+	token, err := u.generatePurposeToken(emailVerificationPurpose, user.ID, ttl, jwt.MapClaims{
+		"email": user.Email,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/v1/verify-email?token=%s", u.cfg.BaseURL, url.QueryEscape(token))
+	return u.notifier.Notify(notifier.Message{
+		To:      user.Email,
+		Subject: "Confirme seu e-mail",
+		Body: fmt.Sprintf("Olá %s,\n\nPara confirmar seu e-mail acesse o link abaixo (válido por %s):\n%s",
+			user.Name, ttl, link),
+	})
+}
+
+// Confere se o novo e-mail está livre e decide se ele substitui o atual imediatamente ou fica pendente de confirmação
+func (u *UserUseCaseImpl) prepareEmailChange(user *entity.User, currentEmail string) error {
+	exists, err := u.userRepo.EmailInUse(user.Email, user.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrEmailTaken
+	}
+
+	if u.cfg.EmailVerification.ConfirmEmailChange {
+		user.PendingEmail, user.Email = user.Email, currentEmail
+		return nil
+	}
+
+	// O novo endereço substitui o atual, mas precisa ser verificado novamente
+	user.PendingEmail = ""
+	user.EmailVerified = false
+	user.VerifiedAt = nil
+	return nil
+}
+
+// Envia ao novo endereço o link de confirmação da troca ou, se a troca já foi feita, o de verificação
+func (u *UserUseCaseImpl) sendEmailChangeMessage(user *entity.User) error {
+	if user.PendingEmail == "" {
+		return u.sendVerificationEmail(user)
+	}
+
+	ttl := u.cfg.EmailVerification.TokenTTL
+	token, err := u.generatePurposeToken(emailChangePurpose, user.ID, ttl, jwt.MapClaims{
+		"email": user.PendingEmail,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/v1/verify-email/change?token=%s", u.cfg.BaseURL, url.QueryEscape(token))
+	return u.notifier.Notify(notifier.Message{
+		To:      user.PendingEmail,
+		Subject: "Confirme seu novo e-mail",
+		Body: fmt.Sprintf("Olá %s,\n\nPara trocar o e-mail da sua conta para este endereço acesse o link abaixo (válido por %s):\n%s\n\nAté a confirmação, o e-mail atual continua valendo.",
+			user.Name, ttl, link),
+	})
+}
+
+// Substitui o e-mail do usuário pelo pendente. O link vale somente para o último e-mail solicitado
+func (u *UserUseCaseImpl) ConfirmEmailChange(token string) error {
+	userID, claims, err := u.parsePurposeToken(token, emailChangePurpose)
+	if err != nil {
+		return ErrInvalidVerificationToken
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidVerificationToken
+		}
+		return err
+	}
+	if user.PendingEmail == "" || claims["email"] != user.PendingEmail {
+		return ErrInvalidVerificationToken
+	}
+
+	// O endereço pode ter sido cadastrado por outro usuário depois da solicitação
+	exists, err := u.userRepo.EmailInUse(user.PendingEmail, user.ID)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrEmailTaken
+	}
+
+	now := time.Now()
+	user.Email, user.PendingEmail = user.PendingEmail, ""
+	user.EmailVerified = true
+	user.VerifiedAt = &now
+	if err := u.userRepo.Update(user); err != nil {
+		if errors.Is(err, repository.ErrDuplicateKey) {
+			return ErrEmailTaken
+		}
+		return err
+	}
+	return nil
+}
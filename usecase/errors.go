@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidCredentials       = errors.New("invalid email or password")
+	ErrUserDisabled             = errors.New("user account is disabled")
+	ErrInvalidRefreshToken      = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused       = errors.New("refresh token reuse detected")
+	ErrInvalidToken             = errors.New("invalid token")
+	ErrTokenRevoked             = errors.New("token has been revoked")
+	ErrInvalidResetToken        = errors.New("invalid or expired password reset token")
+	ErrInvalidCurrentPassword   = errors.New("current password is incorrect")
+	ErrEmailNotVerified         = errors.New("email address has not been verified")
+	ErrInvalidVerificationToken = errors.New("invalid or expired email verification token")
+	ErrInvalidChallengeToken    = errors.New("invalid or expired two-factor challenge")
+	ErrInvalidTwoFactorCode     = errors.New("invalid two-factor authentication code")
+	ErrTwoFactorAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorSetupNotStarted = errors.New("two-factor setup has not been started")
+	ErrTwoFactorRequired        = errors.New("two-factor authentication is required for this profile")
+	ErrAccountLocked            = errors.New("account temporarily locked due to too many failed login attempts")
+	ErrTooManyLoginAttempts     = errors.New("too many login attempts, try again later")
+	ErrInvalidAPIKey            = errors.New("invalid or expired API key")
+	ErrInvalidAPIKeyExpiry      = errors.New("expiresAt must be in the future")
+	ErrInvalidClient            = errors.New("invalid client credentials")
+	ErrInvalidScope             = errors.New("requested scope is invalid or not allowed")
+	ErrRoleNameTaken            = errors.New("role name already in use")
+	ErrBuiltinRole              = errors.New("built-in role cannot be changed")
+	ErrUnknownPermission        = errors.New("unknown permission")
+	ErrLastAdmin                = errors.New("the last admin cannot be removed or demoted")
+	ErrImpersonationNotAllowed  = errors.New("impersonation of this user is not allowed")
+	ErrImpersonationReason      = errors.New("a reason is required to impersonate a user")
+	ErrUserWriteNotAllowed      = errors.New("changes to a user with permissions you lack are not allowed")
+	ErrUserSuspended            = errors.New("user account is suspended")
+	ErrInvalidStatusTransition  = errors.New("status transition is not allowed")
+	ErrInvalidSuspensionEnd     = errors.New("suspension end must be in the future")
+	ErrInvalidFilter            = errors.New("filter range start must be before its end")
+	ErrInvalidCursor            = errors.New("invalid pagination cursor")
+	ErrEmptyImport              = errors.New("import file has no rows")
+	ErrImportTooLarge           = errors.New("import file exceeds the maximum number of rows")
+	ErrInvalidUserData          = errors.New("invalid user data")
+	ErrEmailTaken               = errors.New("email already in use")
+)
+
+// Erro que indica quando a operação pode ser tentada novamente
+type RetryAfterError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,21 @@
+package usecase
+
+import (
+	"fmt"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+// Entrega ao process, em lotes ordenados pelo ID, todos os usuários que atendem ao filtro.
+// Os lotes são lidos do banco sob demanda, então a memória usada não depende da quantidade de usuários
+func (uc *UserUseCaseImpl) ExportUsers(filter *repository.UserFilter, process func(users []*entity.User) error) error {
+	if err := validateUserFilter(filter); err != nil {
+		return err
+	}
+	if filter != nil && !sortedByIDOnly(filter.Sort) {
+		return fmt.Errorf("%w: export is always ordered by id", repository.ErrInvalidSort)
+	}
+
+	return uc.userRepo.FindInBatches(filter, uc.cfg.Export.BatchSize, process)
+}
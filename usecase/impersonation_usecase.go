@@ -0,0 +1,90 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+)
+
+// Emite um token de curta duração para o administrador agir como o usuário, registrando a sessão.
+// Não há refresh token: ao expirar, uma nova personificação precisa ser solicitada
+func (u *UserUseCaseImpl) ImpersonateUser(actor *Principal, userID uint64, reason, clientIP string) (*AuthTokens, error) {
+	if actor == nil || actor.ClientID != "" {
+		return nil, ErrInvalidToken
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, ErrImpersonationReason
+	}
+
+	// Não é possível personificar a partir de outra personificação nem a si mesmo
+	if actor.IsImpersonated() || actor.UserID == userID {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Administradores não podem ser personificados, nem usuários com alguma permissão que o suporte não tenha,
+	// recebida pelo perfil ou por papéis atribuídos, para que a personificação não amplie os acessos de quem a solicita
+	if user.Profile == entity.RoleAdmin {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	permissions, covered, err := u.permissionsCoveredBy(actor, user)
+	if err != nil {
+		return nil, err
+	}
+	if !covered {
+		return nil, ErrImpersonationNotAllowed
+	}
+
+	// O identificador do token é registrado na sessão, permitindo relacioná-la às requisições feitas
+	tokenID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := u.cfg.Auth.ImpersonationTTL
+	extraClaims := jwt.MapClaims{
+		"jti":   tokenID,
+		"perms": permissions,
+		"act":   map[string]interface{}{"id": actor.UserID},
+	}
+	accessToken, err := u.generateAuthToken(user.ID, user.Profile, ttl, extraClaims)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.impersonationRepo.Create(&entity.ImpersonationSession{
+		ActorID:   actor.UserID,
+		UserID:    user.ID,
+		TokenID:   tokenID,
+		Reason:    reason,
+		ClientIP:  clientIP,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+	}, nil
+}
+
+func (u *UserUseCaseImpl) ListImpersonationSessions(page, pageSize int) ([]*entity.ImpersonationSession, error) {
+	if page <= 0 || pageSize <= 0 {
+		return nil, errors.New("page and pageSize must be greater than 0")
+	}
+	return u.impersonationRepo.FindAll(page, u.limitPageSize(pageSize))
+}
@@ -0,0 +1,247 @@
+package usecase
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+)
+
+// Situação de cada linha no relatório da importação
+const (
+	ImportRowCreated = "created"
+	ImportRowValid   = "valid"
+	ImportRowSkipped = "skipped"
+	ImportRowFailed  = "failed"
+)
+
+// Linha lida do arquivo de importação. Err é preenchido quando a linha não pôde ser interpretada
+type ImportUserData struct {
+	Line int
+	CreateUserData
+	Profile string
+	Err     error
+}
+
+type ImportReport struct {
+	DryRun  bool              `json:"dryRun"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Valid   int               `json:"valid,omitempty"`
+	Skipped int               `json:"skipped"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+type ImportRowResult struct {
+	Line   int    `json:"line"`
+	Email  string `json:"email,omitempty"`
+	Status string `json:"status"`
+	ID     uint64 `json:"id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Cria os usuários do arquivo de importação. As linhas inválidas são reportadas como falhas e os e-mails já cadastrados
+// (ou repetidos no arquivo) são ignorados. No modo dryRun nada é gravado e as linhas válidas são reportadas como "valid"
+func (uc *UserUseCaseImpl) ImportUsers(rows []ImportUserData, dryRun bool) (*ImportReport, error) {
+	if len(rows) == 0 {
+		return nil, ErrEmptyImport
+	}
+	if len(rows) > uc.cfg.Import.MaxRows {
+		return nil, ErrImportTooLarge
+	}
+
+	report := &ImportReport{
+		DryRun: dryRun,
+		Total:  len(rows),
+		Rows:   make([]ImportRowResult, len(rows)),
+	}
+
+	// O e-mail é normalizado uma única vez: a deduplicação, a consulta dos já cadastrados e a gravação usam o mesmo valor
+	emails := make([]string, 0, len(rows))
+	for _, row := range rows {
+		emails = append(emails, normalizeImportEmail(row.Email))
+	}
+	existing, err := uc.userRepo.ExistingEmails(emails)
+	if err != nil {
+		return nil, err
+	}
+	inUse := make(map[string]bool, len(existing))
+	for email := range existing {
+		inUse[normalizeImportEmail(email)] = true
+	}
+	inFile := make(map[string]bool, len(rows))
+
+	// Índices das linhas aceitas, na ordem do arquivo
+	var accepted []int
+	users := make([]*entity.User, len(rows))
+	for i, row := range rows {
+		report.Rows[i] = ImportRowResult{Line: row.Line, Email: row.Email}
+
+		user, err := newImportedUser(row)
+		if err != nil {
+			report.Rows[i].Status, report.Rows[i].Reason = ImportRowFailed, err.Error()
+			continue
+		}
+
+		email := user.Email
+		if inUse[email] {
+			report.Rows[i].Status, report.Rows[i].Reason = ImportRowSkipped, "email already in use"
+			continue
+		}
+		if inFile[email] {
+			report.Rows[i].Status, report.Rows[i].Reason = ImportRowSkipped, "duplicate email in file"
+			continue
+		}
+		inFile[email] = true
+
+		users[i] = user
+		accepted = append(accepted, i)
+	}
+
+	if dryRun {
+		for _, i := range accepted {
+			report.Rows[i].Status = ImportRowValid
+		}
+		report.count()
+		return report, nil
+	}
+
+	uc.hashImportedPasswords(users, accepted, report)
+
+	// Linhas cuja senha foi processada, inseridas em lotes
+	var pending []int
+	for _, i := range accepted {
+		if report.Rows[i].Status == "" {
+			pending = append(pending, i)
+		}
+	}
+	for start := 0; start < len(pending); start += uc.cfg.Import.BatchSize {
+		end := start + uc.cfg.Import.BatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		uc.insertImportBatch(users, pending[start:end], report)
+	}
+
+	// Como no cadastro, cada usuário criado recebe o link de verificação, sem o qual não consegue fazer login
+	// quando a verificação é obrigatória. A importação não falha se o envio falhar: o usuário pode solicitar o reenvio
+	for _, i := range pending {
+		if report.Rows[i].Status != ImportRowCreated {
+			continue
+		}
+		if err := uc.sendVerificationEmail(users[i]); err != nil {
+			log.Printf("Falha ao enviar e-mail de verificação para o usuário importado %d: %v", users[i].ID, err)
+		}
+	}
+
+	report.count()
+	return report, nil
+}
+
+func newImportedUser(row ImportUserData) (*entity.User, error) {
+	if row.Err != nil {
+		return nil, row.Err
+	}
+
+	profile := row.Profile
+	if profile == "" {
+		profile = entity.RoleUser
+	}
+
+	user := &entity.User{
+		Name:      strings.TrimSpace(row.Name),
+		Email:     normalizeImportEmail(row.Email),
+		Password:  row.Password,
+		BirthDate: row.BirthDate,
+		Profile:   profile,
+		Address:   row.Address,
+		Status:    entity.UserStatusActive,
+	}
+	if err := user.Validate(); err != nil {
+		return nil, err
+	}
+
+	// A validação garante uma data de nascimento válida
+	user.Age, _ = utils.CalculateAge(user.BirthDate)
+	return user, nil
+}
+
+func normalizeImportEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Gera os hashes bcrypt em um conjunto limitado de workers, já que cada hash é custoso
+func (uc *UserUseCaseImpl) hashImportedPasswords(users []*entity.User, accepted []int, report *ImportReport) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	workers := uc.cfg.Import.Workers
+	if workers > len(accepted) {
+		workers = len(accepted)
+	}
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Cada worker escreve somente nas posições recebidas, sem disputa entre eles
+			for i := range jobs {
+				hashed, err := HashPassword(users[i].Password)
+				if err != nil {
+					report.Rows[i].Status, report.Rows[i].Reason = ImportRowFailed, err.Error()
+					continue
+				}
+				users[i].Password = hashed
+			}
+		}()
+	}
+
+	for _, i := range accepted {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Um lote com erro não é gravado: suas linhas são então inseridas uma a uma, para que somente as que falham
+// sejam reportadas como falhas
+func (uc *UserUseCaseImpl) insertImportBatch(users []*entity.User, batch []int, report *ImportReport) {
+	batchUsers := make([]*entity.User, 0, len(batch))
+	for _, i := range batch {
+		batchUsers = append(batchUsers, users[i])
+	}
+
+	if err := uc.userRepo.CreateBatch(batchUsers); err != nil {
+		for _, i := range batch {
+			// O lote desfeito pode ter preenchido o ID
+			users[i].ID = 0
+			if err := uc.userRepo.Create(users[i]); err != nil {
+				report.Rows[i].Status, report.Rows[i].Reason = ImportRowFailed, err.Error()
+				continue
+			}
+			report.Rows[i].Status, report.Rows[i].ID = ImportRowCreated, users[i].ID
+		}
+		return
+	}
+
+	for _, i := range batch {
+		report.Rows[i].Status, report.Rows[i].ID = ImportRowCreated, users[i].ID
+	}
+}
+
+func (r *ImportReport) count() {
+	for _, row := range r.Rows {
+		switch row.Status {
+		case ImportRowCreated:
+			r.Created++
+		case ImportRowValid:
+			r.Valid++
+		case ImportRowSkipped:
+			r.Skipped++
+		case ImportRowFailed:
+			r.Failed++
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package usecase
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+// Tentativa reservada na conta e, no login, também no IP de origem
+type loginAttempt struct {
+	accountKey string
+	ipKey      string
+}
+
+// Remove o bloqueio e as falhas de login acumuladas da conta
+func (u *UserUseCaseImpl) UnlockUser(id uint64) error {
+	user, err := u.userRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+	return u.loginAttemptRepo.Reset(loginAccountKey(user.Email))
+}
+
+// Remove as tentativas que não afetam mais nenhum login. A janela usada é a maior entre as da conta e a do IP,
+// para que nenhuma chave perca falhas que ainda contam
+func (u *UserUseCaseImpl) PurgeLoginAttempts() (int64, error) {
+	window := u.accountAttemptLimits().Window
+	if ipWindow := u.ipAttemptLimits().Window; ipWindow > window {
+		window = ipWindow
+	}
+	return u.loginAttemptRepo.PurgeIdle(time.Now(), window)
+}
+
+// Executa a limpeza das tentativas de login a cada intervalo, até o contexto ser cancelado
+func RunLoginAttemptPurger(ctx context.Context, userUseCase UserUseCase, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := userUseCase.PurgeLoginAttempts()
+		if err != nil {
+			log.Printf("Falha ao remover as tentativas de login expiradas: %v", err)
+		} else if purged > 0 {
+			log.Printf("%d registros de tentativas de login expiradas foram removidos", purged)
+		}
+	}
+}
+
+// Reserva a tentativa no IP e na conta, recusando-a se algum deles estiver bloqueado ou aguardando o intervalo
+// entre tentativas. A tentativa conta para os limites até ser concluída por failLoginAttempt ou succeedLoginAttempt
+func (u *UserUseCaseImpl) beginLoginAttempt(accountKey, ipKey string) (*loginAttempt, error) {
+	now := time.Now()
+
+	if ipKey != "" {
+		attempts, acquired, err := u.loginAttemptRepo.Acquire(ipKey, now, u.ipAttemptLimits())
+		if err != nil {
+			return nil, err
+		}
+		if !acquired {
+			return nil, &RetryAfterError{Err: ErrTooManyLoginAttempts, RetryAfter: u.loginRetryAfter(attempts, now)}
+		}
+	}
+
+	attempts, acquired, err := u.loginAttemptRepo.Acquire(accountKey, now, u.accountAttemptLimits())
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		// A tentativa recusada na conta não conta para o IP
+		if ipKey != "" {
+			if err := u.loginAttemptRepo.Release(ipKey); err != nil {
+				return nil, err
+			}
+		}
+		if attempts.LockedUntil.After(now) {
+			return nil, &RetryAfterError{Err: ErrAccountLocked, RetryAfter: attempts.LockedUntil.Sub(now)}
+		}
+		return nil, &RetryAfterError{Err: ErrTooManyLoginAttempts, RetryAfter: u.loginRetryAfter(attempts, now)}
+	}
+
+	return &loginAttempt{accountKey: accountKey, ipKey: ipKey}, nil
+}
+
+// Registra a falha na conta e no IP, bloqueando-os ao atingir os limites configurados
+func (u *UserUseCaseImpl) failLoginAttempt(attempt *loginAttempt) error {
+	now := time.Now()
+
+	if attempt.ipKey != "" {
+		if _, err := u.loginAttemptRepo.Fail(attempt.ipKey, now, u.ipAttemptLimits()); err != nil {
+			return err
+		}
+	}
+
+	attempts, err := u.loginAttemptRepo.Fail(attempt.accountKey, now, u.accountAttemptLimits())
+	if err != nil {
+		return err
+	}
+	if attempts.LockedUntil.After(now) {
+		return &RetryAfterError{Err: ErrAccountLocked, RetryAfter: attempts.LockedUntil.Sub(now)}
+	}
+	return nil
+}
+
+// O sucesso zera as falhas da conta; no IP, somente a tentativa é concluída
+func (u *UserUseCaseImpl) succeedLoginAttempt(attempt *loginAttempt) error {
+	if attempt.ipKey != "" {
+		if err := u.loginAttemptRepo.Release(attempt.ipKey); err != nil {
+			return err
+		}
+	}
+	return u.loginAttemptRepo.Reset(attempt.accountKey)
+}
+
+// Conclui a tentativa interrompida por um erro inesperado, sem registrar falha
+func (u *UserUseCaseImpl) releaseLoginAttempt(attempt *loginAttempt) {
+	if attempt.ipKey != "" {
+		_ = u.loginAttemptRepo.Release(attempt.ipKey)
+	}
+	_ = u.loginAttemptRepo.Release(attempt.accountKey)
+}
+
+func (u *UserUseCaseImpl) accountAttemptLimits() repository.AttemptLimits {
+	settings := u.cfg.LoginProtection
+	return repository.AttemptLimits{
+		MaxFailures: settings.MaxAttempts,
+		Window:      settings.AttemptWindow,
+		Lockout:     settings.LockoutDuration,
+		Backoff:     u.loginBackoff,
+	}
+}
+
+func (u *UserUseCaseImpl) ipAttemptLimits() repository.AttemptLimits {
+	settings := u.cfg.LoginProtection
+	return repository.AttemptLimits{
+		MaxFailures: settings.MaxAttemptsPerIP,
+		Window:      settings.AttemptWindow,
+		Lockout:     settings.LockoutDuration,
+	}
+}
+
+// Espera informada quando a tentativa é recusada sem que a chave esteja bloqueada
+func (u *UserUseCaseImpl) loginRetryAfter(attempts repository.LoginAttempts, now time.Time) time.Duration {
+	if attempts.LockedUntil.After(now) {
+		return attempts.LockedUntil.Sub(now)
+	}
+	if attempts.Failures > 0 {
+		if wait := attempts.LastFailure.Add(u.loginBackoff(attempts.Failures)).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	// O limite foi atingido por tentativas que ainda estão em andamento
+	return time.Second
+}
+
+// Intervalo mínimo após a n-ésima falha: a base dobra a cada falha, limitada à duração do bloqueio
+func (u *UserUseCaseImpl) loginBackoff(failures int) time.Duration {
+	settings := u.cfg.LoginProtection
+	delay := settings.BackoffBase
+	for i := 1; i < failures && delay < settings.LockoutDuration; i++ {
+		delay *= 2
+	}
+	if delay > settings.LockoutDuration {
+		return settings.LockoutDuration
+	}
+	return delay
+}
+
+func loginAccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginIPKey(clientIP string) string {
+	if clientIP == "" {
+		return ""
+	}
+	return "ip:" + clientIP
+}
@@ -0,0 +1,131 @@
+package usecase
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+// Escopos que podem ser concedidos aos clientes OAuth; têm os mesmos nomes das permissões exigidas pelas rotas
+var supportedScopes = map[string]bool{
+	entity.PermissionUsersRead:   true,
+	entity.PermissionUsersWrite:  true,
+	entity.PermissionUsersDelete: true,
+}
+
+func (u *OAuthClientUseCaseImpl) RegisterClient(name string, scopes []string) (*RegisteredOAuthClient, error) {
+	if len(scopes) == 0 {
+		return nil, ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !supportedScopes[scope] {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	clientID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &entity.OAuthClient{
+		ClientID:   clientID,
+		Name:       name,
+		SecretHash: utils.HashToken(secret),
+		Scope:      strings.Join(scopes, " "),
+	}
+	if err := u.clientRepo.Create(client); err != nil {
+		return nil, err
+	}
+
+	return &RegisteredOAuthClient{OAuthClient: client, ClientSecret: secret}, nil
+}
+
+func (u *OAuthClientUseCaseImpl) ListClients() ([]*entity.OAuthClient, error) {
+	return u.clientRepo.FindAll()
+}
+
+func (u *OAuthClientUseCaseImpl) RevokeClient(id uint64) error {
+	revoked, err := u.clientRepo.Revoke(id)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// Emite um token de acesso para o grant client_credentials. Sem escopos solicitados, todos os permitidos são concedidos
+func (u *OAuthClientUseCaseImpl) IssueClientToken(clientID, clientSecret string, scopes []string) (*ClientToken, error) {
+	client, err := u.clientRepo.FindByClientID(clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidClient
+		}
+		return nil, err
+	}
+
+	secretHash := utils.HashToken(clientSecret)
+	if subtle.ConstantTimeCompare([]byte(secretHash), []byte(client.SecretHash)) != 1 {
+		return nil, ErrInvalidClient
+	}
+
+	allowed := client.Scopes()
+	if len(scopes) == 0 {
+		scopes = allowed
+	}
+	for _, scope := range scopes {
+		if !containsScope(allowed, scope) {
+			return nil, ErrInvalidScope
+		}
+	}
+
+	tokenID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := u.cfg.Auth.ClientTokenTTL
+	now := time.Now()
+	scope := strings.Join(scopes, " ")
+
+	// Tokens de clientes carregam escopos no lugar do perfil e não possuem o claim "id" de usuário
+	accessToken, err := u.keyManager.Sign(jwt.MapClaims{
+		"sub":       "client:" + client.ClientID,
+		"client_id": client.ClientID,
+		"scope":     scope,
+		"jti":       tokenID,
+		"iat":       now.Unix(),
+		"exp":       now.Add(ttl).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ClientToken{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(ttl.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+func containsScope(scopes []string, scope string) bool {
+	for _, granted := range scopes {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package usecase
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+const (
+	cursorNext = "n"
+	cursorPrev = "p"
+)
+
+// Busca uma página a partir do cursor. A paginação por keyset depende da ordem por ID
+func (uc *UserUseCaseImpl) getUsersByCursor(filter *repository.UserFilter, pagination Pagination) (*UserPage, error) {
+	if filter != nil && !sortedByIDOnly(filter.Sort) {
+		return nil, fmt.Errorf("%w: cursor pagination is always ordered by id", repository.ErrInvalidSort)
+	}
+
+	var cursorID uint64
+	backward := false
+	if pagination.Cursor != "" {
+		var err error
+		cursorID, backward, err = decodeCursor(pagination.Cursor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Um item a mais indica se existe outra página na direção da busca
+	users, err := uc.userRepo.FindAfterID(filter, cursorID, backward, pagination.PageSize+1)
+	if err != nil {
+		return nil, err
+	}
+	hasMore := len(users) > pagination.PageSize
+	if hasMore {
+		users = users[:pagination.PageSize]
+	}
+
+	// A busca para trás retorna os usuários em ordem decrescente
+	if backward {
+		for i, j := 0, len(users)-1; i < j; i, j = i+1, j-1 {
+			users[i], users[j] = users[j], users[i]
+		}
+	}
+
+	page := &UserPage{Users: users, PageSize: pagination.PageSize}
+	if len(users) == 0 {
+		return page, nil
+	}
+
+	first, last := users[0].ID, users[len(users)-1].ID
+	if hasMore || backward {
+		page.NextCursor = encodeCursor(last, false)
+	}
+	if (hasMore && backward) || (!backward && cursorID > 0) {
+		page.PrevCursor = encodeCursor(first, true)
+	}
+	return page, nil
+}
+
+func sortedByIDOnly(sort []repository.UserSort) bool {
+	for _, s := range sort {
+		if s.Field != "id" || s.Desc {
+			return false
+		}
+	}
+	return true
+}
+
+// O cursor é opaco para o cliente: codifica a direção e o ID de referência
+func encodeCursor(id uint64, backward bool) string {
+	direction := cursorNext
+	if backward {
+		direction = cursorPrev
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(direction + ":" + strconv.FormatUint(id, 10)))
+}
+
+func decodeCursor(cursor string) (uint64, bool, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false, ErrInvalidCursor
+	}
+
+	direction, value, found := strings.Cut(string(decoded), ":")
+	if !found || (direction != cursorNext && direction != cursorPrev) {
+		return 0, false, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, ErrInvalidCursor
+	}
+	return id, direction == cursorPrev, nil
+}
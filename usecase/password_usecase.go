@@ -0,0 +1,161 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/notifier"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+// Solicita a redefinição de senha. Para não revelar quais e-mails estão cadastrados,
+// nenhum erro é retornado quando o usuário não existe
+func (u *UserUseCaseImpl) RequestPasswordReset(email string) error {
+	user, err := u.userRepo.FindByEmail(email)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	// Somente o último link enviado permanece válido
+	if err := u.passwordResetRepo.InvalidateForUser(user.ID); err != nil {
+		return err
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = u.passwordResetRepo.Create(&entity.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(token),
+		ExpiresAt: time.Now().Add(u.cfg.PasswordReset.TokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", u.cfg.BaseURL, url.QueryEscape(token))
+	err = u.notifier.Notify(notifier.Message{
+		To:      user.Email,
+		Subject: "Redefinição de senha",
+		Body: fmt.Sprintf("Olá %s,\n\nPara redefinir sua senha acesse o link abaixo (válido por %s):\n%s\n\nSe você não solicitou a redefinição, ignore esta mensagem.",
+			user.Name, u.cfg.PasswordReset.TokenTTL, link),
+	})
+	if err != nil {
+		// A falha na entrega não é informada ao cliente para não revelar que o e-mail existe
+		log.Printf("Falha ao enviar e-mail de redefinição de senha para o usuário %d: %v", user.ID, err)
+	}
+
+	return nil
+}
+
+func (u *UserUseCaseImpl) ResetPassword(token, newPassword string) error {
+	if err := entity.ValidatePassword(newPassword); err != nil {
+		return err
+	}
+
+	stored, err := u.passwordResetRepo.FindByHash(utils.HashToken(token))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	if !stored.IsValid(time.Now()) {
+		return ErrInvalidResetToken
+	}
+
+	// Garante que o token seja usado uma única vez, mesmo com requisições concorrentes
+	used, err := u.passwordResetRepo.MarkUsed(stored.ID)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidResetToken
+	}
+
+	user, err := u.userRepo.FindByID(stored.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrInvalidResetToken
+		}
+		return err
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	user.Password = hashedPassword
+	if err := u.userRepo.Update(user); err != nil {
+		return err
+	}
+
+	// As sessões e as chaves de API criadas com a senha antiga são encerradas
+	return u.revokePasswordCredentials(user.ID)
+}
+
+func (u *UserUseCaseImpl) ChangePassword(userID uint64, currentPassword, newPassword string) (*AuthTokens, error) {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Erros na senha atual contam como falhas de login da conta, para que uma sessão roubada não sirva para descobri-la
+	attempt, err := u.beginLoginAttempt(loginAccountKey(user.Email), "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Verificar se a senha atual está correta
+	if !checkPassword(currentPassword, user.Password) {
+		if err := u.failLoginAttempt(attempt); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCurrentPassword
+	}
+	if err := u.succeedLoginAttempt(attempt); err != nil {
+		return nil, err
+	}
+
+	if err := entity.ValidatePassword(newPassword); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Password = hashedPassword
+	if err := u.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	// Encerra as demais sessões e as chaves de API: refresh tokens e tokens de acesso emitidos antes da troca
+	if err := u.revokePasswordCredentials(user.ID); err != nil {
+		return nil, err
+	}
+
+	// A sessão atual continua com um novo par de tokens
+	return u.issueTokens(user, "")
+}
+
+// Uma chave de API criada por quem descobriu a senha não pode sobreviver à sua troca
+func (u *UserUseCaseImpl) revokePasswordCredentials(userID uint64) error {
+	if err := u.revokeAllUserTokens(userID); err != nil {
+		return err
+	}
+	return u.apiKeyRepo.RevokeAllForUser(userID)
+}
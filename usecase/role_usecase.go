@@ -0,0 +1,167 @@
+package usecase
+
+import (
+	"errors"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+)
+
+func (u *RoleUseCaseImpl) ListRoles() ([]*entity.Role, error) {
+	return u.roleRepo.FindAll()
+}
+
+func (u *RoleUseCaseImpl) ListPermissions() ([]entity.Permission, error) {
+	return u.roleRepo.FindPermissions()
+}
+
+func (u *RoleUseCaseImpl) CreateRole(name, description string, permissions []string) (*entity.Role, error) {
+	role := &entity.Role{
+		Name:        name,
+		Description: description,
+	}
+	if err := role.Validate(); err != nil {
+		return nil, err
+	}
+
+	_, err := u.roleRepo.FindByName(name)
+	if err == nil {
+		return nil, ErrRoleNameTaken
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	role.Permissions, err = u.resolvePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.roleRepo.Create(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+// Substitui a descrição e as permissões do papel. Os tokens de acesso de quem recebe o papel são revogados,
+// para que a renovação emita novos tokens com as permissões atualizadas
+func (u *RoleUseCaseImpl) UpdateRole(id uint64, description string, permissions []string) (*entity.Role, error) {
+	role, err := u.roleRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// O papel de administrador mantém sempre todas as permissões
+	if role.Name == entity.RoleAdmin {
+		return nil, ErrBuiltinRole
+	}
+
+	resolved, err := u.resolvePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	role.Description = description
+	if err := u.roleRepo.UpdatePermissions(role, resolved); err != nil {
+		return nil, err
+	}
+	role.Permissions = resolved
+
+	if err := u.revokeRoleHolderTokens(role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (u *RoleUseCaseImpl) DeleteRole(id uint64) error {
+	role, err := u.roleRepo.FindByID(id)
+	if err != nil {
+		return err
+	}
+
+	// Os papéis dos perfis não podem ser removidos
+	if role.IsBuiltin() {
+		return ErrBuiltinRole
+	}
+
+	// Os usuários são consultados antes da exclusão, que remove as atribuições
+	userIDs, err := u.roleRepo.FindUserIDs(role)
+	if err != nil {
+		return err
+	}
+	if err := u.roleRepo.Delete(id); err != nil {
+		return err
+	}
+	return u.revokeUsersAccessTokens(userIDs)
+}
+
+func (u *RoleUseCaseImpl) GetUserRoles(userID uint64) ([]*entity.Role, error) {
+	if _, err := u.userRepo.FindByID(userID); err != nil {
+		return nil, err
+	}
+	return u.roleRepo.FindByUser(userID)
+}
+
+func (u *RoleUseCaseImpl) AssignRole(userID, roleID uint64) error {
+	if _, err := u.userRepo.FindByID(userID); err != nil {
+		return err
+	}
+	if _, err := u.roleRepo.FindByID(roleID); err != nil {
+		return err
+	}
+
+	if err := u.roleRepo.AssignToUser(userID, roleID); err != nil {
+		return err
+	}
+	return u.revokeAccessTokens(userID)
+}
+
+func (u *RoleUseCaseImpl) RemoveRole(userID, roleID uint64) error {
+	removed, err := u.roleRepo.RemoveFromUser(userID, roleID)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return repository.ErrNotFound
+	}
+	return u.revokeAccessTokens(userID)
+}
+
+// As permissões são embutidas no token de acesso: encerra os tokens atuais para que a renovação
+// emita um novo com as permissões atualizadas
+func (u *RoleUseCaseImpl) revokeAccessTokens(userID uint64) error {
+	return u.revocationRepo.RevokeUserTokens(userID, revocationCutoff())
+}
+
+func (u *RoleUseCaseImpl) revokeRoleHolderTokens(role *entity.Role) error {
+	userIDs, err := u.roleRepo.FindUserIDs(role)
+	if err != nil {
+		return err
+	}
+	return u.revokeUsersAccessTokens(userIDs)
+}
+
+// Uma única gravação para todos os usuários, mesmo que o papel seja atribuído a muitos
+func (u *RoleUseCaseImpl) revokeUsersAccessTokens(userIDs []uint64) error {
+	return u.revocationRepo.RevokeAllForUsers(userIDs, revocationCutoff())
+}
+
+func (u *RoleUseCaseImpl) resolvePermissions(names []string) ([]entity.Permission, error) {
+	unique := make([]string, 0, len(names))
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+
+	permissions, err := u.roleRepo.FindPermissionsByName(unique)
+	if err != nil {
+		return nil, err
+	}
+	if len(permissions) != len(unique) {
+		return nil, ErrUnknownPermission
+	}
+	return permissions, nil
+}
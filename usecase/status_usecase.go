@@ -0,0 +1,80 @@
+package usecase
+
+import (
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+)
+
+// Transições permitidas a partir de cada situação vigente. Uma suspensão pode ser renovada com novo motivo ou prazo
+var statusTransitions = map[string][]string{
+	entity.UserStatusActive:    {entity.UserStatusSuspended, entity.UserStatusDisabled},
+	entity.UserStatusSuspended: {entity.UserStatusActive, entity.UserStatusSuspended, entity.UserStatusDisabled},
+	entity.UserStatusDisabled:  {entity.UserStatusActive},
+}
+
+// Altera a situação da conta. Ao suspender ou desativar, todas as sessões do usuário são encerradas
+func (uc *UserUseCaseImpl) ChangeUserStatus(id uint64, status, reason string, suspendedUntil *time.Time) (*entity.User, error) {
+	if err := entity.ValidateStatus(status); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if status != entity.UserStatusSuspended {
+		suspendedUntil = nil
+	} else if suspendedUntil != nil && !suspendedUntil.After(now) {
+		return nil, ErrInvalidSuspensionEnd
+	}
+	if status == entity.UserStatusActive {
+		reason = ""
+	}
+
+	user, err := uc.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !statusTransitionAllowed(user.EffectiveStatus(now), status) {
+		return nil, ErrInvalidStatusTransition
+	}
+
+	updated, err := uc.userRepo.UpdateStatus(id, status, reason, suspendedUntil)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrLastAdmin
+	}
+
+	user.Status = status
+	user.StatusReason = reason
+	user.SuspendedUntil = suspendedUntil
+
+	if status != entity.UserStatusActive {
+		if err := uc.revokeAllUserTokens(id); err != nil {
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func statusTransitionAllowed(from, to string) bool {
+	for _, allowed := range statusTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Impede o acesso de contas suspensas ou desativadas
+func checkUserStatus(user *entity.User) error {
+	switch user.EffectiveStatus(time.Now()) {
+	case entity.UserStatusSuspended:
+		return ErrUserSuspended
+	case entity.UserStatusDisabled:
+		return ErrUserDisabled
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,255 @@
+package usecase
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/security"
+)
+
+const (
+	twoFactorChallengePurpose = "two_factor_challenge"
+	recoveryCodeCount         = 10
+)
+
+// Troca o desafio emitido no login por um par de tokens, mediante um código TOTP ou de recuperação.
+// Cada desafio vale para um único login
+func (u *UserUseCaseImpl) CompleteTwoFactorLogin(challengeToken, code, clientIP string) (*AuthTokens, error) {
+	userID, claims, err := u.parsePurposeToken(challengeToken, twoFactorChallengePurpose)
+	if err != nil {
+		return nil, ErrInvalidChallengeToken
+	}
+	challengeID, _ := claims["jti"].(string)
+	if challengeID == "" {
+		return nil, ErrInvalidChallengeToken
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrInvalidChallengeToken
+		}
+		return nil, err
+	}
+
+	// A autenticação em dois fatores pode ter sido desativada depois da emissão do desafio
+	if !user.TwoFactorEnabled {
+		return nil, ErrInvalidChallengeToken
+	}
+
+	// Desafios já utilizados ou emitidos antes de uma revogação das sessões não são aceitos
+	revoked, err := u.revocationRepo.IsRevoked(challengeID, user.ID, claimTime(claims, "iat"))
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrInvalidChallengeToken
+	}
+
+	if err := u.verifyTwoFactorCode(user, code, clientIP); err != nil {
+		return nil, err
+	}
+
+	// A marcação é atômica: de requisições simultâneas com o mesmo desafio, somente uma recebe os tokens
+	consumed, err := u.revocationRepo.ConsumeToken(challengeID, user.ID, claimTime(claims, "exp"))
+	if err != nil {
+		return nil, err
+	}
+	if !consumed {
+		return nil, ErrInvalidChallengeToken
+	}
+
+	return u.issueTokens(user, "")
+}
+
+// Gera um novo segredo TOTP pendente de confirmação
+func (u *UserUseCaseImpl) SetupTwoFactor(userID uint64) (*TwoFactorSetup, error) {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := security.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	user.TwoFactorSecret = secret
+	if err := u.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorSetup{
+		Secret: secret,
+		URI:    security.TOTPURI(u.cfg.TwoFactor.Issuer, user.Email, secret),
+	}, nil
+}
+
+// Ativa a autenticação em dois fatores após o usuário provar que cadastrou o segredo, retornando os códigos de recuperação
+func (u *UserUseCaseImpl) ConfirmTwoFactor(userID uint64, code string) ([]string, error) {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TwoFactorEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TwoFactorSecret == "" {
+		return nil, ErrTwoFactorSetupNotStarted
+	}
+
+	if err := u.useTOTPCode(user, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := u.generateRecoveryCodes(user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user.TwoFactorEnabled = true
+	if err := u.userRepo.Update(user); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+func (u *UserUseCaseImpl) DisableTwoFactor(userID uint64, code, clientIP string) error {
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+
+	if !user.TwoFactorEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if u.twoFactorRequired(user) {
+		return ErrTwoFactorRequired
+	}
+
+	if err := u.verifyTwoFactorCode(user, code, clientIP); err != nil {
+		return err
+	}
+
+	if err := u.recoveryCodeRepo.DeleteForUser(user.ID); err != nil {
+		return err
+	}
+
+	user.TwoFactorEnabled = false
+	user.TwoFactorSecret = ""
+	return u.userRepo.Update(user)
+}
+
+func (u *UserUseCaseImpl) issueTwoFactorChallenge(user *entity.User) (*AuthTokens, error) {
+	// Identificador usado para marcar o desafio como utilizado
+	challengeID, err := utils.GenerateRandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	ttl := u.cfg.TwoFactor.ChallengeTTL
+	challenge, err := u.generatePurposeToken(twoFactorChallengePurpose, user.ID, ttl, jwt.MapClaims{"jti": challengeID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		ChallengeToken: challenge,
+		ExpiresIn:      int64(ttl.Seconds()),
+	}, nil
+}
+
+// Aceita um código TOTP de 6 dígitos ou um código de recuperação ainda não utilizado. Os códigos errados contam
+// para o bloqueio da conta e do IP de origem, assim como as senhas, para que não possam ser descobertos por tentativa e erro.
+// Somente o código aceito zera as falhas da conta
+func (u *UserUseCaseImpl) verifyTwoFactorCode(user *entity.User, code, clientIP string) error {
+	attempt, err := u.beginLoginAttempt(loginAccountKey(user.Email), loginIPKey(clientIP))
+	if err != nil {
+		return err
+	}
+
+	err = u.useTOTPCode(user, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		err = u.useRecoveryCode(user, code)
+	}
+	if err != nil {
+		if !errors.Is(err, ErrInvalidTwoFactorCode) {
+			u.releaseLoginAttempt(attempt)
+			return err
+		}
+		if err := u.failLoginAttempt(attempt); err != nil {
+			return err
+		}
+		return ErrInvalidTwoFactorCode
+	}
+
+	return u.succeedLoginAttempt(attempt)
+}
+
+// Cada código TOTP é aceito uma única vez: códigos do passo de tempo já utilizado, ou de um anterior, são recusados
+func (u *UserUseCaseImpl) useTOTPCode(user *entity.User, code string) error {
+	step, ok := security.MatchTOTPCode(user.TwoFactorSecret, code, time.Now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+
+	used, err := u.userRepo.UseTOTPStep(user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	user.TOTPLastStep = step
+	return nil
+}
+
+func (u *UserUseCaseImpl) useRecoveryCode(user *entity.User, code string) error {
+	used, err := u.recoveryCodeRepo.Use(user.ID, utils.HashToken(security.NormalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// Gera novos códigos de recuperação, substituindo os anteriores. Somente o hash é persistido
+func (u *UserUseCaseImpl) generateRecoveryCodes(userID uint64) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := security.GenerateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, utils.HashToken(code))
+	}
+
+	if err := u.recoveryCodeRepo.ReplaceForUser(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Indica se o perfil do usuário exige a autenticação em dois fatores
+func (u *UserUseCaseImpl) twoFactorRequired(user *entity.User) bool {
+	return u.cfg.TwoFactor.RequiredForAdmin && user.Profile == "admin"
+}
+
+// Usuários obrigados a usar dois fatores que ainda não os ativaram recebem um token restrito
+func (u *UserUseCaseImpl) twoFactorSetupRequired(user *entity.User) bool {
+	return u.twoFactorRequired(user) && !user.TwoFactorEnabled
+}
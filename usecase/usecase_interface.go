@@ -1,27 +1,155 @@
 package usecase
 
 import (
+	"time"
+
+	"github.com/mvzcanhaco/api-users-crud-verifymy/config"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/notifier"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/security"
 )
 
 type UserUseCase interface {
 	CreateUser(user *CreateUserData) (*entity.User, error)
+	CreateUserWithProfile(user *CreateUserData, profile string) (*entity.User, error)
+	ImportUsers(rows []ImportUserData, dryRun bool) (*ImportReport, error)
+	ChangeUserProfile(id uint64, profile string) (*entity.User, error)
+	ChangeUserStatus(id uint64, status, reason string, suspendedUntil *time.Time) (*entity.User, error)
 	GetUserByID(id uint64) (*entity.User, error)
-	GetAllUsers(page, pageSize int) ([]*entity.User, error)
+	GetUserByIDWithFields(id uint64, fields []string) (*entity.User, error)
+	GetAllUsers(filter *repository.UserFilter, pagination Pagination) (*UserPage, error)
+	ExportUsers(filter *repository.UserFilter, process func(users []*entity.User) error) error
 	UpdateUser(user *entity.User) error
-	DeleteUser(id uint64) error
+	DeleteUser(id, version uint64) error
+	RestoreUser(id uint64) (*entity.User, error)
+	GetDeletedUsers(page, pageSize int) ([]*entity.User, error)
+	PurgeDeletedUsers() (int64, error)
+	PurgeLoginAttempts() (int64, error)
 	CheckEmailExists(email string) (bool, error)
-	AuthenticateUser(email, password string) (string, error)
+	AuthorizeUserWrite(actor *Principal, userID uint64) error
+	AuthenticateUser(email, password, clientIP string) (*AuthTokens, error)
+	RefreshTokens(refreshToken string) (*AuthTokens, error)
+	ValidateAccessToken(tokenString string) (*Principal, error)
+	Logout(principal *Principal, refreshToken string, allSessions bool) error
+	RequestPasswordReset(email string) error
+	ResetPassword(token, newPassword string) error
+	ChangePassword(userID uint64, currentPassword, newPassword string) (*AuthTokens, error)
+	VerifyEmail(token string) error
+	ConfirmEmailChange(token string) error
+	ResendVerificationEmail(email string) error
+	CompleteTwoFactorLogin(challengeToken, code, clientIP string) (*AuthTokens, error)
+	SetupTwoFactor(userID uint64) (*TwoFactorSetup, error)
+	ConfirmTwoFactor(userID uint64, code string) ([]string, error)
+	DisableTwoFactor(userID uint64, code, clientIP string) error
+	UnlockUser(id uint64) error
+	CreateAPIKey(userID uint64, name string, expiresAt *time.Time) (*CreatedAPIKey, error)
+	ListAPIKeys(userID uint64) ([]*entity.APIKey, error)
+	RevokeAPIKey(userID, keyID uint64) error
+	ValidateAPIKey(key string) (*Principal, error)
+	ImpersonateUser(actor *Principal, userID uint64, reason, clientIP string) (*AuthTokens, error)
+	ListImpersonationSessions(page, pageSize int) ([]*entity.ImpersonationSession, error)
 }
 
 type UserUseCaseImpl struct {
-	userRepo repository.UserRepository
+	cfg               *config.Config
+	userRepo          repository.UserRepository
+	refreshTokenRepo  repository.RefreshTokenRepository
+	revocationRepo    repository.TokenRevocationRepository
+	passwordResetRepo repository.PasswordResetRepository
+	recoveryCodeRepo  repository.RecoveryCodeRepository
+	loginAttemptRepo  repository.LoginAttemptRepository
+	apiKeyRepo        repository.APIKeyRepository
+	roleRepo          repository.RoleRepository
+	impersonationRepo repository.ImpersonationRepository
+	oauthClientRepo   repository.OAuthClientRepository
+	keyManager        *security.KeyManager
+	notifier          notifier.Notifier
 }
 
-func NewUserUseCaseImpl(userRepo repository.UserRepository) UserUseCase {
+func NewUserUseCaseImpl(
+	cfg *config.Config,
+	keyManager *security.KeyManager,
+	notifier notifier.Notifier,
+	userRepo repository.UserRepository,
+	refreshTokenRepo repository.RefreshTokenRepository,
+	revocationRepo repository.TokenRevocationRepository,
+	passwordResetRepo repository.PasswordResetRepository,
+	recoveryCodeRepo repository.RecoveryCodeRepository,
+	loginAttemptRepo repository.LoginAttemptRepository,
+	apiKeyRepo repository.APIKeyRepository,
+	roleRepo repository.RoleRepository,
+	impersonationRepo repository.ImpersonationRepository,
+	oauthClientRepo repository.OAuthClientRepository,
+) UserUseCase {
 	return &UserUseCaseImpl{
-		userRepo: userRepo,
+		cfg:               cfg,
+		keyManager:        keyManager,
+		notifier:          notifier,
+		userRepo:          userRepo,
+		refreshTokenRepo:  refreshTokenRepo,
+		revocationRepo:    revocationRepo,
+		passwordResetRepo: passwordResetRepo,
+		recoveryCodeRepo:  recoveryCodeRepo,
+		loginAttemptRepo:  loginAttemptRepo,
+		apiKeyRepo:        apiKeyRepo,
+		roleRepo:          roleRepo,
+		impersonationRepo: impersonationRepo,
+		oauthClientRepo:   oauthClientRepo,
+	}
+}
+
+type OAuthClientUseCase interface {
+	RegisterClient(name string, scopes []string) (*RegisteredOAuthClient, error)
+	ListClients() ([]*entity.OAuthClient, error)
+	RevokeClient(id uint64) error
+	IssueClientToken(clientID, clientSecret string, scopes []string) (*ClientToken, error)
+}
+
+type OAuthClientUseCaseImpl struct {
+	cfg        *config.Config
+	clientRepo repository.OAuthClientRepository
+	keyManager *security.KeyManager
+}
+
+func NewOAuthClientUseCaseImpl(
+	cfg *config.Config,
+	keyManager *security.KeyManager,
+	clientRepo repository.OAuthClientRepository,
+) OAuthClientUseCase {
+	return &OAuthClientUseCaseImpl{
+		cfg:        cfg,
+		keyManager: keyManager,
+		clientRepo: clientRepo,
+	}
+}
+
+type RoleUseCase interface {
+	ListRoles() ([]*entity.Role, error)
+	ListPermissions() ([]entity.Permission, error)
+	CreateRole(name, description string, permissions []string) (*entity.Role, error)
+	UpdateRole(id uint64, description string, permissions []string) (*entity.Role, error)
+	DeleteRole(id uint64) error
+	GetUserRoles(userID uint64) ([]*entity.Role, error)
+	AssignRole(userID, roleID uint64) error
+	RemoveRole(userID, roleID uint64) error
+}
+
+type RoleUseCaseImpl struct {
+	roleRepo       repository.RoleRepository
+	userRepo       repository.UserRepository
+	revocationRepo repository.TokenRevocationRepository
+}
+
+func NewRoleUseCaseImpl(
+	roleRepo repository.RoleRepository,
+	userRepo repository.UserRepository,
+	revocationRepo repository.TokenRevocationRepository,
+) RoleUseCase {
+	return &RoleUseCaseImpl{
+		roleRepo:       roleRepo,
+		userRepo:       userRepo,
+		revocationRepo: revocationRepo,
 	}
 }
 
@@ -33,8 +161,102 @@ type CreateUserData struct {
 	Address   *entity.Address `json:"address" validate:"required"`
 }
 
+// Campos editáveis do usuário. É o corpo do PUT e o documento sobre o qual os patches são aplicados
 type UpdateUserData struct {
+	Name      string          `json:"name" validate:"required"`
 	Email     string          `json:"email" validate:"required,email"`
 	BirthDate string          `json:"birthDate" validate:"required"`
 	Address   *entity.Address `json:"address" validate:"required"`
 }
+
+// Paginação por número de página ou, quando UseCursor é verdadeiro, por cursor (keyset no ID).
+// Um cursor vazio inicia a listagem pelo começo
+type Pagination struct {
+	Page      int
+	PageSize  int
+	Cursor    string
+	UseCursor bool
+}
+
+// Página de usuários com o total que atende aos filtros
+type UserPage struct {
+	Users    []*entity.User
+	Total    int64
+	Page     int
+	PageSize int
+	// Cursores opacos para as páginas vizinhas; vazios quando não há página nessa direção
+	NextCursor string
+	PrevCursor string
+}
+
+type AuthTokens struct {
+	AccessToken  string `json:"token,omitempty"`
+	RefreshToken string `json:"refreshToken,omitempty"`
+	TokenType    string `json:"tokenType,omitempty"`
+	ExpiresIn    int64  `json:"expiresIn"`
+	// Preenchido quando o login exige o código de dois fatores; nesse caso nenhum token de acesso é emitido
+	ChallengeToken string `json:"challengeToken,omitempty"`
+	// Indica que o usuário precisa ativar a autenticação em dois fatores para usar as rotas administrativas
+	TwoFactorSetupRequired bool `json:"twoFactorSetupRequired,omitempty"`
+}
+
+// Dados para cadastrar o segredo TOTP no aplicativo autenticador
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauthUri"`
+}
+
+// Chave de API recém-criada. A chave completa só é retornada neste momento
+type CreatedAPIKey struct {
+	*entity.APIKey
+	Key string `json:"key"`
+}
+
+// Cliente OAuth recém-registrado. O segredo só é retornado neste momento
+type RegisteredOAuthClient struct {
+	*entity.OAuthClient
+	ClientSecret string `json:"clientSecret"`
+}
+
+// Resposta de token no formato da RFC 6749 (seção 5.1)
+type ClientToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// Identidade autenticada extraída de um token de acesso ou de uma chave de API válidos
+type Principal struct {
+	UserID    uint64
+	Profile   string
+	TokenID   string
+	ExpiresAt time.Time
+	// Usuário com dois fatores obrigatórios que ainda não concluiu a ativação
+	TwoFactorPending bool
+	// Preenchido quando a autenticação foi feita por chave de API
+	APIKeyID uint64
+	// Preenchidos para tokens de clientes OAuth, que não representam um usuário
+	ClientID string
+	Scopes   []string
+	// Permissões efetivas do usuário, somando o papel do perfil e os papéis atribuídos
+	Permissions []string
+	// Administrador que está agindo como o usuário (claim "act"); zero fora de uma personificação
+	ActorID uint64
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return containsScope(p.Scopes, scope)
+}
+
+func (p *Principal) IsImpersonated() bool {
+	return p.ActorID != 0
+}
+
+// Clientes OAuth são autorizados pelos escopos concedidos; usuários, pelas permissões dos seus papéis
+func (p *Principal) HasPermission(permission string) bool {
+	if p.ClientID != "" {
+		return p.HasScope(permission)
+	}
+	return containsScope(p.Permissions, permission)
+}
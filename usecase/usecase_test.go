@@ -2,20 +2,45 @@ package usecase
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/dgrijalva/jwt-go"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/config"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/notifier"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/security"
+	"gorm.io/gorm"
 )
 
+const racedEmail = "raced@example.com"
+
 type MockUserRepository struct {
-	users []*entity.User
+	users   []*entity.User
+	deleted []*entity.User
 }
 
 func (repo *MockUserRepository) Create(user *entity.User) error {
 	if user == nil {
 		return errors.New("user is nil")
 	}
+	if user.Email == "fail@example.com" {
+		return errors.New("duplicate entry")
+	}
+	// Simula o e-mail cadastrado por outra requisição depois da verificação
+	if user.Email == racedEmail {
+		return repository.ErrDuplicateKey
+	}
+	if user.ID == 0 {
+		user.ID = uint64(len(repo.users) + len(repo.deleted) + 1)
+	}
 	repo.users = append(repo.users, user)
 	return nil
 }
@@ -26,10 +51,40 @@ func (repo *MockUserRepository) FindByID(id uint64) (*entity.User, error) {
 			return user, nil
 		}
 	}
-	return nil, errors.New("user not found")
+	return nil, repository.ErrNotFound
+}
+
+func (repo *MockUserRepository) CreateBatch(users []*entity.User) error {
+	for _, user := range users {
+		if user.Email == "fail@example.com" {
+			return errors.New("duplicate entry")
+		}
+	}
+	for _, user := range users {
+		user.ID = uint64(len(repo.users) + len(repo.deleted) + 1)
+		repo.users = append(repo.users, user)
+	}
+	return nil
+}
+
+func (repo *MockUserRepository) ExistingEmails(emails []string) (map[string]bool, error) {
+	// Like MySQL's default collation, the comparison ignores case
+	existing := make(map[string]bool)
+	for _, email := range emails {
+		for _, user := range append(repo.users, repo.deleted...) {
+			if strings.EqualFold(user.Email, email) {
+				existing[user.Email] = true
+			}
+		}
+	}
+	return existing, nil
 }
 
-func (repo *MockUserRepository) FindAll(page, pageSize int) ([]*entity.User, error) {
+func (repo *MockUserRepository) FindByIDWithFields(id uint64, fields []string) (*entity.User, error) {
+	return repo.FindByID(id)
+}
+
+func (repo *MockUserRepository) FindAll(filter *repository.UserFilter, page, pageSize int) ([]*entity.User, error) {
 	startIndex := (page - 1) * pageSize
 	if startIndex < 0 || startIndex >= len(repo.users) {
 		return nil, errors.New("invalid page")
@@ -41,12 +96,54 @@ func (repo *MockUserRepository) FindAll(page, pageSize int) ([]*entity.User, err
 	return repo.users[startIndex:endIndex], nil
 }
 
+func (repo *MockUserRepository) FindAfterID(filter *repository.UserFilter, cursorID uint64, backward bool, limit int) ([]*entity.User, error) {
+	var users []*entity.User
+	if backward {
+		for i := len(repo.users) - 1; i >= 0 && len(users) < limit; i-- {
+			if repo.users[i].ID < cursorID {
+				users = append(users, repo.users[i])
+			}
+		}
+		return users, nil
+	}
+	for _, user := range repo.users {
+		if user.ID > cursorID && len(users) < limit {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (repo *MockUserRepository) Count(filter *repository.UserFilter) (int64, error) {
+	return int64(len(repo.users)), nil
+}
+
+func (repo *MockUserRepository) FindInBatches(filter *repository.UserFilter, batchSize int, process func(users []*entity.User) error) error {
+	for start := 0; start < len(repo.users); start += batchSize {
+		end := start + batchSize
+		if end > len(repo.users) {
+			end = len(repo.users)
+		}
+		if err := process(repo.users[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (repo *MockUserRepository) Update(user *entity.User) error {
 	if user == nil {
 		return errors.New("user is nil")
 	}
+	if user.Email == racedEmail {
+		return repository.ErrDuplicateKey
+	}
 	for i, u := range repo.users {
 		if u.ID == user.ID {
+			if u.Version != user.Version {
+				return repository.ErrVersionConflict
+			}
+			user.Version++
 			repo.users[i] = user
 			return nil
 		}
@@ -54,213 +151,569 @@ func (repo *MockUserRepository) Update(user *entity.User) error {
 	return errors.New("user not found")
 }
 
-func (repo *MockUserRepository) Delete(id uint64) error {
+func (repo *MockUserRepository) UseTOTPStep(id uint64, step int64) (bool, error) {
+	user, err := repo.FindByID(id)
+	if err != nil || user.TOTPLastStep >= step {
+		return false, err
+	}
+	user.TOTPLastStep = step
+	return true, nil
+}
+
+func (repo *MockUserRepository) Delete(id, version uint64) (bool, error) {
+	if repo.isLastAdmin(id) {
+		return false, nil
+	}
 	for i, user := range repo.users {
 		if user.ID == id {
+			if version != 0 && user.Version != version {
+				return false, repository.ErrVersionConflict
+			}
 			repo.users = append(repo.users[:i], repo.users[i+1:]...)
-			return nil
+			user.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+			repo.deleted = append(repo.deleted, user)
+			return true, nil
 		}
 	}
-	return errors.New("user not found")
+	return false, errors.New("user not found")
 }
 
-func (repo *MockUserRepository) FindByEmail(email string) (*entity.User, error) {
-	for _, user := range repo.users {
-		if user.Email == email {
-			return user, nil
+func (repo *MockUserRepository) EmailInUse(email string, exceptID uint64) (bool, error) {
+	for _, user := range append(repo.users, repo.deleted...) {
+		if user.ID != exceptID && (user.Email == email || user.PendingEmail == email) {
+			return true, nil
 		}
 	}
-	return nil, errors.New("user not found")
+	return false, nil
 }
 
-func TestCreateUser(t *testing.T) {
-	uc := &UserUseCaseImpl{
-		userRepo: &MockUserRepository{},
+func (repo *MockUserRepository) FindDeleted(page, pageSize int) ([]*entity.User, error) {
+	start, end := pageBounds(len(repo.deleted), page, pageSize)
+	return repo.deleted[start:end], nil
+}
+
+func (repo *MockUserRepository) Restore(id uint64) error {
+	for i, user := range repo.deleted {
+		if user.ID == id {
+			repo.deleted = append(repo.deleted[:i], repo.deleted[i+1:]...)
+			user.DeletedAt = gorm.DeletedAt{}
+			repo.users = append(repo.users, user)
+			return nil
+		}
 	}
+	return repository.ErrNotFound
+}
 
-	createUserData := &CreateUserData{
-		Name:      "John Doe",
-		Email:     "john@example.com",
-		Password:  "password",
-		BirthDate: "1992-02-01",
-		Address: &entity.Address{
-			Street:  "R Manuel Jacinto",
-			City:    "Sao Paulo",
-			State:   "SP",
-			Country: "Brasil",
-		},
+func (repo *MockUserRepository) PurgeDeleted(before time.Time, limit int) (int64, error) {
+	var kept []*entity.User
+	var purged int64
+	for _, user := range repo.deleted {
+		if user.DeletedAt.Time.Before(before) && purged < int64(limit) {
+			purged++
+			continue
+		}
+		kept = append(kept, user)
 	}
+	repo.deleted = kept
+	return purged, nil
+}
 
-	user, err := uc.CreateUser(createUserData)
+func (repo *MockUserRepository) UpdateProfile(id uint64, profile string) (bool, error) {
+	if profile != "admin" && repo.isLastAdmin(id) {
+		return false, nil
+	}
+	user, err := repo.FindByID(id)
 	if err != nil {
-		t.Errorf("Error creating user: %s", err.Error())
+		return false, err
 	}
+	user.Profile = profile
+	return true, nil
+}
 
-	if user.Name != createUserData.Name {
-		t.Errorf("Expected user name to be %s, got %s", createUserData.Name, user.Name)
+func (repo *MockUserRepository) UpdateStatus(id uint64, status, reason string, suspendedUntil *time.Time) (bool, error) {
+	if status != "active" && repo.isLastAdmin(id) {
+		return false, nil
 	}
-
-	// Test error case: nil user
-	_, err = uc.CreateUser(nil)
-	if err == nil {
-		t.Error("Expected error for nil user, got nil")
+	user, err := repo.FindByID(id)
+	if err != nil {
+		return false, err
 	}
+	user.Status, user.StatusReason, user.SuspendedUntil = status, reason, suspendedUntil
+	return true, nil
 }
 
-func TestGetUserByID(t *testing.T) {
-	uc := &UserUseCaseImpl{
-		userRepo: &MockUserRepository{},
+func (repo *MockUserRepository) isLastAdmin(id uint64) bool {
+	var admins []uint64
+	for _, user := range repo.users {
+		if user.Profile == "admin" && user.EffectiveStatus(time.Now()) == "active" {
+			admins = append(admins, user.ID)
+		}
 	}
+	return len(admins) == 1 && admins[0] == id
+}
 
-	// Test existing user
-	existingUser := &entity.User{
-		ID:        1,
-		Name:      "John Doe",
-		Email:     "john@example.com",
-		Password:  "password",
-		BirthDate: "1992-02-01",
-		Address: &entity.Address{
-			Street:  "R Manuel Jacinto",
-			City:    "Sao Paulo",
-			State:   "SP",
-			Country: "Brasil",
-		},
+func (repo *MockUserRepository) FindByEmail(email string) (*entity.User, error) {
+	for _, user := range repo.users {
+		if user.Email == email {
+			return user, nil
+		}
 	}
-	uc.userRepo.Create(existingUser)
+	return nil, repository.ErrNotFound
+}
 
-	user, err := uc.GetUserByID(existingUser.ID)
-	if err != nil {
-		t.Errorf("Error getting user by ID: %s", err.Error())
+type MockRefreshTokenRepository struct {
+	tokens []*entity.RefreshToken
+}
+
+func (repo *MockRefreshTokenRepository) Create(token *entity.RefreshToken) error {
+	token.ID = uint64(len(repo.tokens) + 1)
+	repo.tokens = append(repo.tokens, token)
+	return nil
+}
+
+func (repo *MockRefreshTokenRepository) FindByHash(tokenHash string) (*entity.RefreshToken, error) {
+	for _, token := range repo.tokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
 	}
+	return nil, repository.ErrNotFound
+}
 
-	if user != existingUser {
-		t.Error("Expected user to be the same as the existing user")
+func (repo *MockRefreshTokenRepository) Revoke(id uint64) (bool, error) {
+	for _, token := range repo.tokens {
+		if token.ID == id && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	// Test non-existing user
-	_, err = uc.GetUserByID(123)
-	if err == nil {
-		t.Error("Expected error for non-existing user, got nil")
+func (repo *MockRefreshTokenRepository) RevokeFamily(familyID string) error {
+	for _, token := range repo.tokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+		}
 	}
+	return nil
 }
 
-func TestGetAllUsers(t *testing.T) {
-	uc := &UserUseCaseImpl{
-		userRepo: &MockUserRepository{},
+func (repo *MockRefreshTokenRepository) RevokeAllForUser(userID uint64) error {
+	for _, token := range repo.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+		}
 	}
+	return nil
+}
 
-	// Test with some users in the repository
-	users := []*entity.User{
-		{
-			ID:        1,
-			Name:      "John Doe",
-			Email:     "john@example.com",
-			Password:  "password",
-			BirthDate: "1992-02-01",
-			Address: &entity.Address{
-				Street:  "R Manuel Jacinto",
-				City:    "Sao Paulo",
-				State:   "SP",
-				Country: "Brasil",
-			},
-		},
-		{
-			ID:        2,
-			Name:      "Jane Smith",
-			Email:     "jane@example.com",
-			Password:  "password",
-			BirthDate: "1992-02-01",
-			Address: &entity.Address{
-				Street:  "R Manuel Jacinto",
-				City:    "Sao Paulo",
-				State:   "SP",
-				Country: "Brasil",
-			},
-		},
+type MockPasswordResetRepository struct {
+	tokens []*entity.PasswordResetToken
+}
+
+func (repo *MockPasswordResetRepository) Create(token *entity.PasswordResetToken) error {
+	token.ID = uint64(len(repo.tokens) + 1)
+	repo.tokens = append(repo.tokens, token)
+	return nil
+}
+
+func (repo *MockPasswordResetRepository) FindByHash(tokenHash string) (*entity.PasswordResetToken, error) {
+	for _, token := range repo.tokens {
+		if token.TokenHash == tokenHash {
+			return token, nil
+		}
 	}
-	for _, user := range users {
-		uc.userRepo.Create(user)
+	return nil, repository.ErrNotFound
+}
+
+func (repo *MockPasswordResetRepository) MarkUsed(id uint64) (bool, error) {
+	for _, token := range repo.tokens {
+		if token.ID == id && token.UsedAt == nil {
+			now := time.Now()
+			token.UsedAt = &now
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	// Test case 1: Valid page and page size
-	users, err := uc.GetAllUsers(1, 10)
-	if err != nil {
-		t.Errorf("Expected no error, but got %v", err)
+func (repo *MockPasswordResetRepository) InvalidateForUser(userID uint64) error {
+	for _, token := range repo.tokens {
+		if token.UserID == userID && token.UsedAt == nil {
+			now := time.Now()
+			token.UsedAt = &now
+		}
 	}
-	if len(users) != 2 {
-		t.Errorf("Expected 2 users, but got %d", len(users))
+	return nil
+}
+
+type MockRecoveryCodeRepository struct {
+	codes []*entity.RecoveryCode
+}
+
+func (repo *MockRecoveryCodeRepository) ReplaceForUser(userID uint64, codeHashes []string) error {
+	repo.DeleteForUser(userID)
+	for _, hash := range codeHashes {
+		repo.codes = append(repo.codes, &entity.RecoveryCode{UserID: userID, CodeHash: hash})
 	}
+	return nil
+}
 
-	// Test case 2: Invalid page
-	_, err = uc.GetAllUsers(0, 10)
-	if err == nil {
-		t.Errorf("Expected error for invalid page, but got nil")
-	} else if err.Error() != "page and pageSize must be greater than 0" {
-		t.Errorf("Expected error message 'page and pageSize must be greater than 0', but got '%s'", err.Error())
+func (repo *MockRecoveryCodeRepository) Use(userID uint64, codeHash string) (bool, error) {
+	for _, code := range repo.codes {
+		if code.UserID == userID && code.CodeHash == codeHash && code.UsedAt == nil {
+			now := time.Now()
+			code.UsedAt = &now
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	// Test case 3: Invalid page size
-	_, err = uc.GetAllUsers(2, 0)
-	if err == nil {
-		t.Errorf("Expected error for invalid pageSize, but got nil")
-	} else if err.Error() != "page and pageSize must be greater than 0" {
-		t.Errorf("Expected error message 'page and pageSize must be greater than 0', but got '%s'", err.Error())
+func (repo *MockRecoveryCodeRepository) DeleteForUser(userID uint64) error {
+	var remaining []*entity.RecoveryCode
+	for _, code := range repo.codes {
+		if code.UserID != userID {
+			remaining = append(remaining, code)
+		}
 	}
+	repo.codes = remaining
+	return nil
 }
 
-func TestUpdateUser(t *testing.T) {
-	uc := &UserUseCaseImpl{
-		userRepo: &MockUserRepository{},
+type MockAPIKeyRepository struct {
+	keys []*entity.APIKey
+}
+
+func (repo *MockAPIKeyRepository) Create(key *entity.APIKey) error {
+	key.ID = uint64(len(repo.keys) + 1)
+	repo.keys = append(repo.keys, key)
+	return nil
+}
+
+func (repo *MockAPIKeyRepository) FindByHash(keyHash string) (*entity.APIKey, error) {
+	for _, key := range repo.keys {
+		if key.KeyHash == keyHash {
+			return key, nil
+		}
 	}
+	return nil, repository.ErrNotFound
+}
 
-	// Test existing user
-	existingUser := &entity.User{
-		ID:        1,
-		Name:      "John Doe",
-		Email:     "john@example.com",
-		Password:  "password",
-		BirthDate: "1992-02-01",
-		Address: &entity.Address{
-			Street:  "R Manuel Jacinto",
-			City:    "Sao Paulo",
-			State:   "SP",
-			Country: "Brasil",
-		},
+func (repo *MockAPIKeyRepository) ListByUser(userID uint64) ([]*entity.APIKey, error) {
+	var keys []*entity.APIKey
+	for _, key := range repo.keys {
+		if key.UserID == userID && key.RevokedAt == nil {
+			keys = append(keys, key)
+		}
 	}
-	uc.userRepo.Create(existingUser)
+	return keys, nil
+}
 
-	// Update user
-	existingUser.Name = "Updated Name"
-	err := uc.UpdateUser(existingUser)
-	if err != nil {
-		t.Errorf("Error updating user: %s", err.Error())
+func (repo *MockAPIKeyRepository) Revoke(id, userID uint64) (bool, error) {
+	for _, key := range repo.keys {
+		if key.ID == id && key.UserID == userID && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	// Check if user was updated
-	updatedUser, err := uc.GetUserByID(existingUser.ID)
-	if err != nil {
-		t.Errorf("Error getting user by ID: %s", err.Error())
+func (repo *MockAPIKeyRepository) RevokeAllForUser(userID uint64) error {
+	for _, key := range repo.keys {
+		if key.UserID == userID && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+		}
 	}
+	return nil
+}
 
-	if updatedUser.Name != existingUser.Name {
-		t.Errorf("Expected user name to be %s, got %s", existingUser.Name, updatedUser.Name)
+func (repo *MockAPIKeyRepository) TouchLastUsed(id uint64, usedAt time.Time) error {
+	for _, key := range repo.keys {
+		if key.ID == id {
+			key.LastUsedAt = &usedAt
+		}
 	}
+	return nil
+}
 
-	// Test error case: nil user
-	err = uc.UpdateUser(nil)
-	if err == nil {
-		t.Error("Expected error for nil user, got nil")
+type MockOAuthClientRepository struct {
+	clients []*entity.OAuthClient
+}
+
+func (repo *MockOAuthClientRepository) Create(client *entity.OAuthClient) error {
+	client.ID = uint64(len(repo.clients) + 1)
+	repo.clients = append(repo.clients, client)
+	return nil
+}
+
+func (repo *MockOAuthClientRepository) FindByClientID(clientID string) (*entity.OAuthClient, error) {
+	for _, client := range repo.clients {
+		if client.ClientID == clientID && client.RevokedAt == nil {
+			return client, nil
+		}
 	}
+	return nil, repository.ErrNotFound
 }
 
-func TestDeleteUser(t *testing.T) {
-	uc := &UserUseCaseImpl{
-		userRepo: &MockUserRepository{},
+func (repo *MockOAuthClientRepository) FindAll() ([]*entity.OAuthClient, error) {
+	return repo.clients, nil
+}
+
+func (repo *MockOAuthClientRepository) Revoke(id uint64) (bool, error) {
+	for _, client := range repo.clients {
+		if client.ID == id && client.RevokedAt == nil {
+			now := time.Now()
+			client.RevokedAt = &now
+			return true, nil
+		}
 	}
+	return false, nil
+}
 
-	// Test existing user
-	existingUser := &entity.User{
+type MockRoleRepository struct {
+	roles       []*entity.Role
+	permissions []entity.Permission
+	userRoles   map[uint64][]uint64
+	users       *MockUserRepository
+}
+
+// Repositório com os papéis e permissões criados pela migração
+func newMockRoleRepository(users *MockUserRepository) *MockRoleRepository {
+	repo := &MockRoleRepository{userRoles: make(map[uint64][]uint64), users: users}
+	for i, name := range []string{"users:read", "users:write", "users:delete", "roles:manage", "clients:manage"} {
+		repo.permissions = append(repo.permissions, entity.Permission{ID: uint64(i + 1), Name: name})
+	}
+	repo.Create(&entity.Role{Name: "admin", Permissions: repo.permissions})
+	repo.Create(&entity.Role{Name: "user"})
+	return repo
+}
+
+func (repo *MockRoleRepository) Create(role *entity.Role) error {
+	role.ID = uint64(len(repo.roles) + 1)
+	repo.roles = append(repo.roles, role)
+	return nil
+}
+
+func (repo *MockRoleRepository) FindByID(id uint64) (*entity.Role, error) {
+	for _, role := range repo.roles {
+		if role.ID == id {
+			return role, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (repo *MockRoleRepository) FindByName(name string) (*entity.Role, error) {
+	for _, role := range repo.roles {
+		if role.Name == name {
+			return role, nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (repo *MockRoleRepository) FindAll() ([]*entity.Role, error) {
+	return repo.roles, nil
+}
+
+func (repo *MockRoleRepository) UpdatePermissions(role *entity.Role, permissions []entity.Permission) error {
+	role.Permissions = permissions
+	return nil
+}
+
+func (repo *MockRoleRepository) Delete(id uint64) error {
+	for i, role := range repo.roles {
+		if role.ID == id {
+			repo.roles = append(repo.roles[:i], repo.roles[i+1:]...)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (repo *MockRoleRepository) FindPermissions() ([]entity.Permission, error) {
+	return repo.permissions, nil
+}
+
+func (repo *MockRoleRepository) FindPermissionsByName(names []string) ([]entity.Permission, error) {
+	var permissions []entity.Permission
+	for _, permission := range repo.permissions {
+		for _, name := range names {
+			if permission.Name == name {
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+	return permissions, nil
+}
+
+func (repo *MockRoleRepository) FindByUser(userID uint64) ([]*entity.Role, error) {
+	var roles []*entity.Role
+	for _, roleID := range repo.userRoles[userID] {
+		if role, err := repo.FindByID(roleID); err == nil {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func (repo *MockRoleRepository) AssignToUser(userID, roleID uint64) error {
+	for _, assigned := range repo.userRoles[userID] {
+		if assigned == roleID {
+			return nil
+		}
+	}
+	repo.userRoles[userID] = append(repo.userRoles[userID], roleID)
+	return nil
+}
+
+func (repo *MockRoleRepository) RemoveFromUser(userID, roleID uint64) (bool, error) {
+	for i, assigned := range repo.userRoles[userID] {
+		if assigned == roleID {
+			repo.userRoles[userID] = append(repo.userRoles[userID][:i], repo.userRoles[userID][i+1:]...)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (repo *MockRoleRepository) PermissionsForUser(userID uint64, profile string) ([]string, error) {
+	roles, _ := repo.FindByUser(userID)
+	if role, err := repo.FindByName(profile); err == nil {
+		roles = append(roles, role)
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	for _, role := range roles {
+		for _, permission := range role.Permissions {
+			if !seen[permission.Name] {
+				seen[permission.Name] = true
+				names = append(names, permission.Name)
+			}
+		}
+	}
+	return names, nil
+}
+
+func (repo *MockRoleRepository) FindUserIDs(role *entity.Role) ([]uint64, error) {
+	var ids []uint64
+	for _, user := range repo.users.users {
+		for _, roleID := range repo.userRoles[user.ID] {
+			if roleID == role.ID {
+				ids = append(ids, user.ID)
+			}
+		}
+		if user.Profile == role.Name {
+			ids = append(ids, user.ID)
+		}
+	}
+	return ids, nil
+}
+
+type MockImpersonationRepository struct {
+	sessions []*entity.ImpersonationSession
+}
+
+func (repo *MockImpersonationRepository) Create(session *entity.ImpersonationSession) error {
+	session.ID = uint64(len(repo.sessions) + 1)
+	repo.sessions = append(repo.sessions, session)
+	return nil
+}
+
+func (repo *MockImpersonationRepository) FindAll(page, pageSize int) ([]*entity.ImpersonationSession, error) {
+	start, end := pageBounds(len(repo.sessions), page, pageSize)
+	return repo.sessions[start:end], nil
+}
+
+// Limites da página dentro de uma lista com total itens
+func pageBounds(total, page, pageSize int) (int, int) {
+	start := (page - 1) * pageSize
+	if start > total {
+		start = total
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return start, end
+}
+
+type MockNotifier struct {
+	messages []notifier.Message
+}
+
+func (n *MockNotifier) Notify(message notifier.Message) error {
+	n.messages = append(n.messages, message)
+	return nil
+}
+
+// Extrai o token do link enviado na última mensagem
+func lastMessageToken(t *testing.T, n *MockNotifier) string {
+	if len(n.messages) == 0 {
+		t.Fatal("Expected a message to be sent")
+	}
+	match := regexp.MustCompile(`token=([A-Za-z0-9_.%-]+)`).FindStringSubmatch(n.messages[len(n.messages)-1].Body)
+	if match == nil {
+		t.Fatal("Expected message to contain a token")
+	}
+	token, _ := url.QueryUnescape(match[1])
+	return token
+}
+
+func newAuthTestUseCase(t *testing.T) (*UserUseCaseImpl, *entity.User) {
+	hashedPassword, err := HashPassword("password")
+	if err != nil {
+		t.Fatalf("Error hashing password: %s", err.Error())
+	}
+
+	userRepo := &MockUserRepository{}
+	uc := &UserUseCaseImpl{
+		cfg:               config.Load(),
+		keyManager:        security.NewHMACKeyManager("test", []byte("secret")),
+		userRepo:          userRepo,
+		refreshTokenRepo:  &MockRefreshTokenRepository{},
+		revocationRepo:    repository.NewInMemoryTokenRevocationRepository(),
+		passwordResetRepo: &MockPasswordResetRepository{},
+		recoveryCodeRepo:  &MockRecoveryCodeRepository{},
+		loginAttemptRepo:  repository.NewInMemoryLoginAttemptRepository(),
+		apiKeyRepo:        &MockAPIKeyRepository{},
+		roleRepo:          newMockRoleRepository(userRepo),
+		impersonationRepo: &MockImpersonationRepository{},
+		oauthClientRepo:   &MockOAuthClientRepository{},
+		notifier:          &MockNotifier{},
+	}
+
+	user := &entity.User{
 		ID:        1,
+		Name:      "John Doe",
+		Email:     "john@example.com",
+		Password:  hashedPassword,
+		BirthDate: "1992-02-01",
+		Profile:   "user",
+	}
+	uc.userRepo.Create(user)
+
+	return uc, user
+}
+
+func TestCreateUser(t *testing.T) {
+	uc := &UserUseCaseImpl{
+		cfg:        config.Load(),
+		keyManager: security.NewHMACKeyManager("test", []byte("secret")),
+		notifier:   &MockNotifier{},
+		userRepo:   &MockUserRepository{},
+	}
+
+	createUserData := &CreateUserData{
 		Name:      "John Doe",
 		Email:     "john@example.com",
 		Password:  "password",
@@ -272,33 +725,29 @@ func TestDeleteUser(t *testing.T) {
 			Country: "Brasil",
 		},
 	}
-	uc.userRepo.Create(existingUser)
 
-	// Delete user
-	err := uc.DeleteUser(existingUser.ID)
+	user, err := uc.CreateUser(createUserData)
 	if err != nil {
-		t.Errorf("Error deleting user: %s", err.Error())
+		t.Errorf("Error creating user: %s", err.Error())
 	}
 
-	// Check if user was deleted
-	_, err = uc.GetUserByID(existingUser.ID)
-	if err == nil {
-		t.Error("Expected error for non-existing user, got nil")
+	if user.Name != createUserData.Name {
+		t.Errorf("Expected user name to be %s, got %s", createUserData.Name, user.Name)
 	}
 
-	// Test error case: non-existing user
-	err = uc.DeleteUser(123)
+	// Test error case: nil user
+	_, err = uc.CreateUser(nil)
 	if err == nil {
-		t.Error("Expected error for non-existing user, got nil")
+		t.Error("Expected error for nil user, got nil")
 	}
 }
 
-func TestCheckEmailExists(t *testing.T) {
+func TestGetUserByID(t *testing.T) {
 	uc := &UserUseCaseImpl{
 		userRepo: &MockUserRepository{},
 	}
 
-	// Test existing email
+	// Test existing user
 	existingUser := &entity.User{
 		ID:        1,
 		Name:      "John Doe",
@@ -312,47 +761,1795 @@ func TestCheckEmailExists(t *testing.T) {
 			Country: "Brasil",
 		},
 	}
-	err := uc.userRepo.Create(existingUser)
+	uc.userRepo.Create(existingUser)
+
+	user, err := uc.GetUserByID(existingUser.ID)
 	if err != nil {
-		t.Errorf("Erro ao criar usuario: %s", err.Error())
+		t.Errorf("Error getting user by ID: %s", err.Error())
 	}
-	exists, err := uc.CheckEmailExists(existingUser.Email)
-	if err != nil {
-		t.Errorf("Error checking email exists: %s", err.Error())
+
+	if user != existingUser {
+		t.Error("Expected user to be the same as the existing user")
 	}
 
-	if !exists {
-		t.Error("Expected email to exist, got false")
+	// Test non-existing user
+	_, err = uc.GetUserByID(123)
+	if err == nil {
+		t.Error("Expected error for non-existing user, got nil")
 	}
+}
 
-	// Test non-existing email
-	exists, _ = uc.CheckEmailExists("nonexisting@example.com")
+func TestGetAllUsers(t *testing.T) {
+	uc := &UserUseCaseImpl{
+		cfg:      config.Load(),
+		userRepo: &MockUserRepository{},
+	}
 
-	if exists {
-		t.Error("Expected email to not exist, got true")
+	// Test with some users in the repository
+	users := []*entity.User{
+		{
+			ID:        1,
+			Name:      "John Doe",
+			Email:     "john@example.com",
+			Password:  "password",
+			BirthDate: "1992-02-01",
+			Address: &entity.Address{
+				Street:  "R Manuel Jacinto",
+				City:    "Sao Paulo",
+				State:   "SP",
+				Country: "Brasil",
+			},
+		},
+		{
+			ID:        2,
+			Name:      "Jane Smith",
+			Email:     "jane@example.com",
+			Password:  "password",
+			BirthDate: "1992-02-01",
+			Address: &entity.Address{
+				Street:  "R Manuel Jacinto",
+				City:    "Sao Paulo",
+				State:   "SP",
+				Country: "Brasil",
+			},
+		},
+	}
+	for _, user := range users {
+		uc.userRepo.Create(user)
+	}
+
+	// Test case 1: Valid page and page size
+	page, err := uc.GetAllUsers(nil, Pagination{Page: 1, PageSize: 10})
+	if err != nil {
+		t.Fatalf("Expected no error, but got %v", err)
+	}
+	if len(page.Users) != 2 || page.Total != 2 {
+		t.Errorf("Expected 2 users, but got %d (total %d)", len(page.Users), page.Total)
+	}
+
+	// Test case 2: Invalid page
+	_, err = uc.GetAllUsers(nil, Pagination{Page: 0, PageSize: 10})
+	if err == nil {
+		t.Errorf("Expected error for invalid page, but got nil")
+	} else if err.Error() != "page and pageSize must be greater than 0" {
+		t.Errorf("Expected error message 'page and pageSize must be greater than 0', but got '%s'", err.Error())
+	}
+
+	// Test case 3: Invalid page size
+	_, err = uc.GetAllUsers(nil, Pagination{Page: 2, PageSize: 0})
+	if err == nil {
+		t.Errorf("Expected error for invalid pageSize, but got nil")
+	} else if err.Error() != "page and pageSize must be greater than 0" {
+		t.Errorf("Expected error message 'page and pageSize must be greater than 0', but got '%s'", err.Error())
+	}
+	// Test case 4: Inverted age range
+	minAge, maxAge := 40, 30
+	_, err = uc.GetAllUsers(&repository.UserFilter{MinAge: &minAge, MaxAge: &maxAge}, Pagination{Page: 1, PageSize: 10})
+	if !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("Expected ErrInvalidFilter for an inverted age range, got %v", err)
 	}
 }
 
-func TestCalculateAge(t *testing.T) {
-	// Test with a known birth date and current date
-	birthDate := "1992-02-01"
-	expectedAge := 31 // Assuming current date is 2023-07-11
+func TestUpdateUser(t *testing.T) {
+	uc := &UserUseCaseImpl{
+		userRepo: &MockUserRepository{},
+	}
 
-	age, err := utils.CalculateAge(birthDate)
+	// Test existing user
+	existingUser := &entity.User{
+		ID:        1,
+		Name:      "John Doe",
+		Email:     "john@example.com",
+		Password:  "password",
+		BirthDate: "1992-02-01",
+		Profile:   "user",
+		Address: &entity.Address{
+			Street:  "R Manuel Jacinto",
+			City:    "Sao Paulo",
+			State:   "SP",
+			Country: "Brasil",
+		},
+	}
+	uc.userRepo.Create(existingUser)
+
+	// Update user
+	existingUser.Name = "Updated Name"
+	err := uc.UpdateUser(existingUser)
 	if err != nil {
-		t.Errorf("Error calculating age: %s", err.Error())
+		t.Errorf("Error updating user: %s", err.Error())
 	}
 
-	if age != expectedAge {
-		t.Errorf("Expected age to be %d, got %d", expectedAge, age)
+	// Check if user was updated
+	updatedUser, err := uc.GetUserByID(existingUser.ID)
+	if err != nil {
+		t.Errorf("Error getting user by ID: %s", err.Error())
 	}
 
-	// Test with future birth date
-	futureDate := "2050-02-01"
+	if updatedUser.Name != existingUser.Name {
+		t.Errorf("Expected user name to be %s, got %s", existingUser.Name, updatedUser.Name)
+	}
 
-	_, err = utils.CalculateAge(futureDate)
+	// Test error case: nil user
+	err = uc.UpdateUser(nil)
 	if err == nil {
-		t.Error("Expected error for future birth date, got nil")
+		t.Error("Expected error for nil user, got nil")
+	}
+
+	// Test error case: the updated user must still be valid
+	invalid := *existingUser
+	invalid.Name = ""
+	if err := uc.UpdateUser(&invalid); !errors.Is(err, ErrInvalidUserData) {
+		t.Errorf("Expected ErrInvalidUserData for an empty name, got %v", err)
+	}
+	invalid = *existingUser
+	invalid.Address = &entity.Address{Street: "R Manuel Jacinto"}
+	if err := uc.UpdateUser(&invalid); !errors.Is(err, ErrInvalidUserData) {
+		t.Errorf("Expected ErrInvalidUserData for an incomplete address, got %v", err)
+	}
+	// Test error case: a stale copy cannot overwrite a newer version
+	stale := *existingUser
+	stale.Version--
+	stale.Name = "Stale Name"
+	if err := uc.UpdateUser(&stale); !errors.Is(err, repository.ErrVersionConflict) {
+		t.Errorf("Expected ErrVersionConflict for a stale user, got %v", err)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	uc := &UserUseCaseImpl{
+		userRepo:         &MockUserRepository{},
+		refreshTokenRepo: &MockRefreshTokenRepository{},
+		revocationRepo:   repository.NewInMemoryTokenRevocationRepository(),
 	}
 
+	// Test existing user
+	existingUser := &entity.User{
+		ID:        1,
+		Name:      "John Doe",
+		Email:     "john@example.com",
+		Password:  "password",
+		BirthDate: "1992-02-01",
+		Address: &entity.Address{
+			Street:  "R Manuel Jacinto",
+			City:    "Sao Paulo",
+			State:   "SP",
+			Country: "Brasil",
+		},
+	}
+	uc.userRepo.Create(existingUser)
+
+	// Delete user
+	err := uc.DeleteUser(existingUser.ID, 0)
+	if err != nil {
+		t.Errorf("Error deleting user: %s", err.Error())
+	}
+
+	// Check if user was deleted
+	_, err = uc.GetUserByID(existingUser.ID)
+	if err == nil {
+		t.Error("Expected error for non-existing user, got nil")
+	}
+
+	// Test error case: non-existing user
+	err = uc.DeleteUser(123, 0)
+	if err == nil {
+		t.Error("Expected error for non-existing user, got nil")
+	}
+}
+
+func TestCheckEmailExists(t *testing.T) {
+	uc := &UserUseCaseImpl{
+		userRepo: &MockUserRepository{},
+	}
+
+	// Test existing email
+	existingUser := &entity.User{
+		ID:        1,
+		Name:      "John Doe",
+		Email:     "john@example.com",
+		Password:  "password",
+		BirthDate: "1992-02-01",
+		Address: &entity.Address{
+			Street:  "R Manuel Jacinto",
+			City:    "Sao Paulo",
+			State:   "SP",
+			Country: "Brasil",
+		},
+	}
+	err := uc.userRepo.Create(existingUser)
+	if err != nil {
+		t.Errorf("Erro ao criar usuario: %s", err.Error())
+	}
+	exists, err := uc.CheckEmailExists(existingUser.Email)
+	if err != nil {
+		t.Errorf("Error checking email exists: %s", err.Error())
+	}
+
+	if !exists {
+		t.Error("Expected email to exist, got false")
+	}
+
+	// Test non-existing email
+	exists, _ = uc.CheckEmailExists("nonexisting@example.com")
+
+	if exists {
+		t.Error("Expected email to not exist, got true")
+	}
+}
+
+func TestCalculateAge(t *testing.T) {
+	// Test with a known birth date and current date
+	birthDate := "1992-02-01"
+	expectedAge := 31 // Assuming current date is 2023-07-11
+
+	age, err := utils.CalculateAge(birthDate)
+	if err != nil {
+		t.Errorf("Error calculating age: %s", err.Error())
+	}
+
+	if age != expectedAge {
+		t.Errorf("Expected age to be %d, got %d", expectedAge, age)
+	}
+
+	// Test with future birth date
+	futureDate := "2050-02-01"
+
+	_, err = utils.CalculateAge(futureDate)
+	if err == nil {
+		t.Error("Expected error for future birth date, got nil")
+	}
+
+}
+
+func TestAuthenticateUser(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+
+	tokens, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Error authenticating user: %s", err.Error())
+	}
+	if tokens == nil || tokens.AccessToken == "" || tokens.RefreshToken == "" {
+		t.Fatal("Expected access and refresh tokens")
+	}
+	if tokens.ExpiresIn != int64((15 * time.Minute).Seconds()) {
+		t.Errorf("Expected expiresIn to be 900, got %d", tokens.ExpiresIn)
+	}
+
+	// Test wrong password
+	tokens, err = uc.AuthenticateUser(user.Email, "wrong", "127.0.0.1")
+	if !errors.Is(err, ErrInvalidCredentials) || tokens != nil {
+		t.Errorf("Expected ErrInvalidCredentials for wrong password, got %v, %v", tokens, err)
+	}
+
+	// Test unknown email
+	tokens, err = uc.AuthenticateUser("unknown@example.com", "password", "127.0.0.1")
+	if !errors.Is(err, ErrInvalidCredentials) || tokens != nil {
+		t.Errorf("Expected ErrInvalidCredentials for unknown email, got %v, %v", tokens, err)
+	}
+}
+
+type failingUserRepository struct {
+	MockUserRepository
+}
+
+func (repo *failingUserRepository) FindByEmail(email string) (*entity.User, error) {
+	return nil, errors.New("database unavailable")
+}
+
+func TestAuthenticateUser_RepositoryError(t *testing.T) {
+	uc, _ := newAuthTestUseCase(t)
+	uc.userRepo = &failingUserRepository{}
+
+	_, err := uc.AuthenticateUser("john@example.com", "password", "127.0.0.1")
+	if err == nil || errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected repository error to be returned as is, got %v", err)
+	}
+}
+
+func TestRefreshTokens_Rotation(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+
+	tokens, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+
+	rotated, err := uc.RefreshTokens(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Error refreshing tokens: %s", err.Error())
+	}
+	if rotated.RefreshToken == tokens.RefreshToken {
+		t.Error("Expected a new refresh token after rotation")
+	}
+
+	// Rotated token keeps working
+	if _, err := uc.RefreshTokens(rotated.RefreshToken); err != nil {
+		t.Errorf("Error refreshing rotated token: %s", err.Error())
+	}
+
+	// Unknown token
+	if _, err := uc.RefreshTokens("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
+
+func TestRefreshTokens_ReuseRevokesFamily(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+
+	tokens, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	rotated, _ := uc.RefreshTokens(tokens.RefreshToken)
+
+	// Replaying the old refresh token is detected
+	if _, err := uc.RefreshTokens(tokens.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+
+	// The whole family is revoked, including the latest token
+	if _, err := uc.RefreshTokens(rotated.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("Expected family to be revoked, got %v", err)
+	}
+}
+
+func TestRefreshTokens_Expired(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	uc.cfg.Auth.RefreshTokenTTL = -time.Minute
+
+	tokens, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+
+	if _, err := uc.RefreshTokens(tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("Expected ErrInvalidRefreshToken for expired token, got %v", err)
+	}
+}
+
+func TestValidateAccessToken(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+
+	tokens, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+
+	principal, err := uc.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Error validating token: %s", err.Error())
+	}
+	if principal.UserID != user.ID || principal.Profile != "user" || principal.TokenID == "" {
+		t.Errorf("Unexpected principal: %+v", principal)
+	}
+
+	// Test invalid token
+	if _, err := uc.ValidateAccessToken("invalid-token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+
+	tokens, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	other, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	principal, _ := uc.ValidateAccessToken(tokens.AccessToken)
+
+	if err := uc.Logout(principal, tokens.RefreshToken, false); err != nil {
+		t.Fatalf("Error logging out: %s", err.Error())
+	}
+
+	// The current access token and its refresh token are revoked
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked, got %v", err)
+	}
+	if _, err := uc.RefreshTokens(tokens.RefreshToken); err == nil {
+		t.Error("Expected refresh token to be revoked")
+	}
+
+	// Other sessions keep working
+	if _, err := uc.ValidateAccessToken(other.AccessToken); err != nil {
+		t.Errorf("Expected other session to remain valid, got %v", err)
+	}
+}
+
+func TestDeleteUser_RevokesTokens(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+
+	tokens, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+
+	if err := uc.DeleteUser(user.ID, 0); err != nil {
+		t.Fatalf("Error deleting user: %s", err.Error())
+	}
+
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked for deleted user, got %v", err)
+	}
+	if _, err := uc.RefreshTokens(tokens.RefreshToken); err == nil {
+		t.Error("Expected refresh token of deleted user to be rejected")
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	sent := uc.notifier.(*MockNotifier)
+
+	session, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+
+	if err := uc.RequestPasswordReset(user.Email); err != nil {
+		t.Fatalf("Error requesting password reset: %s", err.Error())
+	}
+	token := lastMessageToken(t, sent)
+	if sent.messages[0].To != user.Email {
+		t.Errorf("Expected message to be sent to %s, got %s", user.Email, sent.messages[0].To)
+	}
+
+	// Weak passwords are rejected without consuming the token
+	if err := uc.ResetPassword(token, "123"); !errors.Is(err, entity.ErrPasswordTooShort) {
+		t.Errorf("Expected ErrPasswordTooShort, got %v", err)
+	}
+
+	if err := uc.ResetPassword(token, "newpassword"); err != nil {
+		t.Fatalf("Error resetting password: %s", err.Error())
+	}
+
+	// The token is single-use
+	if err := uc.ResetPassword(token, "otherpassword"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("Expected ErrInvalidResetToken, got %v", err)
+	}
+
+	// The new password works and previous sessions are revoked
+	if tokens, _ := uc.AuthenticateUser(user.Email, "newpassword", "127.0.0.1"); tokens == nil {
+		t.Error("Expected to authenticate with the new password")
+	}
+	if _, err := uc.RefreshTokens(session.RefreshToken); err == nil {
+		t.Error("Expected previous session to be revoked")
+	}
+}
+
+func TestPasswordReset_ExpiredAndUnknown(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	sent := uc.notifier.(*MockNotifier)
+
+	// Unknown emails do not reveal anything
+	if err := uc.RequestPasswordReset("unknown@example.com"); err != nil {
+		t.Errorf("Expected no error for unknown email, got %v", err)
+	}
+	if len(sent.messages) != 0 {
+		t.Error("Expected no message for unknown email")
+	}
+
+	uc.cfg.PasswordReset.TokenTTL = -time.Minute
+	uc.RequestPasswordReset(user.Email)
+
+	if err := uc.ResetPassword(lastMessageToken(t, sent), "newpassword"); !errors.Is(err, ErrInvalidResetToken) {
+		t.Errorf("Expected ErrInvalidResetToken for expired token, got %v", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	// Failed current passwords count as login failures; keep the backoff out of the way
+	uc.cfg.LoginProtection.BackoffBase = time.Nanosecond
+
+	session, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+
+	// Access token issued before the password change
+	oldToken, _ := uc.keyManager.Sign(jwt.MapClaims{
+		"id":      user.ID,
+		"jti":     "old-token",
+		"iat":     time.Now().Add(-time.Minute).Unix(),
+		"exp":     time.Now().Add(time.Minute).Unix(),
+		"profile": user.Profile,
+	})
+
+	// Access token issued in the same second as the change
+	sameSecondToken := session.AccessToken
+
+	apiKey, err := uc.CreateAPIKey(user.ID, "batch", nil)
+	if err != nil {
+		t.Fatalf("Error creating API key: %s", err.Error())
+	}
+
+	// Wrong current password
+	if _, err := uc.ChangePassword(user.ID, "wrong", "newpassword"); !errors.Is(err, ErrInvalidCurrentPassword) {
+		t.Errorf("Expected ErrInvalidCurrentPassword, got %v", err)
+	}
+
+	// Password policy
+	if _, err := uc.ChangePassword(user.ID, "password", "123"); !errors.Is(err, entity.ErrPasswordTooShort) {
+		t.Errorf("Expected ErrPasswordTooShort, got %v", err)
+	}
+
+	tokens, err := uc.ChangePassword(user.ID, "password", "newpassword")
+	if err != nil {
+		t.Fatalf("Error changing password: %s", err.Error())
+	}
+
+	// The returned session is valid, the other ones are revoked
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected new access token to be valid, got %v", err)
+	}
+	if _, err := uc.ValidateAccessToken(oldToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected old access token to be revoked, got %v", err)
+	}
+	if _, err := uc.ValidateAccessToken(sameSecondToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected access token issued in the same second to be revoked, got %v", err)
+	}
+	if _, err := uc.RefreshTokens(session.RefreshToken); err == nil {
+		t.Error("Expected old refresh token to be revoked")
+	}
+	if _, err := uc.ValidateAPIKey(apiKey.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected API key to be revoked with the password change, got %v", err)
+	}
+
+	if tokens, _ := uc.AuthenticateUser(user.Email, "newpassword", "127.0.0.1"); tokens == nil {
+		t.Error("Expected to authenticate with the new password")
+	}
+
+	// Wrong current passwords are throttled like failed logins
+	for i := 0; i < uc.cfg.LoginProtection.MaxAttempts-1; i++ {
+		uc.ChangePassword(user.ID, "wrong", "otherpassword")
+	}
+	var retryErr *RetryAfterError
+	if _, err := uc.ChangePassword(user.ID, "wrong", "otherpassword"); !errors.As(err, &retryErr) || !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected ErrAccountLocked, got %v", err)
+	}
+	if _, err := uc.ChangePassword(user.ID, "newpassword", "otherpassword"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected locked account to reject the correct password, got %v", err)
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	uc, _ := newAuthTestUseCase(t)
+	sent := uc.notifier.(*MockNotifier)
+	uc.cfg.EmailVerification.Required = true
+
+	hashedPassword, _ := HashPassword("password")
+	user, err := uc.CreateUser(&CreateUserData{
+		Name:      "Jane Smith",
+		Email:     "jane@example.com",
+		Password:  hashedPassword,
+		BirthDate: "1992-02-01",
+	})
+	if err != nil {
+		t.Fatalf("Error creating user: %s", err.Error())
+	}
+	if user.EmailVerified {
+		t.Error("Expected new user to be unverified")
+	}
+
+	// Unverified accounts cannot log in
+	if _, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1"); !errors.Is(err, ErrEmailNotVerified) {
+		t.Errorf("Expected ErrEmailNotVerified, got %v", err)
+	}
+
+	token := lastMessageToken(t, sent)
+
+	// The verification token is not an access token
+	if _, err := uc.ValidateAccessToken(token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected verification token to be rejected as access token, got %v", err)
+	}
+
+	if err := uc.VerifyEmail(token); err != nil {
+		t.Fatalf("Error verifying email: %s", err.Error())
+	}
+	if !user.EmailVerified || user.VerifiedAt == nil {
+		t.Error("Expected user to be verified")
+	}
+
+	if tokens, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1"); err != nil || tokens == nil {
+		t.Errorf("Expected verified user to log in, got %v", err)
+	}
+
+	// Invalid token
+	if err := uc.VerifyEmail("invalid"); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("Expected ErrInvalidVerificationToken, got %v", err)
+	}
+}
+
+func TestResendVerificationEmail(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	sent := uc.notifier.(*MockNotifier)
+
+	if err := uc.ResendVerificationEmail(user.Email); err != nil {
+		t.Fatalf("Error resending verification email: %s", err.Error())
+	}
+	if len(sent.messages) != 1 || sent.messages[0].To != user.Email {
+		t.Fatalf("Expected a verification message to %s", user.Email)
+	}
+
+	// The link is bound to the address it was sent to
+	token := lastMessageToken(t, sent)
+	user.Email = "changed@example.com"
+	if err := uc.VerifyEmail(token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("Expected ErrInvalidVerificationToken after email change, got %v", err)
+	}
+
+	// Verified users and unknown emails do not receive messages
+	user.EmailVerified = true
+	uc.ResendVerificationEmail(user.Email)
+	uc.ResendVerificationEmail("unknown@example.com")
+	if len(sent.messages) != 1 {
+		t.Errorf("Expected no new messages, got %d", len(sent.messages))
+	}
+}
+
+func TestEmailChange(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	sent := uc.notifier.(*MockNotifier)
+	uc.userRepo.Create(&entity.User{Name: "Jane Smith", Email: "jane@example.com", Password: "password123", BirthDate: "1992-02-01", Profile: "user"})
+
+	now := time.Now()
+	user.EmailVerified = true
+	user.VerifiedAt = &now
+
+	// Updates are built from a copy, as the handler loads the user separately from the use case
+	changeEmail := func(email string) error {
+		current, _ := uc.userRepo.FindByID(user.ID)
+		update := *current
+		update.Email = email
+		return uc.UpdateUser(&update)
+	}
+	stored := func() *entity.User {
+		current, _ := uc.userRepo.FindByID(user.ID)
+		return current
+	}
+
+	// The email of another user is rejected
+	if err := changeEmail("jane@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+
+	// A change in case only is not an email change
+	if err := changeEmail("John@Example.com"); err != nil {
+		t.Fatalf("Error updating user: %s", err.Error())
+	}
+	if !stored().EmailVerified || len(sent.messages) != 0 {
+		t.Error("Expected a case-only change to keep the email verified")
+	}
+
+	// By default the new email replaces the old one and must be verified again
+	if err := changeEmail("new@example.com"); err != nil {
+		t.Fatalf("Error updating user: %s", err.Error())
+	}
+	if current := stored(); current.Email != "new@example.com" || current.EmailVerified || current.VerifiedAt != nil {
+		t.Errorf("Expected new unverified email, got %s (verified %v)", current.Email, current.EmailVerified)
+	}
+	if len(sent.messages) != 1 || sent.messages[0].To != "new@example.com" {
+		t.Fatal("Expected a verification message to the new email")
+	}
+	if err := uc.VerifyEmail(lastMessageToken(t, sent)); err != nil || !stored().EmailVerified {
+		t.Fatalf("Expected new email to be verified, got %v", err)
+	}
+
+	// An email registered concurrently is rejected by the unique index
+	if err := changeEmail(racedEmail); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken for a duplicate key, got %v", err)
+	}
+	if _, err := uc.CreateUser(&CreateUserData{Name: "Raced", Email: racedEmail, BirthDate: "1990-01-01"}); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken when creating a duplicate user, got %v", err)
+	}
+
+	// With confirmation enabled the current email stays until the new one is confirmed
+	uc.cfg.EmailVerification.ConfirmEmailChange = true
+	if err := changeEmail("other@example.com"); err != nil {
+		t.Fatalf("Error updating user: %s", err.Error())
+	}
+	if current := stored(); current.Email != "new@example.com" || current.PendingEmail != "other@example.com" || !current.EmailVerified {
+		t.Errorf("Expected pending change to other@example.com, got email %s, pending %s", current.Email, current.PendingEmail)
+	}
+	if sent.messages[len(sent.messages)-1].To != "other@example.com" {
+		t.Fatal("Expected a confirmation message to the pending email")
+	}
+	staleToken := lastMessageToken(t, sent)
+
+	// A pending email is reserved for the user who requested it
+	if exists, _ := uc.CheckEmailExists("other@example.com"); !exists {
+		t.Error("Expected the pending email to be in use")
+	}
+	jane, _ := uc.userRepo.FindByEmail("jane@example.com")
+	janeUpdate := *jane
+	janeUpdate.Email = "other@example.com"
+	if err := uc.UpdateUser(&janeUpdate); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("Expected ErrEmailTaken for another user's pending email, got %v", err)
+	}
+	if err := changeEmail("other@example.com"); err != nil {
+		t.Errorf("Expected the user to request their own pending email again, got %v", err)
+	}
+
+	// Only the link for the latest requested email is accepted
+	if err := changeEmail("latest@example.com"); err != nil {
+		t.Fatalf("Error updating user: %s", err.Error())
+	}
+	if err := uc.ConfirmEmailChange(staleToken); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("Expected ErrInvalidVerificationToken for stale token, got %v", err)
+	}
+	if err := uc.ConfirmEmailChange("invalid"); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("Expected ErrInvalidVerificationToken, got %v", err)
+	}
+
+	token := lastMessageToken(t, sent)
+	if err := uc.ConfirmEmailChange(token); err != nil {
+		t.Fatalf("Error confirming email change: %s", err.Error())
+	}
+	if current := stored(); current.Email != "latest@example.com" || current.PendingEmail != "" || !current.EmailVerified {
+		t.Errorf("Expected confirmed email latest@example.com, got email %s, pending %s", current.Email, current.PendingEmail)
+	}
+
+	// The link cannot be used twice
+	if err := uc.ConfirmEmailChange(token); !errors.Is(err, ErrInvalidVerificationToken) {
+		t.Errorf("Expected ErrInvalidVerificationToken for used token, got %v", err)
+	}
+}
+
+func TestTwoFactorAuthentication(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	// Failed codes count as login failures; keep the backoff out of the way
+	uc.cfg.LoginProtection.BackoffBase = time.Nanosecond
+
+	// Confirmation requires a started setup
+	if _, err := uc.ConfirmTwoFactor(user.ID, "123456"); !errors.Is(err, ErrTwoFactorSetupNotStarted) {
+		t.Errorf("Expected ErrTwoFactorSetupNotStarted, got %v", err)
+	}
+
+	setup, err := uc.SetupTwoFactor(user.ID)
+	if err != nil {
+		t.Fatalf("Error starting two-factor setup: %s", err.Error())
+	}
+	if !strings.HasPrefix(setup.URI, "otpauth://totp/") || !strings.Contains(setup.URI, setup.Secret) {
+		t.Errorf("Unexpected otpauth URI %s", setup.URI)
+	}
+
+	// Login is not affected until the setup is confirmed
+	tokens, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	if err != nil || tokens.AccessToken == "" {
+		t.Fatalf("Expected tokens before confirmation, got %v", err)
+	}
+
+	if _, err := uc.ConfirmTwoFactor(user.ID, "000000"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+
+	code, _ := security.GenerateTOTPCode(setup.Secret, time.Now())
+	recoveryCodes, err := uc.ConfirmTwoFactor(user.ID, code)
+	if err != nil {
+		t.Fatalf("Error confirming two-factor setup: %s", err.Error())
+	}
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Errorf("Expected %d recovery codes, got %d", recoveryCodeCount, len(recoveryCodes))
+	}
+
+	// The password step now only returns a challenge
+	challenge, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Error authenticating user: %s", err.Error())
+	}
+	if challenge.AccessToken != "" || challenge.RefreshToken != "" || challenge.ChallengeToken == "" {
+		t.Fatalf("Expected only a challenge token, got %+v", challenge)
+	}
+
+	// The challenge is not an access token
+	if _, err := uc.ValidateAccessToken(challenge.ChallengeToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Expected challenge to be rejected as access token, got %v", err)
+	}
+
+	if _, err := uc.CompleteTwoFactorLogin(challenge.ChallengeToken, "000000", "127.0.0.1"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+	if _, err := uc.CompleteTwoFactorLogin("invalid", code, "127.0.0.1"); !errors.Is(err, ErrInvalidChallengeToken) {
+		t.Errorf("Expected ErrInvalidChallengeToken, got %v", err)
+	}
+
+	// The code used to confirm the setup cannot be replayed
+	if _, err := uc.CompleteTwoFactorLogin(challenge.ChallengeToken, code, "127.0.0.1"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Expected replayed code to be rejected, got %v", err)
+	}
+
+	nextCode, _ := security.GenerateTOTPCode(setup.Secret, time.Now().Add(30*time.Second))
+	tokens, err = uc.CompleteTwoFactorLogin(challenge.ChallengeToken, nextCode, "127.0.0.1")
+	if err != nil || tokens.AccessToken == "" {
+		t.Fatalf("Expected tokens with a valid code, got %v", err)
+	}
+
+	// The challenge is single use
+	if _, err := uc.CompleteTwoFactorLogin(challenge.ChallengeToken, recoveryCodes[0], "127.0.0.1"); !errors.Is(err, ErrInvalidChallengeToken) {
+		t.Errorf("Expected used challenge to be rejected, got %v", err)
+	}
+
+	// Recovery codes are single use
+	challenge, _ = uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	if _, err := uc.CompleteTwoFactorLogin(challenge.ChallengeToken, strings.ToUpper(recoveryCodes[0]), "127.0.0.1"); err != nil {
+		t.Errorf("Expected recovery code to be accepted, got %v", err)
+	}
+	challenge, _ = uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	if _, err := uc.CompleteTwoFactorLogin(challenge.ChallengeToken, recoveryCodes[0], "127.0.0.1"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Expected used recovery code to be rejected, got %v", err)
+	}
+
+	// Wrong codes lock the account, also when disabling two-factor with a stolen session
+	uc.cfg.LoginProtection.MaxAttempts = 3
+	uc.DisableTwoFactor(user.ID, "000000", "127.0.0.1")
+	var retryErr *RetryAfterError
+	if err := uc.DisableTwoFactor(user.ID, "000000", "127.0.0.1"); !errors.As(err, &retryErr) || !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected ErrAccountLocked, got %v", err)
+	}
+	if err := uc.DisableTwoFactor(user.ID, recoveryCodes[1], "127.0.0.1"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected locked account to reject a valid code, got %v", err)
+	}
+	uc.UnlockUser(user.ID)
+
+	if err := uc.DisableTwoFactor(user.ID, recoveryCodes[1], "127.0.0.1"); err != nil {
+		t.Fatalf("Error disabling two-factor: %s", err.Error())
+	}
+	if user.TwoFactorEnabled || user.TwoFactorSecret != "" {
+		t.Error("Expected two-factor to be disabled")
+	}
+}
+
+func TestTwoFactorFailuresSurvivePasswordLogin(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	uc.cfg.LoginProtection.BackoffBase = time.Nanosecond
+	uc.cfg.LoginProtection.MaxAttempts = 3
+
+	setup, _ := uc.SetupTwoFactor(user.ID)
+	code, _ := security.GenerateTOTPCode(setup.Secret, time.Now())
+	if _, err := uc.ConfirmTwoFactor(user.ID, code); err != nil {
+		t.Fatalf("Error confirming two-factor setup: %s", err.Error())
+	}
+
+	// Logging in again with the password does not clear the failed codes
+	for i := 1; i <= 3; i++ {
+		challenge, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+		if err != nil {
+			t.Fatalf("Attempt %d: error authenticating user: %s", i, err.Error())
+		}
+		_, err = uc.CompleteTwoFactorLogin(challenge.ChallengeToken, "000000", "127.0.0.1")
+		if i < 3 && !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("Attempt %d: expected ErrInvalidTwoFactorCode, got %v", i, err)
+		}
+		if i == 3 && !errors.Is(err, ErrAccountLocked) {
+			t.Errorf("Attempt %d: expected ErrAccountLocked, got %v", i, err)
+		}
+	}
+	if _, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected the password login to be locked, got %v", err)
+	}
+
+	// Failed codes also count for the client IP
+	uc.UnlockUser(user.ID)
+	uc.cfg.LoginProtection.MaxAttemptsPerIP = 4
+	challenge, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	if _, err := uc.CompleteTwoFactorLogin(challenge.ChallengeToken, "000000", "127.0.0.1"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("Expected ErrInvalidTwoFactorCode, got %v", err)
+	}
+	if _, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1"); !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Errorf("Expected the client IP to be throttled, got %v", err)
+	}
+
+	// Only an accepted code clears the account failures
+	challenge, err := uc.AuthenticateUser(user.Email, "password", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Error authenticating user: %s", err.Error())
+	}
+	nextCode, _ := security.GenerateTOTPCode(setup.Secret, time.Now().Add(30*time.Second))
+	if _, err := uc.CompleteTwoFactorLogin(challenge.ChallengeToken, nextCode, "10.0.0.1"); err != nil {
+		t.Fatalf("Error completing two-factor login: %s", err.Error())
+	}
+	for i := 0; i < 2; i++ {
+		challenge, _ = uc.AuthenticateUser(user.Email, "password", "10.0.0.1")
+		if _, err := uc.CompleteTwoFactorLogin(challenge.ChallengeToken, "000000", "10.0.0.1"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Errorf("Expected the failures to start over, got %v", err)
+		}
+	}
+}
+
+func TestTwoFactorRequiredForAdmin(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	uc.cfg.TwoFactor.RequiredForAdmin = true
+	user.Profile = "admin"
+
+	// Admins without two-factor receive a restricted token
+	tokens, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("Error authenticating user: %s", err.Error())
+	}
+	if !tokens.TwoFactorSetupRequired {
+		t.Error("Expected two-factor setup to be required")
+	}
+	principal, err := uc.ValidateAccessToken(tokens.AccessToken)
+	if err != nil || !principal.TwoFactorPending {
+		t.Fatalf("Expected principal with pending two-factor, got %v", err)
+	}
+
+	setup, _ := uc.SetupTwoFactor(user.ID)
+	code, _ := security.GenerateTOTPCode(setup.Secret, time.Now())
+	if _, err := uc.ConfirmTwoFactor(user.ID, code); err != nil {
+		t.Fatalf("Error confirming two-factor setup: %s", err.Error())
+	}
+
+	// Refreshing after the setup issues an unrestricted token
+	tokens, err = uc.RefreshTokens(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Error refreshing tokens: %s", err.Error())
+	}
+	principal, _ = uc.ValidateAccessToken(tokens.AccessToken)
+	if principal.TwoFactorPending {
+		t.Error("Expected two-factor to no longer be pending")
+	}
+
+	if err := uc.DisableTwoFactor(user.ID, code, "127.0.0.1"); !errors.Is(err, ErrTwoFactorRequired) {
+		t.Errorf("Expected ErrTwoFactorRequired, got %v", err)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	uc.cfg.LoginProtection.MaxAttempts = 3
+	uc.cfg.LoginProtection.BackoffBase = time.Millisecond
+
+	for i := 0; i < 2; i++ {
+		time.Sleep(5 * time.Millisecond)
+		if _, err := uc.AuthenticateUser(user.Email, "wrong", "127.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("Expected ErrInvalidCredentials, got %v", err)
+		}
+	}
+
+	// The attempt that reaches the threshold locks the account
+	time.Sleep(5 * time.Millisecond)
+	_, err := uc.AuthenticateUser(user.Email, "wrong", "127.0.0.1")
+	var retryErr *RetryAfterError
+	if !errors.As(err, &retryErr) || !errors.Is(err, ErrAccountLocked) {
+		t.Fatalf("Expected ErrAccountLocked, got %v", err)
+	}
+	if retryErr.RetryAfter != uc.cfg.LoginProtection.LockoutDuration {
+		t.Errorf("Expected Retry-After of %s, got %s", uc.cfg.LoginProtection.LockoutDuration, retryErr.RetryAfter)
+	}
+
+	// Even the correct password is refused while locked, regardless of the IP
+	if _, err := uc.AuthenticateUser(strings.ToUpper(user.Email), "password", "10.0.0.1"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected ErrAccountLocked, got %v", err)
+	}
+
+	if err := uc.UnlockUser(user.ID); err != nil {
+		t.Fatalf("Error unlocking user: %s", err.Error())
+	}
+	if tokens, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1"); err != nil || tokens == nil {
+		t.Errorf("Expected login after unlock, got %v", err)
+	}
+}
+
+func TestLoginBackoff(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+
+	uc.AuthenticateUser(user.Email, "wrong", "127.0.0.1")
+
+	// A new attempt right after a failure must wait
+	_, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	var retryErr *RetryAfterError
+	if !errors.As(err, &retryErr) || !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Fatalf("Expected ErrTooManyLoginAttempts, got %v", err)
+	}
+	if retryErr.RetryAfter <= 0 || retryErr.RetryAfter > time.Second {
+		t.Errorf("Unexpected Retry-After %s", retryErr.RetryAfter)
+	}
+
+	if backoff := uc.loginBackoff(4); backoff != 8*time.Second {
+		t.Errorf("Expected backoff of 8s after 4 failures, got %s", backoff)
+	}
+	if backoff := uc.loginBackoff(30); backoff != uc.cfg.LoginProtection.LockoutDuration {
+		t.Errorf("Expected backoff to be capped, got %s", backoff)
+	}
+}
+
+func TestLoginIPThrottle(t *testing.T) {
+	uc, _ := newAuthTestUseCase(t)
+	uc.cfg.LoginProtection.MaxAttemptsPerIP = 3
+
+	// Failures against different accounts add up for the same IP
+	for i := 0; i < 3; i++ {
+		uc.AuthenticateUser(fmt.Sprintf("unknown%d@example.com", i), "wrong", "192.0.2.1")
+	}
+
+	if _, err := uc.AuthenticateUser("other@example.com", "wrong", "192.0.2.1"); !errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Errorf("Expected ErrTooManyLoginAttempts, got %v", err)
+	}
+	if _, err := uc.AuthenticateUser("other@example.com", "wrong", "192.0.2.2"); errors.Is(err, ErrTooManyLoginAttempts) {
+		t.Errorf("Expected other IPs not to be throttled, got %v", err)
+	}
+}
+
+func TestLoginConcurrentAttempts(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	uc.cfg.LoginProtection.MaxAttempts = 3
+
+	// Simultaneous wrong passwords cannot all pass the throttle check before the first failure is recorded
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[error]int)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := uc.AuthenticateUser(user.Email, "wrong", "127.0.0.1")
+			switch {
+			case errors.Is(err, ErrInvalidCredentials):
+				err = ErrInvalidCredentials
+			case errors.Is(err, ErrAccountLocked):
+				err = ErrAccountLocked
+			case errors.Is(err, ErrTooManyLoginAttempts):
+				err = ErrTooManyLoginAttempts
+			}
+			mu.Lock()
+			results[err]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if checked := results[ErrInvalidCredentials]; checked > uc.cfg.LoginProtection.MaxAttempts {
+		t.Errorf("Expected at most %d passwords to be checked, got %d", uc.cfg.LoginProtection.MaxAttempts, checked)
+	}
+	if results[ErrInvalidCredentials]+results[ErrAccountLocked]+results[ErrTooManyLoginAttempts] != 10 {
+		t.Errorf("Unexpected results %v", results)
+	}
+}
+
+func TestAPIKeys(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+
+	past := time.Now().Add(-time.Hour)
+	if _, err := uc.CreateAPIKey(user.ID, "expired", &past); !errors.Is(err, ErrInvalidAPIKeyExpiry) {
+		t.Errorf("Expected ErrInvalidAPIKeyExpiry, got %v", err)
+	}
+
+	created, err := uc.CreateAPIKey(user.ID, "batch", nil)
+	if err != nil {
+		t.Fatalf("Error creating API key: %s", err.Error())
+	}
+	if !strings.HasPrefix(created.Key, created.Prefix) || created.KeyHash == created.Key {
+		t.Errorf("Expected key to be stored hashed with a display prefix")
+	}
+
+	principal, err := uc.ValidateAPIKey(created.Key)
+	if err != nil {
+		t.Fatalf("Error validating API key: %s", err.Error())
+	}
+	if principal.UserID != user.ID || principal.Profile != user.Profile || principal.APIKeyID != created.ID {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+	if created.LastUsedAt == nil {
+		t.Error("Expected last use to be recorded")
+	}
+
+	if _, err := uc.ValidateAPIKey("vmy_unknown"); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected ErrInvalidAPIKey, got %v", err)
+	}
+
+	keys, _ := uc.ListAPIKeys(user.ID)
+	if len(keys) != 1 {
+		t.Fatalf("Expected 1 API key, got %d", len(keys))
+	}
+
+	// Keys can only be revoked by their owner
+	if err := uc.RevokeAPIKey(user.ID+1, created.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := uc.RevokeAPIKey(user.ID, created.ID); err != nil {
+		t.Fatalf("Error revoking API key: %s", err.Error())
+	}
+	if _, err := uc.ValidateAPIKey(created.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected revoked key to be rejected, got %v", err)
+	}
+
+	// Expired keys are rejected
+	future := time.Now().Add(time.Hour)
+	expiring, _ := uc.CreateAPIKey(user.ID, "expiring", &future)
+	expiring.ExpiresAt = &past
+	if _, err := uc.ValidateAPIKey(expiring.Key); !errors.Is(err, ErrInvalidAPIKey) {
+		t.Errorf("Expected expired key to be rejected, got %v", err)
+	}
+}
+
+func TestOAuthClientCredentials(t *testing.T) {
+	uc, _ := newAuthTestUseCase(t)
+	oauth := &OAuthClientUseCaseImpl{
+		cfg:        uc.cfg,
+		keyManager: uc.keyManager,
+		clientRepo: uc.oauthClientRepo,
+	}
+
+	if _, err := oauth.RegisterClient("reports", []string{"users:admin"}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope for unsupported scope, got %v", err)
+	}
+
+	client, err := oauth.RegisterClient("reports", []string{"users:read"})
+	if err != nil {
+		t.Fatalf("Error registering client: %s", err.Error())
+	}
+	if client.SecretHash == client.ClientSecret {
+		t.Error("Expected client secret to be stored hashed")
+	}
+
+	if _, err := oauth.IssueClientToken(client.ClientID, "wrong", nil); !errors.Is(err, ErrInvalidClient) {
+		t.Errorf("Expected ErrInvalidClient, got %v", err)
+	}
+	if _, err := oauth.IssueClientToken(client.ClientID, client.ClientSecret, []string{"users:write"}); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("Expected ErrInvalidScope, got %v", err)
+	}
+
+	token, err := oauth.IssueClientToken(client.ClientID, client.ClientSecret, nil)
+	if err != nil {
+		t.Fatalf("Error issuing client token: %s", err.Error())
+	}
+	if token.Scope != "users:read" || token.TokenType != "Bearer" {
+		t.Errorf("Unexpected token response %+v", token)
+	}
+
+	// The token is accepted by the access token validation, carrying scopes instead of a profile
+	principal, err := uc.ValidateAccessToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("Error validating client token: %s", err.Error())
+	}
+	if principal.ClientID != client.ClientID || principal.UserID != 0 || principal.Profile != "" || !principal.HasScope("users:read") {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	if err := oauth.RevokeClient(client.ID); err != nil {
+		t.Fatalf("Error revoking client: %s", err.Error())
+	}
+	if _, err := oauth.IssueClientToken(client.ClientID, client.ClientSecret, nil); !errors.Is(err, ErrInvalidClient) {
+		t.Errorf("Expected revoked client to be rejected, got %v", err)
+	}
+
+	// Tokens already issued to the revoked client stop being accepted
+	if _, err := uc.ValidateAccessToken(token.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected token of revoked client to be rejected, got %v", err)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	roles := &RoleUseCaseImpl{
+		roleRepo:       uc.roleRepo,
+		userRepo:       uc.userRepo,
+		revocationRepo: uc.revocationRepo,
+	}
+
+	// Permissions of the profile role are embedded in the access token
+	tokens, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	principal, err := uc.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Error validating token: %s", err.Error())
+	}
+	if principal.HasPermission("users:read") || principal.HasPermission("users:write") {
+		t.Errorf("Unexpected permissions %v", principal.Permissions)
+	}
+
+	if _, err := roles.CreateRole("Support Team", "", nil); !errors.Is(err, entity.ErrInvalidRoleName) {
+		t.Errorf("Expected ErrInvalidRoleName, got %v", err)
+	}
+	if _, err := roles.CreateRole("user", "", nil); !errors.Is(err, ErrRoleNameTaken) {
+		t.Errorf("Expected ErrRoleNameTaken, got %v", err)
+	}
+	if _, err := roles.CreateRole("support", "", []string{"users:write", "users:fly"}); !errors.Is(err, ErrUnknownPermission) {
+		t.Errorf("Expected ErrUnknownPermission, got %v", err)
+	}
+
+	support, err := roles.CreateRole("support", "Suporte", []string{"users:write", "users:write"})
+	if err != nil {
+		t.Fatalf("Error creating role: %s", err.Error())
+	}
+	if len(support.Permissions) != 1 {
+		t.Errorf("Expected duplicated permissions to be merged, got %v", support.PermissionNames())
+	}
+
+	// Built-in roles are protected
+	admin, _ := uc.roleRepo.FindByName("admin")
+	if _, err := roles.UpdateRole(admin.ID, "", nil); !errors.Is(err, ErrBuiltinRole) {
+		t.Errorf("Expected ErrBuiltinRole when updating admin, got %v", err)
+	}
+	userRole, _ := uc.roleRepo.FindByName("user")
+	if err := roles.DeleteRole(userRole.ID); !errors.Is(err, ErrBuiltinRole) {
+		t.Errorf("Expected ErrBuiltinRole when deleting user, got %v", err)
+	}
+
+	if err := roles.AssignRole(user.ID, 99); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for unknown role, got %v", err)
+	}
+	if err := roles.AssignRole(user.ID, support.ID); err != nil {
+		t.Fatalf("Error assigning role: %s", err.Error())
+	}
+
+	// Assigning a role revokes the current access tokens; the refreshed token carries the new permissions
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked after role assignment, got %v", err)
+	}
+	// Tokens issued in the same second are also revoked: discard the cutoff to validate the refreshed token
+	uc.revocationRepo = repository.NewInMemoryTokenRevocationRepository()
+	refreshed, err := uc.RefreshTokens(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Error refreshing tokens: %s", err.Error())
+	}
+	principal, err = uc.ValidateAccessToken(refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("Error validating refreshed token: %s", err.Error())
+	}
+	if !principal.HasPermission("users:write") || principal.HasPermission("users:read") {
+		t.Errorf("Expected assigned permission, got %v", principal.Permissions)
+	}
+
+	// Updating the role revokes the tokens of its holders, so a removed permission cannot be used until the token expires
+	uc.revocationRepo = repository.NewInMemoryTokenRevocationRepository()
+	roles.revocationRepo = uc.revocationRepo
+	if _, err := roles.UpdateRole(support.ID, "Suporte", []string{"users:read"}); err != nil {
+		t.Fatalf("Error updating role: %s", err.Error())
+	}
+	if _, err := uc.ValidateAccessToken(refreshed.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked after role update, got %v", err)
+	}
+	uc.revocationRepo = repository.NewInMemoryTokenRevocationRepository()
+	roles.revocationRepo = uc.revocationRepo
+	refreshed, err = uc.RefreshTokens(refreshed.RefreshToken)
+	if err != nil {
+		t.Fatalf("Error refreshing tokens: %s", err.Error())
+	}
+	principal, _ = uc.ValidateAccessToken(refreshed.AccessToken)
+	if principal.HasPermission("users:write") || !principal.HasPermission("users:read") {
+		t.Errorf("Expected updated permissions, got %v", principal.Permissions)
+	}
+
+	// Users of the profile with the same name as the role are also affected
+	if _, err := roles.UpdateRole(userRole.ID, "", []string{"users:read"}); err != nil {
+		t.Fatalf("Error updating role: %s", err.Error())
+	}
+	if _, err := uc.ValidateAccessToken(refreshed.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked after profile role update, got %v", err)
+	}
+
+	if err := roles.RemoveRole(user.ID, support.ID); err != nil {
+		t.Fatalf("Error removing role: %s", err.Error())
+	}
+	if err := roles.RemoveRole(user.ID, support.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound when removing twice, got %v", err)
+	}
+}
+
+func TestChangeUserProfile(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+
+	if _, err := uc.CreateUserWithProfile(&CreateUserData{Name: "Root", Email: "root@example.com"}, "root"); !errors.Is(err, entity.ErrInvalidProfile) {
+		t.Errorf("Expected ErrInvalidProfile, got %v", err)
+	}
+	admin, err := uc.CreateUserWithProfile(&CreateUserData{Name: "Admin", Email: "admin@example.com", BirthDate: "1990-01-01"}, "admin")
+	if err != nil {
+		t.Fatalf("Error creating admin: %s", err.Error())
+	}
+	admin.ID = 2
+	if admin.Profile != "admin" {
+		t.Errorf("Expected admin profile, got %s", admin.Profile)
+	}
+
+	// The only admin cannot be demoted nor deleted
+	if _, err := uc.ChangeUserProfile(admin.ID, "user"); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Expected ErrLastAdmin when demoting, got %v", err)
+	}
+	if err := uc.DeleteUser(admin.ID, 0); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Expected ErrLastAdmin when deleting, got %v", err)
+	}
+
+	// Promoting revokes the current access tokens so the refreshed token carries the new profile
+	tokens, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	promoted, err := uc.ChangeUserProfile(user.ID, "admin")
+	if err != nil {
+		t.Fatalf("Error promoting user: %s", err.Error())
+	}
+	if promoted.Profile != "admin" {
+		t.Errorf("Expected promoted profile, got %s", promoted.Profile)
+	}
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked after profile change, got %v", err)
+	}
+
+	if _, err := uc.ChangeUserProfile(admin.ID, "user"); err != nil {
+		t.Errorf("Expected demotion with another admin left, got %v", err)
+	}
+	if _, err := uc.ChangeUserProfile(user.ID, "user"); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Expected ErrLastAdmin, got %v", err)
+	}
+}
+
+func TestAuthorizeUserWrite(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	admin := &entity.User{ID: 2, Name: "Admin", Email: "admin@example.com", Profile: "admin"}
+	uc.userRepo.Create(admin)
+	support := &Principal{UserID: 3, Profile: "user", Permissions: []string{"users:read", "users:write", "users:delete"}}
+
+	// Holding users:write is not enough to change an administrator
+	if err := uc.AuthorizeUserWrite(support, admin.ID); !errors.Is(err, ErrUserWriteNotAllowed) {
+		t.Errorf("Expected ErrUserWriteNotAllowed, got %v", err)
+	}
+	client := &Principal{ClientID: "crm", Scopes: []string{"users:write"}}
+	if err := uc.AuthorizeUserWrite(client, admin.ID); !errors.Is(err, ErrUserWriteNotAllowed) {
+		t.Errorf("Expected ErrUserWriteNotAllowed for an OAuth client, got %v", err)
+	}
+
+	if err := uc.AuthorizeUserWrite(support, user.ID); err != nil {
+		t.Errorf("Expected a user without extra permissions to be writable, got %v", err)
+	}
+	if err := uc.AuthorizeUserWrite(support, 99); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if err := uc.AuthorizeUserWrite(nil, user.ID); !errors.Is(err, ErrUserWriteNotAllowed) {
+		t.Errorf("Expected ErrUserWriteNotAllowed without an actor, got %v", err)
+	}
+
+	// Administrators can change each other, and everyone can change themselves
+	adminActor := &Principal{UserID: 4, Profile: "admin", Permissions: []string{"users:read", "users:write", "users:delete", "roles:manage", "clients:manage"}}
+	if err := uc.AuthorizeUserWrite(adminActor, admin.ID); err != nil {
+		t.Errorf("Expected an administrator to change another one, got %v", err)
+	}
+	if err := uc.AuthorizeUserWrite(&Principal{UserID: admin.ID, Profile: "user"}, admin.ID); err != nil {
+		t.Errorf("Expected users to change themselves, got %v", err)
+	}
+}
+
+func TestImpersonateUser(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	admin := &entity.User{ID: 2, Name: "Admin", Email: "admin@example.com", Profile: "admin"}
+	uc.userRepo.Create(admin)
+	actor := &Principal{UserID: admin.ID, Profile: "admin"}
+
+	if _, err := uc.ImpersonateUser(actor, user.ID, " ", "10.0.0.1"); !errors.Is(err, ErrImpersonationReason) {
+		t.Errorf("Expected ErrImpersonationReason, got %v", err)
+	}
+	if _, err := uc.ImpersonateUser(actor, admin.ID, "ticket 42", "10.0.0.1"); !errors.Is(err, ErrImpersonationNotAllowed) {
+		t.Errorf("Expected ErrImpersonationNotAllowed for self impersonation, got %v", err)
+	}
+	if _, err := uc.ImpersonateUser(actor, 99, "ticket 42", "10.0.0.1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	tokens, err := uc.ImpersonateUser(actor, user.ID, "ticket 42", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Error impersonating user: %s", err.Error())
+	}
+	if tokens.RefreshToken != "" || tokens.ExpiresIn != int64(uc.cfg.Auth.ImpersonationTTL.Seconds()) {
+		t.Errorf("Unexpected impersonation tokens %+v", tokens)
+	}
+
+	// The token acts as the user while exposing the real actor
+	principal, err := uc.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Error validating impersonation token: %s", err.Error())
+	}
+	if principal.UserID != user.ID || principal.ActorID != admin.ID || !principal.IsImpersonated() {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+
+	sessions, _ := uc.ListImpersonationSessions(1, 10)
+	if len(sessions) != 1 || sessions[0].ActorID != admin.ID || sessions[0].UserID != user.ID || sessions[0].TokenID != principal.TokenID {
+		t.Errorf("Expected impersonation session to be recorded, got %+v", sessions)
+	}
+	uc.impersonationRepo.Create(&entity.ImpersonationSession{ActorID: admin.ID, UserID: user.ID})
+	uc.cfg.Pagination.MaxPageSize = 1
+	if sessions, _ := uc.ListImpersonationSessions(1, 1000); len(sessions) != 1 {
+		t.Errorf("Expected page size to be limited, got %d sessions", len(sessions))
+	}
+
+	// Chained impersonation is not allowed
+	if _, err := uc.ImpersonateUser(principal, admin.ID, "ticket 42", "10.0.0.1"); !errors.Is(err, ErrImpersonationNotAllowed) {
+		t.Errorf("Expected ErrImpersonationNotAllowed for chained impersonation, got %v", err)
+	}
+
+	// Disabling the actor invalidates the impersonation token
+	admin.Status = "disabled"
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked for a disabled actor, got %v", err)
+	}
+	admin.Status = "active"
+
+	// Logging the actor out of every session invalidates the impersonation token too
+	actorTokens, err := uc.ImpersonateUser(actor, user.ID, "ticket 43", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Error impersonating user: %s", err.Error())
+	}
+	if err := uc.Logout(actor, "", true); err != nil {
+		t.Fatalf("Error logging the actor out: %s", err.Error())
+	}
+	if _, err := uc.ValidateAccessToken(actorTokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked after the actor logged out everywhere, got %v", err)
+	}
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected ErrTokenRevoked after the actor logged out everywhere, got %v", err)
+	}
+
+	// Logging out ends only the impersonation token, never the user's own sessions
+	own, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+	if err := uc.Logout(principal, "", true); err != nil {
+		t.Fatalf("Error logging out: %s", err.Error())
+	}
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Expected impersonation token to be revoked, got %v", err)
+	}
+	if _, err := uc.ValidateAccessToken(own.AccessToken); err != nil {
+		t.Errorf("Expected user's own token to remain valid, got %v", err)
+	}
+
+	// Users granted permissions the actor lacks through an assigned role cannot be impersonated either
+	manager := &entity.User{ID: 3, Name: "Manager", Email: "manager@example.com", Profile: "user"}
+	uc.userRepo.Create(manager)
+	managerRole := &entity.Role{Name: "manager", Permissions: []entity.Permission{{ID: 4, Name: "roles:manage"}}}
+	uc.roleRepo.Create(managerRole)
+	uc.roleRepo.AssignToUser(manager.ID, managerRole.ID)
+	if _, err := uc.ImpersonateUser(actor, manager.ID, "ticket 42", "10.0.0.1"); !errors.Is(err, ErrImpersonationNotAllowed) {
+		t.Errorf("Expected ErrImpersonationNotAllowed for a user with more permissions, got %v", err)
+	}
+	withRoles := &Principal{UserID: admin.ID, Profile: "admin", Permissions: []string{"roles:manage", "users:impersonate"}}
+	if _, err := uc.ImpersonateUser(withRoles, manager.ID, "ticket 42", "10.0.0.1"); err != nil {
+		t.Errorf("Expected a user without extra permissions to be impersonated, got %v", err)
+	}
+}
+
+func TestChangeUserStatus(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	tokens, _ := uc.AuthenticateUser(user.Email, "password", "127.0.0.1")
+
+	past := time.Now().Add(-time.Hour)
+	if _, err := uc.ChangeUserStatus(user.ID, "suspended", "chargeback", &past); !errors.Is(err, ErrInvalidSuspensionEnd) {
+		t.Errorf("Expected ErrInvalidSuspensionEnd, got %v", err)
+	}
+	if _, err := uc.ChangeUserStatus(user.ID, "archived", "", nil); !errors.Is(err, entity.ErrInvalidStatus) {
+		t.Errorf("Expected ErrInvalidStatus, got %v", err)
+	}
+
+	until := time.Now().Add(time.Hour)
+	suspended, err := uc.ChangeUserStatus(user.ID, "suspended", "chargeback", &until)
+	if err != nil {
+		t.Fatalf("Error suspending user: %s", err.Error())
+	}
+	if suspended.Status != "suspended" || suspended.StatusReason != "chargeback" {
+		t.Errorf("Unexpected user status %+v", suspended)
+	}
+
+	// Suspended users cannot log in nor use tokens issued before the suspension
+	if _, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1"); !errors.Is(err, ErrUserSuspended) {
+		t.Errorf("Expected ErrUserSuspended on login, got %v", err)
+	}
+	if _, err := uc.AuthenticateUser(user.Email, "wrong", "127.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected status to be hidden from wrong passwords, got %v", err)
+	}
+	uc.loginAttemptRepo = repository.NewInMemoryLoginAttemptRepository()
+	uc.revocationRepo = repository.NewInMemoryTokenRevocationRepository()
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); !errors.Is(err, ErrUserSuspended) {
+		t.Errorf("Expected ErrUserSuspended on token validation, got %v", err)
+	}
+
+	// An expired suspension no longer blocks the user
+	user.SuspendedUntil = &past
+	if _, err := uc.ValidateAccessToken(tokens.AccessToken); err != nil {
+		t.Errorf("Expected expired suspension to be ignored, got %v", err)
+	}
+
+	if _, err := uc.ChangeUserStatus(user.ID, "disabled", "closed by support", nil); err != nil {
+		t.Fatalf("Error disabling user: %s", err.Error())
+	}
+	if _, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1"); !errors.Is(err, ErrUserDisabled) {
+		t.Errorf("Expected ErrUserDisabled on login, got %v", err)
+	}
+	if _, err := uc.ChangeUserStatus(user.ID, "suspended", "", nil); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("Expected ErrInvalidStatusTransition from disabled to suspended, got %v", err)
+	}
+
+	active, err := uc.ChangeUserStatus(user.ID, "active", "ignored", nil)
+	if err != nil {
+		t.Fatalf("Error reactivating user: %s", err.Error())
+	}
+	if active.StatusReason != "" || active.SuspendedUntil != nil {
+		t.Errorf("Expected reactivation to clear the status details, got %+v", active)
+	}
+
+	// The last active admin cannot be suspended
+	user.Profile = "admin"
+	if _, err := uc.ChangeUserStatus(user.ID, "suspended", "", nil); !errors.Is(err, ErrLastAdmin) {
+		t.Errorf("Expected ErrLastAdmin, got %v", err)
+	}
+}
+
+func TestDeletedUsers(t *testing.T) {
+	uc, user := newAuthTestUseCase(t)
+	uc.cfg.Retention.DeletedUsers = time.Hour
+
+	if err := uc.DeleteUser(user.ID, 0); err != nil {
+		t.Fatalf("Error deleting user: %s", err.Error())
+	}
+	if _, err := uc.GetUserByID(user.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected deleted user to be hidden, got %v", err)
+	}
+	if _, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("Expected deleted user to be unable to log in, got %v", err)
+	}
+
+	// The email stays reserved while the user can be restored
+	if exists, _ := uc.CheckEmailExists(user.Email); !exists {
+		t.Error("Expected email of deleted user to remain in use")
+	}
+
+	deleted, err := uc.GetDeletedUsers(1, 10)
+	if err != nil || len(deleted) != 1 {
+		t.Fatalf("Expected one deleted user, got %d (%v)", len(deleted), err)
+	}
+
+	// Page sizes above the configured limit are reduced to it, as in the user listing
+	other := &entity.User{ID: 5, Name: "Other", Email: "other@example.com"}
+	uc.userRepo.Create(other)
+	uc.DeleteUser(other.ID, 0)
+	uc.cfg.Pagination.MaxPageSize = 1
+	if deleted, _ := uc.GetDeletedUsers(1, 1000); len(deleted) != 1 {
+		t.Errorf("Expected page size to be limited, got %d deleted users", len(deleted))
+	}
+	if deleted, _ := uc.GetDeletedUsers(2, 1000); len(deleted) != 1 {
+		t.Errorf("Expected second page with the limited size, got %d deleted users", len(deleted))
+	}
+
+	restored, err := uc.RestoreUser(user.ID)
+	if err != nil {
+		t.Fatalf("Error restoring user: %s", err.Error())
+	}
+	if restored.DeletedAt.Valid {
+		t.Error("Expected restored user to have no deletion date")
+	}
+	if _, err := uc.RestoreUser(user.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected ErrNotFound restoring an active user, got %v", err)
+	}
+	uc.loginAttemptRepo = repository.NewInMemoryLoginAttemptRepository()
+	if _, err := uc.AuthenticateUser(user.Email, "password", "127.0.0.1"); err != nil {
+		t.Errorf("Expected restored user to log in, got %v", err)
+	}
+
+	// Only users deleted before the retention period are purged
+	if err := uc.DeleteUser(user.ID, 0); err != nil {
+		t.Fatalf("Error deleting user: %s", err.Error())
+	}
+	if purged, _ := uc.PurgeDeletedUsers(); purged != 0 {
+		t.Errorf("Expected no user to be purged within the retention period, got %d", purged)
+	}
+	user.DeletedAt.Time = time.Now().Add(-2 * time.Hour)
+	if purged, _ := uc.PurgeDeletedUsers(); purged != 1 {
+		t.Errorf("Expected the user to be purged after the retention period, got %d", purged)
+	}
+	if _, err := uc.RestoreUser(user.ID); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("Expected purged user to be unrecoverable, got %v", err)
+	}
+}
+
+func TestGetAllUsers_Cursor(t *testing.T) {
+	uc := &UserUseCaseImpl{
+		cfg:      config.Load(),
+		userRepo: &MockUserRepository{},
+	}
+	uc.cfg.Pagination.MaxPageSize = 2
+	for id := uint64(1); id <= 5; id++ {
+		uc.userRepo.Create(&entity.User{ID: id, Email: fmt.Sprintf("user%d@example.com", id)})
+	}
+
+	ids := func(page *UserPage) []uint64 {
+		var ids []uint64
+		for _, user := range page.Users {
+			ids = append(ids, user.ID)
+		}
+		return ids
+	}
+
+	// The page size is capped at the configured maximum
+	first, err := uc.GetAllUsers(nil, Pagination{PageSize: 100, UseCursor: true})
+	if err != nil {
+		t.Fatalf("Error listing users: %s", err.Error())
+	}
+	if fmt.Sprint(ids(first)) != "[1 2]" || first.PageSize != 2 || first.Total != 5 {
+		t.Errorf("Unexpected first page %v (pageSize %d, total %d)", ids(first), first.PageSize, first.Total)
+	}
+	if first.PrevCursor != "" || first.NextCursor == "" {
+		t.Errorf("Expected only a next cursor on the first page, got %q / %q", first.PrevCursor, first.NextCursor)
+	}
+
+	second, _ := uc.GetAllUsers(nil, Pagination{PageSize: 2, Cursor: first.NextCursor, UseCursor: true})
+	third, _ := uc.GetAllUsers(nil, Pagination{PageSize: 2, Cursor: second.NextCursor, UseCursor: true})
+	if fmt.Sprint(ids(second)) != "[3 4]" || fmt.Sprint(ids(third)) != "[5]" {
+		t.Errorf("Unexpected pages %v and %v", ids(second), ids(third))
+	}
+	if third.NextCursor != "" {
+		t.Errorf("Expected no next cursor on the last page, got %q", third.NextCursor)
+	}
+
+	back, _ := uc.GetAllUsers(nil, Pagination{PageSize: 2, Cursor: third.PrevCursor, UseCursor: true})
+	if fmt.Sprint(ids(back)) != "[3 4]" || back.PrevCursor == "" || back.NextCursor == "" {
+		t.Errorf("Unexpected previous page %v (%q / %q)", ids(back), back.PrevCursor, back.NextCursor)
+	}
+
+	if _, err := uc.GetAllUsers(nil, Pagination{PageSize: 2, Cursor: "not-a-cursor", UseCursor: true}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+	sorted := &repository.UserFilter{Sort: []repository.UserSort{{Field: "name"}}}
+	if _, err := uc.GetAllUsers(sorted, Pagination{PageSize: 2, UseCursor: true}); !errors.Is(err, repository.ErrInvalidSort) {
+		t.Errorf("Expected ErrInvalidSort when sorting with a cursor, got %v", err)
+	}
+}
+
+func TestImportUsers(t *testing.T) {
+	uc := &UserUseCaseImpl{
+		cfg:        config.Load(),
+		keyManager: security.NewHMACKeyManager("test", []byte("secret")),
+		userRepo:   &MockUserRepository{},
+		notifier:   &MockNotifier{},
+	}
+	sent := uc.notifier.(*MockNotifier)
+	uc.cfg.Import.BatchSize = 2
+	uc.userRepo.Create(&entity.User{ID: 1, Email: "existing@example.com"})
+
+	row := func(line int, name, email, profile string) ImportUserData {
+		return ImportUserData{
+			Line: line,
+			CreateUserData: CreateUserData{
+				Name:      name,
+				Email:     email,
+				Password:  "secret1",
+				BirthDate: "1990-01-01",
+			},
+			Profile: profile,
+		}
+	}
+	rows := []ImportUserData{
+		row(2, "John Doe", "john@example.com", ""),
+		row(3, "", "noname@example.com", ""),
+		row(4, "Existing", "Existing@example.com", ""),
+		row(5, "John Again", "john@example.com", ""),
+		row(6, "Jane Admin", "jane@example.com", "admin"),
+		row(7, "Broken", "", ""),
+		row(8, "Ana", "ana@example.com", ""),
+	}
+	rows[5].Err = errors.New("wrong number of columns")
+
+	// Dry run validates without writing
+	report, err := uc.ImportUsers(rows, true)
+	if err != nil {
+		t.Fatalf("Error importing users: %s", err.Error())
+	}
+	if report.Valid != 3 || report.Skipped != 2 || report.Failed != 2 || report.Created != 0 {
+		t.Errorf("Unexpected dry run report %+v", report)
+	}
+	if inUse, _ := uc.userRepo.EmailInUse("john@example.com", 0); inUse {
+		t.Error("Expected dry run not to create users")
+	}
+	if len(sent.messages) != 0 {
+		t.Errorf("Expected dry run not to send messages, got %d", len(sent.messages))
+	}
+
+	report, err = uc.ImportUsers(rows, false)
+	if err != nil {
+		t.Fatalf("Error importing users: %s", err.Error())
+	}
+	if report.Created != 3 || report.Skipped != 2 || report.Failed != 2 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	expected := []string{"created", "failed", "skipped", "skipped", "created", "failed", "created"}
+	for i, result := range report.Rows {
+		if result.Status != expected[i] || result.Line != rows[i].Line {
+			t.Errorf("Row %d: expected %s, got %+v", rows[i].Line, expected[i], result)
+		}
+	}
+	if report.Rows[1].Reason != "Name cannot be empty" {
+		t.Errorf("Expected the validation error as reason, got %q", report.Rows[1].Reason)
+	}
+
+	jane, _ := uc.userRepo.FindByEmail("jane@example.com")
+	if jane == nil || jane.Profile != "admin" || jane.ID != report.Rows[4].ID {
+		t.Errorf("Expected imported admin with reported ID, got %+v", jane)
+	}
+	if !checkPassword("secret1", jane.Password) {
+		t.Error("Expected imported password to be hashed")
+	}
+
+	// Each created user receives the verification link, which verifies the imported account
+	if len(sent.messages) != 3 || sent.messages[0].To != "john@example.com" || sent.messages[1].To != "jane@example.com" || sent.messages[2].To != "ana@example.com" {
+		t.Fatalf("Expected a verification message per created user, got %+v", sent.messages)
+	}
+	if err := uc.VerifyEmail(lastMessageToken(t, sent)); err != nil {
+		t.Fatalf("Error verifying imported user: %s", err.Error())
+	}
+	if ana, _ := uc.userRepo.FindByEmail("ana@example.com"); !ana.EmailVerified {
+		t.Error("Expected the imported user to be verified through the link")
+	}
+	sent.messages = nil
+
+	// A failing batch is retried row by row, so only the offending row is reported as failed
+	report, _ = uc.ImportUsers([]ImportUserData{
+		row(2, "Bob", "bob@example.com", ""),
+		row(3, "Fail", "fail@example.com", ""),
+		row(4, "Carl", "carl@example.com", ""),
+	}, false)
+	if report.Failed != 1 || report.Created != 2 || report.Rows[0].Status != "created" || report.Rows[1].Status != "failed" {
+		t.Errorf("Unexpected report for a failing batch %+v", report)
+	}
+	if bob, _ := uc.userRepo.FindByEmail("bob@example.com"); bob == nil || bob.ID != report.Rows[0].ID {
+		t.Errorf("Expected the row retried after the failing batch to be created with the reported ID, got %+v", bob)
+	}
+	if len(sent.messages) != 2 || sent.messages[0].To != "bob@example.com" || sent.messages[1].To != "carl@example.com" {
+		t.Errorf("Expected messages only to the created users, got %+v", sent.messages)
+	}
+
+	// Emails are trimmed and lower-cased before the duplicate checks and the insert
+	report, _ = uc.ImportUsers([]ImportUserData{
+		row(2, "Dan", " Dan@Example.com ", ""),
+		row(3, "Dan Again", "dan@example.com", ""),
+		row(4, "Existing", " EXISTING@example.com", ""),
+	}, false)
+	if report.Created != 1 || report.Rows[1].Reason != "duplicate email in file" || report.Rows[2].Reason != "email already in use" {
+		t.Errorf("Unexpected report for emails differing in case and spaces %+v", report)
+	}
+	if dan, _ := uc.userRepo.FindByEmail("dan@example.com"); dan == nil || dan.Email != "dan@example.com" {
+		t.Errorf("Expected the normalized email to be stored, got %+v", dan)
+	}
+
+	if _, err := uc.ImportUsers(nil, false); !errors.Is(err, ErrEmptyImport) {
+		t.Errorf("Expected ErrEmptyImport, got %v", err)
+	}
+	uc.cfg.Import.MaxRows = 1
+	if _, err := uc.ImportUsers(rows, true); !errors.Is(err, ErrImportTooLarge) {
+		t.Errorf("Expected ErrImportTooLarge, got %v", err)
+	}
+}
+
+func TestExportUsers(t *testing.T) {
+	uc := &UserUseCaseImpl{
+		cfg:      config.Load(),
+		userRepo: &MockUserRepository{},
+	}
+	uc.cfg.Export.BatchSize = 2
+	for id := uint64(1); id <= 5; id++ {
+		uc.userRepo.Create(&entity.User{ID: id, Email: fmt.Sprintf("user%d@example.com", id)})
+	}
+
+	// Users are delivered in batches of the configured size
+	var batches []int
+	err := uc.ExportUsers(nil, func(users []*entity.User) error {
+		batches = append(batches, len(users))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error exporting users: %s", err.Error())
+	}
+	if fmt.Sprint(batches) != "[2 2 1]" {
+		t.Errorf("Unexpected batch sizes %v", batches)
+	}
+
+	// An error while processing a batch stops the export
+	failure := errors.New("client disconnected")
+	calls := 0
+	err = uc.ExportUsers(nil, func(users []*entity.User) error {
+		calls++
+		return failure
+	})
+	if !errors.Is(err, failure) || calls != 1 {
+		t.Errorf("Expected the export to stop on the first failed batch, got %v after %d calls", err, calls)
+	}
+
+	sorted := &repository.UserFilter{Sort: []repository.UserSort{{Field: "name"}}}
+	if err := uc.ExportUsers(sorted, func([]*entity.User) error { return nil }); !errors.Is(err, repository.ErrInvalidSort) {
+		t.Errorf("Expected ErrInvalidSort when sorting the export, got %v", err)
+	}
+	minAge, maxAge := 40, 30
+	invalid := &repository.UserFilter{MinAge: &minAge, MaxAge: &maxAge}
+	if err := uc.ExportUsers(invalid, func([]*entity.User) error { return nil }); !errors.Is(err, ErrInvalidFilter) {
+		t.Errorf("Expected ErrInvalidFilter, got %v", err)
+	}
 }
@@ -2,13 +2,28 @@ package usecase
 
 import (
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/entity"
 	"github.com/mvzcanhaco/api-users-crud-verifymy/domain/utils"
+	"github.com/mvzcanhaco/api-users-crud-verifymy/repository"
 )
 
 func (uc *UserUseCaseImpl) CreateUser(user *CreateUserData) (*entity.User, error) {
+	return uc.createUser(user, entity.RoleUser)
+}
+
+// Cadastro feito por um administrador, que escolhe o perfil do novo usuário
+func (uc *UserUseCaseImpl) CreateUserWithProfile(user *CreateUserData, profile string) (*entity.User, error) {
+	if err := entity.ValidateProfile(profile); err != nil {
+		return nil, err
+	}
+	return uc.createUser(user, profile)
+}
 
+func (uc *UserUseCaseImpl) createUser(user *CreateUserData, profile string) (*entity.User, error) {
 	if user == nil {
 		return nil, errors.New("user is nil")
 	}
@@ -29,27 +44,96 @@ func (uc *UserUseCaseImpl) CreateUser(user *CreateUserData) (*entity.User, error
 
 	// Atribui a idade calculada ao usuário
 	newUser.Age = age
-	newUser.Profile = "user"
+	newUser.Profile = profile
+	newUser.Status = entity.UserStatusActive
 
 	// Chame a função uc.userRepo.Create com a entidade User
-	return newUser, uc.userRepo.Create(newUser)
+	if err := uc.userRepo.Create(newUser); err != nil {
+		// O e-mail pode ter sido cadastrado por outra requisição depois da verificação
+		if errors.Is(err, repository.ErrDuplicateKey) {
+			return newUser, ErrEmailTaken
+		}
+		return newUser, err
+	}
+
+	// O cadastro não falha se o envio do e-mail falhar: o usuário pode solicitar o reenvio
+	if err := uc.sendVerificationEmail(newUser); err != nil {
+		log.Printf("Falha ao enviar e-mail de verificação para o usuário %d: %v", newUser.ID, err)
+	}
+
+	return newUser, nil
 }
 
 func (uc *UserUseCaseImpl) GetUserByID(id uint64) (*entity.User, error) {
 	return uc.userRepo.FindByID(id)
 }
 
-func (uc *UserUseCaseImpl) GetAllUsers(page, pageSize int) ([]*entity.User, error) {
-	if page <= 0 || pageSize <= 0 {
+// Carrega somente os campos informados; sem campos, equivale a GetUserByID
+func (uc *UserUseCaseImpl) GetUserByIDWithFields(id uint64, fields []string) (*entity.User, error) {
+	if len(fields) == 0 {
+		return uc.userRepo.FindByID(id)
+	}
+	return uc.userRepo.FindByIDWithFields(id, fields)
+}
+
+// Páginas maiores que o limite configurado são reduzidas a ele
+func (uc *UserUseCaseImpl) limitPageSize(pageSize int) int {
+	if pageSize > uc.cfg.Pagination.MaxPageSize {
+		return uc.cfg.Pagination.MaxPageSize
+	}
+	return pageSize
+}
+
+func (uc *UserUseCaseImpl) GetAllUsers(filter *repository.UserFilter, pagination Pagination) (*UserPage, error) {
+	if (!pagination.UseCursor && pagination.Page <= 0) || pagination.PageSize <= 0 {
 		return nil, errors.New("page and pageSize must be greater than 0")
 	}
-	// Chamar o método FindAll do repositório passando os índices
-	users, err := uc.userRepo.FindAll(page, pageSize)
+	if err := validateUserFilter(filter); err != nil {
+		return nil, err
+	}
+
+	pagination.PageSize = uc.limitPageSize(pagination.PageSize)
+
+	total, err := uc.userRepo.Count(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if pagination.UseCursor {
+		page, err := uc.getUsersByCursor(filter, pagination)
+		if err != nil {
+			return nil, err
+		}
+		page.Total = total
+		return page, nil
+	}
+
+	// Chamar o método FindAll do repositório passando os filtros e os índices
+	users, err := uc.userRepo.FindAll(filter, pagination.Page, pagination.PageSize)
 	if err != nil {
 		return nil, err
 	}
 
-	return users, nil
+	return &UserPage{
+		Users:    users,
+		Total:    total,
+		Page:     pagination.Page,
+		PageSize: pagination.PageSize,
+	}, nil
+}
+
+// Os intervalos de idade e de data de cadastro precisam começar antes de terminar
+func validateUserFilter(filter *repository.UserFilter) error {
+	if filter == nil {
+		return nil
+	}
+	if filter.MinAge != nil && filter.MaxAge != nil && *filter.MinAge > *filter.MaxAge {
+		return ErrInvalidFilter
+	}
+	if filter.CreatedFrom != nil && filter.CreatedTo != nil && !filter.CreatedFrom.Before(*filter.CreatedTo) {
+		return ErrInvalidFilter
+	}
+	return nil
 }
 
 func (uc *UserUseCaseImpl) UpdateUser(user *entity.User) error {
@@ -57,6 +141,23 @@ func (uc *UserUseCaseImpl) UpdateUser(user *entity.User) error {
 	if user == nil {
 		return errors.New("user is nil")
 	}
+	// O usuário é validado por inteiro, já que a atualização pode ter limpado campos obrigatórios
+	if err := user.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidUserData, err)
+	}
+
+	current, err := uc.userRepo.FindByID(user.ID)
+	if err != nil {
+		return err
+	}
+	// Diferenças apenas entre maiúsculas e minúsculas não trocam o endereço
+	emailChanged := !strings.EqualFold(current.Email, user.Email)
+	if emailChanged {
+		if err := uc.prepareEmailChange(user, current.Email); err != nil {
+			return err
+		}
+	}
+
 	// Calcula a idade com base na data de nascimento
 	age, err := utils.CalculateAge(user.BirthDate)
 	if err != nil {
@@ -65,17 +166,107 @@ func (uc *UserUseCaseImpl) UpdateUser(user *entity.User) error {
 
 	// Atribui a idade calculada ao usuário
 	user.Age = age
-	return uc.userRepo.Update(user)
+	if err := uc.userRepo.Update(user); err != nil {
+		if errors.Is(err, repository.ErrDuplicateKey) {
+			return ErrEmailTaken
+		}
+		return err
+	}
+
+	// A alteração não falha se o envio do e-mail falhar: o usuário pode solicitar o reenvio ou alterar o e-mail novamente
+	if emailChanged {
+		if err := uc.sendEmailChangeMessage(user); err != nil {
+			log.Printf("Falha ao enviar a confirmação de troca de e-mail para o usuário %d: %v", user.ID, err)
+		}
+	}
+	return nil
 }
 
-func (uc *UserUseCaseImpl) DeleteUser(id uint64) error {
-	return uc.userRepo.Delete(id)
+// Exclui logicamente o usuário, que pode ser restaurado até o expurgo.
+// Com version diferente de zero, falha com repository.ErrVersionConflict se o usuário tiver sido alterado
+func (uc *UserUseCaseImpl) DeleteUser(id, version uint64) error {
+	deleted, err := uc.userRepo.Delete(id, version)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrLastAdmin
+	}
+
+	// Tokens já emitidos para o usuário removido deixam de ser aceitos
+	return uc.revokeAllUserTokens(id)
 }
 
-func (u *UserUseCaseImpl) CheckEmailExists(email string) (bool, error) {
-	user, err := u.userRepo.FindByEmail(email)
+// Promove ou rebaixa o usuário. O último administrador não pode ser rebaixado
+func (uc *UserUseCaseImpl) ChangeUserProfile(id uint64, profile string) (*entity.User, error) {
+	if err := entity.ValidateProfile(profile); err != nil {
+		return nil, err
+	}
+
+	user, err := uc.userRepo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Profile == profile {
+		return user, nil
+	}
+
+	updated, err := uc.userRepo.UpdateProfile(id, profile)
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrLastAdmin
+	}
+	user.Profile = profile
+
+	// O perfil e as permissões estão embutidos nos tokens de acesso: a renovação emite um token com o novo perfil
+	if err := uc.revocationRepo.RevokeUserTokens(id, revocationCutoff()); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// Alterações em outro usuário exigem que o ator tenha todas as permissões do alvo, recebidas pelo perfil ou por papéis
+// atribuídos. Sem isso, quem tem users:write poderia trocar o e-mail de um administrador e redefinir sua senha
+func (u *UserUseCaseImpl) AuthorizeUserWrite(actor *Principal, userID uint64) error {
+	if actor == nil {
+		return ErrUserWriteNotAllowed
+	}
+	if actor.ClientID == "" && actor.UserID == userID {
+		return nil
+	}
+
+	user, err := u.userRepo.FindByID(userID)
+	if err != nil {
+		return err
+	}
+
+	_, covered, err := u.permissionsCoveredBy(actor, user)
 	if err != nil {
-		return false, err
+		return err
 	}
-	return user != nil, nil
+	if !covered {
+		return ErrUserWriteNotAllowed
+	}
+	return nil
+}
+
+// Retorna as permissões efetivas do usuário e se o ator possui todas elas
+func (u *UserUseCaseImpl) permissionsCoveredBy(actor *Principal, user *entity.User) ([]string, bool, error) {
+	permissions, err := u.roleRepo.PermissionsForUser(user.ID, user.Profile)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, permission := range permissions {
+		if !actor.HasPermission(permission) {
+			return permissions, false, nil
+		}
+	}
+	return permissions, true, nil
+}
+
+// Usuários excluídos ainda não expurgados e trocas de e-mail pendentes mantêm o e-mail reservado
+func (u *UserUseCaseImpl) CheckEmailExists(email string) (bool, error) {
+	return u.userRepo.EmailInUse(email, 0)
 }